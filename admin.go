@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+////////////////////////////////////////////////////////////////
+
+// Returns true if the user is allowed to use the admin commands
+func isBotOwner(userID string) bool {
+	return len(OwnerID) > 0 && userID == OwnerID
+}
+
+// Replies with an error message if the author of the message is not the bot owner
+func checkBotOwner(s DiscordSession, m *discordgo.MessageCreate) bool {
+	if isBotOwner(m.Author.ID) {
+		return true
+	}
+	_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only the bot owner can use admin commands.")
+	return false
+}
+
+// Returns the name of the guild with the given ID, or the ID itself if the guild is unknown
+func guildName(s DiscordSession, guildID string) string {
+	guild, err := s.StateGuild(guildID)
+	if err != nil || guild == nil {
+		return guildID
+	}
+	return guild.Name
+}
+
+func cupStatusName(status int) string {
+	switch status {
+	case CupStatusSignup:
+		return "sign-up"
+	case CupStatusPickup:
+		return "picking"
+	case CupStatusReady:
+		return "ready"
+	}
+	return "inactive"
+}
+
+// Handle admin reload command
+func handleAdminReload(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	if !checkBotOwner(s, m) {
+		return
+	}
+
+	changed, err := reloadGuildConfigs()
+	if err != nil {
+		logError("Error reloading guild settings:", err)
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the server settings couldn't be reloaded: "+err.Error())
+		return
+	}
+	logInfo("Guild settings reloaded by", m.Author.Username+",", len(changed), "changed")
+
+	if len(changed) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the server settings were reloaded, nothing changed.")
+		return
+	}
+
+	lines := make([]string, 0, len(changed))
+	for guildID, names := range changed {
+		lines = append(lines, guildName(s, guildID)+" ("+guildID+"): "+strings.Join(names, ", "))
+	}
+	sort.Strings(lines)
+
+	message := bold(escape(m.Author.Username)) + ", the server settings were reloaded. Changes:\n```\n"
+	for _, line := range lines {
+		message += line + "\n"
+	}
+	message += "```"
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
+
+// Handle admin guilds command
+func handleAdminGuilds(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	if !checkBotOwner(s, m) {
+		return
+	}
+
+	cupsPerGuild := make(map[string]int)
+	lockCups.Lock()
+	for _, currentCup := range activeCups {
+		cupsPerGuild[currentCup.GuildID]++
+	}
+	lockCups.Unlock()
+
+	guilds := s.StateGuilds()
+	lines := make([]string, 0, len(guilds))
+	for _, guild := range guilds {
+		lines = append(lines, guild.Name+" ("+guild.ID+"): "+numbered(cupsPerGuild[guild.ID], "active cup"))
+	}
+
+	if len(lines) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the bot hasn't joined any servers.")
+		return
+	}
+
+	sort.Strings(lines)
+	message := "The bot is in " + numbered(len(lines), "server") + ":\n```\n"
+	for _, line := range lines {
+		message += line + "\n"
+	}
+	message += "```"
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
+
+// Handle admin cups command
+func handleAdminCups(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	if !checkBotOwner(s, m) {
+		return
+	}
+
+	var lines []string
+	lockCups.Lock()
+	for _, currentCup := range activeCups {
+		lines = append(lines, guildName(s, currentCup.GuildID)+" "+mentionChannel(currentCup.ChannelID)+": "+
+			cupStatusName(currentCup.Status)+", "+numbered(len(currentCup.Players), "player")+
+			", managed by "+escape(currentCup.Manager.Name)+" (since "+currentCup.StartTime.UTC().Format("2006-01-02 15:04")+" UTC)")
+	}
+	lockCups.Unlock()
+
+	if len(lines) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no cups running.")
+		return
+	}
+
+	sort.Strings(lines)
+	message := numbered(len(lines), "cup") + " running:\n"
+	for _, line := range lines {
+		message += "- " + line + "\n"
+	}
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"math/rand"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -12,7 +14,7 @@ import (
 ////////////////////////////////////////////////////////////////
 
 // Handle draft cup start command
-func handleStart(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+func handleStart(args string, s DiscordSession, m *discordgo.MessageCreate) {
 	currentCup := getCup(m.ChannelID)
 	if currentCup != nil {
 		message := bold(escape(m.Author.Username)) + ", "
@@ -22,105 +24,469 @@ func handleStart(args string, s *discordgo.Session, m *discordgo.MessageCreate)
 			message += display(&currentCup.Manager)
 		}
 		message += " already started the cup."
-		_, _ = s.ChannelMessageSend(m.ChannelID, message)
+		_, _ = sendMessage(s, m.ChannelID, message)
 		currentCup.reply(s, "", CupReportAll)
 		return
 	}
 
-	currentCup = addCup(m.ChannelID)
-	currentCup.Manager = makePlayer(m.Author)
-	currentCup.Description = args
-
-	channel, err := s.Channel(m.ChannelID)
+	description, err := parseDescription(args)
 	if err != nil {
-		fmt.Println("Could not retrieve channel info:", err.Error())
-	} else {
-		currentCup.GuildID = channel.GuildID
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+".")
+		return
+	}
+
+	currentCup = startCup(s, m, description)
+	currentCup.announceStart(s, m, "")
+}
+
+// Handle draft cup copy command
+func handleCopy(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's already a cup in progress in this channel.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	previousCup := getFinishedCup(m.ChannelID)
+	if previousCup == nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no finished cup in this channel to copy. You can start a new one with "+bold(commandStart.syntax()))
+		return
+	}
+
+	currentCup = startCup(s, m, previousCup.Description)
+	currentCup.TeamSize = previousCup.TeamSize
+	numActive := previousCup.activePlayerCount()
+	for i := 0; i < numActive && i < len(previousCup.Players); i++ {
+		player := previousCup.Players[i]
+		player.resetTeam()
+		player.restoreName()
+		currentCup.addPlayer(player)
+	}
+
+	extra := "Players from the previous cup have been signed up again. If you can't play this time, type " + bold(commandRemove.syntaxNoArgs()) + "\n"
+	if currentCup.announceStart(s, m, extra) {
+		currentCup.reply(s, "", CupReportAll)
+	}
+}
+
+// Handle draft cup clone command
+func handleClone(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's already a cup in progress in this channel.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	sourceID := parseChannelMention(token)
+	if len(sourceID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to mention the channel of the cup to clone, e.g. "+bold(commandClone.syntaxNoArgs()+" #other-channel"))
+		return
 	}
 
-	text := "Hey, @everyone!\n\nRegistration is now open for a new draft cup, managed by " + bold(escape(m.Author.Username)) + ".\n\n"
-	if len(args) > 0 {
-		text += args + "\n\n"
+	sourceCup := getCup(sourceID)
+	if sourceCup == nil || sourceCup.GuildID != channelGuildID(s, m.ChannelID) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in "+mentionChannel(sourceID)+".")
+		return
+	}
+
+	if !sourceCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only "+display(&sourceCup.Manager)+", the manager of the cup in "+mentionChannel(sourceID)+", or an admin can clone it.")
+		return
+	}
+
+	currentCup = startCup(s, m, sourceCup.Description)
+	currentCup.TeamSize = sourceCup.TeamSize
+	currentCup.MinimumTeams = sourceCup.MinimumTeams
+	currentCup.Moderation = sourceCup.Moderation
+	currentCup.AutoCaptains = sourceCup.AutoCaptains
+	currentCup.CompensationPick = sourceCup.CompensationPick
+	currentCup.AllowPasses = sourceCup.AllowPasses
+	currentCup.LimitSubs = sourceCup.LimitSubs
+	currentCup.MaxSubs = sourceCup.MaxSubs
+	currentCup.AutoClose = sourceCup.AutoClose
+	currentCup.CaptainOrder = sourceCup.CaptainOrder
+	currentCup.ManualLastPick = sourceCup.ManualLastPick
+	currentCup.BestOf = sourceCup.BestOf
+
+	extra := "Settings were copied from the cup in " + mentionChannel(sourceID) + " (" + numbered(currentCup.TeamSize, "player") + " per team).\n"
+	if currentCup.announceStart(s, m, extra) {
+		currentCup.reply(s, "", CupReportAll)
+	}
+}
+
+// Handle draft cup rematch command
+func handleRematch(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's already a cup in progress in this channel.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	previousCup := getFinishedCup(m.ChannelID)
+	if previousCup == nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no finished cup in this channel to rematch. You can start a new one with "+bold(commandStart.syntax()))
+		return
 	}
-	text += "You can sign up now by typing " + bold(commandAdd.syntax())
 
+	currentCup = startCup(s, m, previousCup.Description)
+	currentCup.Status = CupStatusReady
+	currentCup.TeamSize = previousCup.TeamSize
+	currentCup.PickedPlayers = previousCup.PickedPlayers
+	currentCup.Players = append([]Player(nil), previousCup.Players...)
+	currentCup.SignUps = previousCup.SignUps
+	currentCup.Teams = append([]Team(nil), previousCup.Teams...)
 	currentCup.StartTime = time.Now()
-	currentCup.NextPromoteTime = currentCup.StartTime.Add(MinimumPromotionInterval)
-	currentCup.NextPromoteTimeManager = currentCup.StartTime.Add(MinimumPromotionIntervalManager)
+	currentCup.updateTeamNameCache()
 
-	s.ChannelMessageDelete(m.ChannelID, m.ID)
-	message, err := s.ChannelMessageSend(currentCup.ChannelID, text)
-	if err != nil {
-		fmt.Println("Unable to send cup start message, aborting cup: ", err)
-		deleteCup(currentCup.ChannelID)
-	} else {
-		currentCup.unpinAll(s)
-		currentCup.StartMessageID = message.ID
-		s.ChannelMessagePin(currentCup.ChannelID, message.ID)
+	text := "Rematch time! " + bold(escape(m.Author.Username)) + " brought back the teams from the last cup.\n\n"
+
+	absent := currentCup.absentPlayers(s)
+	if len(absent) > 0 {
+		text += "Warning: "
+		for i, player := range absent {
+			if i != 0 {
+				if i == len(absent)-1 {
+					text += " and "
+				} else {
+					text += ", "
+				}
+			}
+			text += currentCup.display(player)
+		}
+		text += " can't be found on this server anymore.\n\n"
 	}
+
+	currentCup.deleteAndReply(s, m, text, CupReportAll)
 }
 
 // Handle draft cup abort command
-func handleAbort(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+func handleAbort(args string, s DiscordSession, m *discordgo.MessageCreate) {
 	currentCup := getCup(m.ChannelID)
 	if currentCup == nil {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Can't abort a cup that hasn't started.")
+		_, _ = sendMessage(s, m.ChannelID, "Can't abort a cup that hasn't started.")
 		return
 	}
 
-	if !currentCup.isSuperUser(m.Author.ID) {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can abort this cup.")
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can abort this cup.")
 		return
 	}
 
-	_, _ = s.ChannelMessageSend(m.ChannelID, "Cup aborted by "+bold(escape(m.Author.Username))+". You can start a new one with "+bold(commandStart.syntax()))
+	_, _ = sendMessage(s, m.ChannelID, "Cup aborted by "+bold(escape(m.Author.Username))+". You can start a new one with "+bold(commandStart.syntax()))
 	currentCup.unpinAll(s)
-	deleteCup(m.ChannelID)
+	currentCup.deleteVoiceChannels(s)
+	deleteCup(s, m.ChannelID)
 }
 
 // Handle draft cup sign up
-func handleAdd(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+func handleAdd(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	// Signing up for a cup in another channel
+	if targetID := parseChannelMention(strings.TrimSpace(args)); len(targetID) > 0 && targetID != m.ChannelID {
+		handleRemoteAdd(args, s, m)
+		return
+	}
+
 	currentCup := getCup(m.ChannelID)
 	if currentCup == nil || currentCup.Status == CupStatusInactive {
-		_, _ = s.ChannelMessageSend(m.ChannelID, noCupHereMessage(s, m))
+		handleRemoteAdd(args, s, m)
 		return
 	}
 
 	switch currentCup.Status {
 	case CupStatusSignup, CupStatusPickup:
+		if currentCup.isBanned(m.Author.ID) {
+			if !currentCup.rejectWithReaction(s, m) {
+				_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", you were kicked from this cup and can't sign up again.")
+			}
+			return
+		}
+
+		if currentCup.rosterLocked() {
+			if currentCup.rejectWithReaction(s, m) {
+				return
+			}
+			_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the roster for this cup is locked at the moment.")
+			currentCup.reply(s, "", CupReportAll)
+			return
+		}
+
+		if currentCup.Status == CupStatusSignup && currentCup.Paused {
+			if currentCup.rejectWithReaction(s, m) {
+				return
+			}
+			_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", sign-up for this cup is paused at the moment.")
+			currentCup.reply(s, "", CupReportAll)
+			return
+		}
+
 		before := currentCup.findPlayer(m.Author.ID)
 		if before != -1 && !devHacks.allowDuplicates {
+			if currentCup.rejectWithReaction(s, m) {
+				return
+			}
 			message := bold(escape(m.Author.Username)) + ", you're already registered for this cup (" + nth(before+1) + " of " + strconv.Itoa(len(currentCup.Players)) + ")."
-			_, _ = s.ChannelMessageSend(m.ChannelID, message)
+			_, _ = sendMessage(s, m.ChannelID, message)
+			currentCup.reply(s, "", CupReportAll)
+		} else if currentCup.Status != CupStatusSignup && currentCup.subsFull() {
+			if currentCup.rejectWithReaction(s, m) {
+				return
+			}
+			message := "Sorry, " + bold(escape(m.Author.Username)) + ", the cup already has the maximum number of substitutes."
+			_, _ = sendMessage(s, m.ChannelID, message)
 			currentCup.reply(s, "", CupReportAll)
 		} else {
-			currentCup.Players = append(currentCup.Players, makePlayer(m.Author))
+			currentCup.addPlayer(makeMemberPlayer(s, currentCup.GuildID, m.Author))
+			currentCup.noteActivity()
+			if currentCup.autoCloseIfFull(s, "") {
+				deleteCommand(s, m)
+				return
+			}
+			if currentCup.acknowledge(s, m, CupReportAll) {
+				return
+			}
 			if currentCup.Status != CupStatusSignup {
 				message := mentionUser(m.Author.ID) + " joined the cup as " + nth(len(currentCup.Players)-currentCup.activePlayerCount()) + " substitute."
-				_, _ = s.ChannelMessageSend(m.ChannelID, message)
+				_, _ = sendMessage(s, m.ChannelID, message)
 			}
 			currentCup.deleteAndReply(s, m, "", CupReportAll)
 		}
 
 	default:
+		if currentCup.rejectWithReaction(s, m) {
+			return
+		}
 		message := "Sorry, " + bold(escape(m.Author.Username)) + ", cup is no longer open for signup."
-		_, _ = s.ChannelMessageSend(m.ChannelID, message)
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll)
+	}
+}
+
+// Handle draft cup addsub command
+func handleAddSub(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can add substitutes.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup && currentCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the cup is no longer open for substitutes.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.rosterLocked() {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the roster is locked. Type "+bold(commandUnlock.syntax())+" to add players again.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if len(m.Mentions) != 1 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to mention the player to add, e.g. "+bold(commandAddSub.example("@Player")))
+		return
+	}
+	user := m.Mentions[0]
+
+	if currentCup.isBanned(user.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", "+bold(escape(user.Username))+" was kicked from this cup and can't be added again.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if index := currentCup.findPlayer(user.ID); index != -1 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+bold(escape(user.Username))+" is already registered for this cup ("+nth(index+1)+" of "+strconv.Itoa(len(currentCup.Players))+").")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup && currentCup.subsFull() {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the cup already has the maximum number of substitutes.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	player := makeMemberPlayer(s, currentCup.GuildID, user)
+	player.SubOnly = true
+	currentCup.addPlayer(player)
+	currentCup.noteActivity()
+
+	message := bold(escape(m.Author.Username)) + " added " + mention(&player) + " to the cup as a substitute.\n\n"
+	currentCup.deleteAndReply(s, m, message, CupReportAll)
+}
+
+// Handle draft cup fill command
+func handleFill(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can fill up slots.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", slots can only be filled up during sign-up.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.rosterLocked() {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the roster is locked. Type "+bold(commandUnlock.syntax())+" to add players again.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+
+	// Without a count, the manager signs up
+	if len(token) == 0 {
+		if currentCup.findPlayer(m.Author.ID) != -1 {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you're already registered for this cup. To reserve slots, type "+bold(commandFill.syntax()))
+			currentCup.reply(s, "", CupReportAll)
+			return
+		}
+		currentCup.addPlayer(makeMemberPlayer(s, currentCup.GuildID, m.Author))
+		currentCup.noteActivity()
+		currentCup.deleteAndReply(s, m, "", CupReportAll)
+		return
+	}
+
+	count, err := strconv.Atoi(token)
+	if err != nil || count < 1 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid number of slots.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	existing := currentCup.placeholderCount()
+	if existing+count > MaxPlaceholders {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", a cup can't have more than "+numbered(MaxPlaceholders, "reserved slot")+" ("+strconv.Itoa(existing)+" so far).")
 		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	for i := 1; i <= count; i++ {
+		currentCup.addPlayer(makePlaceholder(existing + i))
+	}
+	currentCup.noteActivity()
+
+	text := bold(escape(m.Author.Username)) + " reserved " + numbered(count, "slot") + ". Use " + bold(commandSetName.syntax()) + " to name them, or " + bold(commandRemove.syntax()) + " to free them up.\n"
+	currentCup.deleteAndReply(s, m, text, CupReportAll)
+}
+
+// Handle draft cup sign up for a cup in another channel: either the one mentioned, or, in a channel
+// without a cup, the only cup in the guild, if users explicitly opt to sign up for it.
+func handleRemoteAdd(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	var token string
+	token, args = parseToken(args)
+
+	if targetID := parseChannelMention(token); len(targetID) > 0 {
+		otherCup := getCup(targetID)
+		if otherCup == nil || otherCup.Status == CupStatusInactive || otherCup.GuildID != channelGuildID(s, m.ChannelID) {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in "+mentionChannel(targetID)+".")
+			return
+		}
+		remoteSignup(s, m, otherCup)
+		return
+	}
+
+	others, err := getAlternativeChannels(s, m.ChannelID)
+	if err != nil || len(others) != 1 {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	otherCup := getCup(others[0].ID)
+	if otherCup == nil {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	if !strings.EqualFold(token, RemoteAddKeyword) {
+		message := noCupHereMessage(s, m) + "\nTo sign up for the cup in " + mentionChannel(otherCup.ChannelID) + " without leaving this channel, type " + bold(commandAdd.syntaxNoArgs()+" "+RemoteAddKeyword)
+		_, _ = sendMessage(s, m.ChannelID, message)
+		return
+	}
+
+	remoteSignup(s, m, otherCup)
+}
+
+// Signs the author of a message up for a cup running in another channel, announcing it there
+func remoteSignup(s DiscordSession, m *discordgo.MessageCreate, otherCup *Cup) {
+	if otherCup.Status != CupStatusSignup && otherCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the cup in "+mentionChannel(otherCup.ChannelID)+" is no longer open for signup.")
+		return
+	}
+
+	if otherCup.rosterLocked() {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the roster for the cup in "+mentionChannel(otherCup.ChannelID)+" is locked at the moment.")
+		return
+	}
+
+	if otherCup.Status == CupStatusSignup && otherCup.Paused {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", sign-up for the cup in "+mentionChannel(otherCup.ChannelID)+" is paused at the moment.")
+		return
+	}
+
+	if otherCup.isBanned(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", you were kicked from the cup in "+mentionChannel(otherCup.ChannelID)+" and can't sign up again.")
+		return
+	}
+
+	before := otherCup.findPlayer(m.Author.ID)
+	if before != -1 && !devHacks.allowDuplicates {
+		message := bold(escape(m.Author.Username)) + ", you're already registered for the cup in " + mentionChannel(otherCup.ChannelID) + " (" + nth(before+1) + " of " + strconv.Itoa(len(otherCup.Players)) + ")."
+		_, _ = sendMessage(s, m.ChannelID, message)
+		return
+	}
+
+	if otherCup.Status != CupStatusSignup && otherCup.subsFull() {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the cup in "+mentionChannel(otherCup.ChannelID)+" already has the maximum number of substitutes.")
+		return
+	}
+
+	otherCup.addPlayer(makeMemberPlayer(s, otherCup.GuildID, m.Author))
+	otherCup.noteActivity()
+	text := mentionUser(m.Author.ID) + " signed up from " + mentionChannel(m.ChannelID)
+	if otherCup.Status != CupStatusSignup {
+		text += " as " + nth(len(otherCup.Players)-otherCup.activePlayerCount()) + " substitute"
 	}
+	text += ".\n"
+	if !otherCup.autoCloseIfFull(s, text) {
+		otherCup.reply(s, text, CupReportAll)
+	}
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you're now signed up for the cup in "+mentionChannel(otherCup.ChannelID)+".")
 }
 
 // Handle draft cup withdrawals
-func handleRemove(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+func handleRemove(args string, s DiscordSession, m *discordgo.MessageCreate) {
 	currentCup := getCup(m.ChannelID)
 	if currentCup == nil {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "No cup in progress in this channel, anyway.")
+		_, _ = sendMessage(s, m.ChannelID, "No cup in progress in this channel, anyway.")
 		return
 	}
 
 	switch currentCup.Status {
 	case CupStatusSignup, CupStatusPickup:
 		if len(currentCup.Players) == 0 {
-			_, _ = s.ChannelMessageSend(m.ChannelID, "No players to remove, nobody has signed up for the cup yet.")
+			_, _ = sendMessage(s, m.ChannelID, "No players to remove, nobody has signed up for the cup yet.")
 			return
 		}
 
@@ -131,25 +497,23 @@ func handleRemove(args string, s *discordgo.Session, m *discordgo.MessageCreate)
 			if !currentCup.isManager(m.Author.ID) {
 				message := "Only the cup manager, " + display(&currentCup.Manager) + ", can remove other players.\n"
 				if currentCup.findPlayer(m.Author.ID) != -1 {
-					message += "You can remove yourself by typing " + bold(commandRemove.syntaxNoArgs())
+					message += "You can remove yourself by typing " + bold(commandLeave.syntax())
 				}
-				_, _ = s.ChannelMessageSend(m.ChannelID, message)
+				_, _ = sendMessage(s, m.ChannelID, message)
 				currentCup.reply(s, "", CupReportAll)
 				return
 			}
 
-			index, err := strconv.Atoi(token)
-			if err != nil {
-				message := bold(escape(m.Author.Username)) + ", '" + token + "' doesn't look like a number, either leave it out (to remove yourself from the list of players) or specify an actual player number.\n\n"
-				_, _ = s.ChannelMessageSend(m.ChannelID, message)
+			if currentCup.rosterLocked() {
+				_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the roster is locked. Type "+bold(commandUnlock.syntax())+" to remove players again.")
 				currentCup.reply(s, "", CupReportAll)
 				return
 			}
-			index-- // 0-based
 
-			if index < 0 || index >= len(currentCup.Players) {
-				message := bold(escape(m.Author.Username)) + ", " + token + " is not a valid player number."
-				_, _ = s.ChannelMessageSend(m.ChannelID, message)
+			index, err := currentCup.parsePlayerNumber(token)
+			if err != nil {
+				message := bold(escape(m.Author.Username)) + ", " + err.Error() + ". Either leave it out (to remove yourself from the list of players) or specify an actual player number.\n\n"
+				_, _ = sendMessage(s, m.ChannelID, message)
 				currentCup.reply(s, "", CupReportAll)
 				return
 			}
@@ -158,151 +522,419 @@ func handleRemove(args string, s *discordgo.Session, m *discordgo.MessageCreate)
 		} else {
 			which = currentCup.findPlayer(m.Author.ID)
 			if which == -1 {
-				_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", you're not registered for this cup anyway.")
+				if currentCup.rejectWithReaction(s, m) {
+					return
+				}
+				_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you're not registered for this cup anyway.")
 				currentCup.reply(s, "", CupReportAll)
 				return
 			}
-		}
-
-		if currentCup.Status >= CupStatusPickup {
-			active := currentCup.activePlayerCount()
-			player := &currentCup.Players[which]
-
-			// if the player to be removed isn't a substitute
-			if which < active {
-				// ...but a substitute is available
-				if active < len(currentCup.Players) {
-					sub := &currentCup.Players[active]
-					sub.ID, player.ID = player.ID, sub.ID
-					sub.Name, player.Name = player.Name, sub.Name
-					which = active
-					message := mention(player) + " has left the cup and " + mention(sub) + " will take his place."
-					s.ChannelMessageSend(m.ChannelID, message)
-				} else {
-					var target string
-					if m.Author.ID == player.ID {
-						target = "you"
-					} else {
-						target = mention(player)
-					}
-
-					message := bold(escape(m.Author.Username)) + ", there's no substitute available to replace " + target +
-						".\nYou need to find a substitute first and have him sign up by typing " + bold(commandAdd.syntax())
-					s.ChannelMessageSend(m.ChannelID, message)
+			if currentCup.rosterLocked() && currentCup.LockedStrict {
+				if currentCup.rejectWithReaction(s, m) {
 					return
 				}
-			} else {
-				message := mention(player) + " has left the cup."
-				s.ChannelMessageSend(m.ChannelID, message)
+				_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the roster is locked, so you can't leave right now. Ask "+display(&currentCup.Manager)+", the cup manager, to unlock it.")
+				currentCup.reply(s, "", CupReportAll)
+				return
 			}
 		}
 
-		currentCup.Players = append(currentCup.Players[:which], currentCup.Players[which+1:]...)
+		departed := currentCup.Players[which]
+		if !currentCup.removePlayer(s, m, which, "has left") {
+			return
+		}
+		if departed.ID == m.Author.ID {
+			currentCup.Departures = append(currentCup.Departures, Player{Name: departed.Name, ID: departed.ID, Team: -1, Next: -1})
+			if err := recordDeparture(currentCup.GuildID, &departed); err != nil {
+				logError(logGuild(currentCup.GuildID), "Error saving player statistics:", err)
+			}
+		}
+		if currentCup.acknowledge(s, m, CupReportAll) {
+			return
+		}
 		currentCup.deleteAndReply(s, m, "", CupReportAll)
 
 	default:
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Cup is not currently open for signup, anyway.")
+		_, _ = sendMessage(s, m.ChannelID, "Cup is not currently open for signup, anyway.")
 	}
 }
 
-// Handle draft cup registration close
-func handleClose(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+// Handle draft cup leave command
+func handleLeave(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	// Same as remove without a player number, which only ever affects the author
+	handleRemove("", s, m)
+}
+
+// Handle draft cup wholeft command
+func handleWhoLeft(args string, s DiscordSession, m *discordgo.MessageCreate) {
 	currentCup := getCup(m.ChannelID)
-	if currentCup == nil {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "No cup in progress in this channel, no sign-ups to close.")
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
 		return
 	}
 
-	if !currentCup.isManager(m.Author.ID) {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can close sign-up.")
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can see who left the cup.")
 		return
 	}
 
-	s.ChannelMessageDelete(m.ChannelID, m.ID)
+	if len(currentCup.Departures) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", nobody has left this cup so far.")
+		return
+	}
 
-	switch currentCup.Status {
-	case CupStatusSignup:
-		// Hack to allow testing
-		if devHacks.fillUpOnClose > 0 {
-			if len(currentCup.Players) == 0 {
-				currentCup.Players = append(currentCup.Players, currentCup.Manager)
-			}
-			for i := len(currentCup.Players); i < devHacks.fillUpOnClose; i++ {
-				currentCup.Players = append(currentCup.Players, currentCup.Players[0])
-			}
+	// Players who left more than once are listed once, with a count
+	var order []string
+	departures := make(map[string]int)
+	names := make(map[string]string)
+	for _, player := range currentCup.Departures {
+		if departures[player.ID] == 0 {
+			order = append(order, player.ID)
 		}
+		departures[player.ID]++
+		names[player.ID] = player.Name
+	}
 
-		signedUp := len(currentCup.Players)
-		minPlayers := currentCup.minPlayerCount()
-		if signedUp < minPlayers {
-			var who string
-			if signedUp == 0 {
-				who = "Nobody"
-			} else {
-				who = "Only " + numbered(signedUp, "player")
-			}
-			_, _ = s.ChannelMessageSend(currentCup.ChannelID, who+" signed up, cup aborted.")
-			currentCup.unpinAll(s)
-			deleteCup(m.ChannelID)
-			return
+	message := numbered(len(order), "player") + " left this cup after signing up:\n```\n"
+	for i, id := range order {
+		message += strconv.Itoa(i+1) + ". " + names[id]
+		if departures[id] > 1 {
+			message += " (" + strconv.Itoa(departures[id]) + " times)"
 		}
+		message += "\n"
+	}
+	message += "```"
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
 
-		var token string
-		token, args = parseToken(args)
-		if len(token) != 0 {
+// Handle draft reliability command
+func handleReliability(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	guildID := channelGuildID(s, m.ChannelID)
+	if len(guildID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", reliability scores are only available in a server channel.")
+		return
+	}
+
+	currentCup := getCup(m.ChannelID)
+	if (currentCup == nil || !currentCup.isManager(m.Author.ID)) && !isAdmin(s, guildID, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only cup managers and admins can see reliability scores.")
+		return
+	}
+
+	players := unreliablePlayers(guildID)
+	if len(players) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Everyone on this server is fully reliable: nobody left a cup recently.")
+		return
+	}
+	if len(players) > MaxLeaderboardSize {
+		players = players[:MaxLeaderboardSize]
+	}
+
+	nameLength := 0
+	for i := range players {
+		if length := utf8.RuneCountInString(players[i].Name); length > nameLength {
+			nameLength = length
+		}
+	}
+	rankDigits := digits10(len(players))
+
+	message := "Least reliable players on this server (substitutes with higher scores replace players who leave first):\n```\n"
+	for i := range players {
+		message += rightpad(strconv.Itoa(i+1)+". ", rankDigits+2) + rightpad(players[i].Name, nameLength) + " : " +
+			strconv.Itoa(players[i].reliability()) + "%, left " + numbered(players[i].Departures, "cup") + "\n"
+	}
+	message += "```"
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
+
+// Handle draft cup kick command
+func handleKick(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can kick players.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup && currentCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", players can't be kicked at this point.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.rosterLocked() {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the roster is locked. Type "+bold(commandUnlock.syntax())+" to kick players again.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	if len(token) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a player number.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	index, err := currentCup.parsePlayerNumber(token)
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+". You need to specify a player number.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	kicked := currentCup.Players[index]
+	if currentCup.Status == CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, mention(&kicked)+" was kicked from the cup.")
+	}
+	if !currentCup.removePlayer(s, m, index, "was kicked from") {
+		return
+	}
+
+	kicked.resetTeam()
+	currentCup.Banned = append(currentCup.Banned, kicked)
+	currentCup.deleteAndReply(s, m, "", CupReportAll)
+}
+
+// Handle draft cup unban command
+func handleUnban(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	if len(token) == 0 {
+		if len(currentCup.Banned) == 0 {
+			_, _ = sendMessage(s, m.ChannelID, "Nobody has been kicked from this cup.")
+			return
+		}
+		message := numbered(len(currentCup.Banned), "player") + " kicked from this cup:\n```\n"
+		for i := range currentCup.Banned {
+			message += strconv.Itoa(i+1) + ". " + currentCup.Banned[i].Name + "\n"
+		}
+		message += "```\n"
+		_, _ = sendMessage(s, m.ChannelID, message)
+		return
+	}
+
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can unban players.")
+		return
+	}
+
+	index, err := parsePlayerNumberIn(currentCup.Banned, token)
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+". Type "+bold(commandUnban.syntaxNoArgs())+" for a list of kicked players.")
+		return
+	}
+
+	player := currentCup.Banned[index]
+	currentCup.Banned = append(currentCup.Banned[:index], currentCup.Banned[index+1:]...)
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" lifted the ban on "+display(&player)+", who can now sign up again.")
+}
+
+// Handle draft cup sign-up pause command
+func handlePause(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	setPaused(true, s, m)
+}
+
+// Handle draft cup sign-up resume command
+func handleOpen(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	setPaused(false, s, m)
+}
+
+func setPaused(paused bool, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can pause or resume sign-up.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", registration for this cup is already closed.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.Paused == paused {
+		if paused {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", sign-up is already paused.")
+		} else {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", sign-up is already open.")
+		}
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	currentCup.Paused = paused
+	if paused {
+		currentCup.reply(s, bold(escape(m.Author.Username))+" paused sign-up for the cup.\n", CupReportAll)
+	} else {
+		currentCup.reply(s, bold(escape(m.Author.Username))+" opened sign-up for the cup again.\n", CupReportAll)
+	}
+}
+
+// Handle draft cup roster lock command
+func handleLock(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	var token string
+	token, args = parseToken(args)
+	if len(token) > 0 && !strings.EqualFold(token, "strict") {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid option. Type "+bold(commandLock.syntax()))
+		return
+	}
+	setLocked(true, len(token) > 0, s, m)
+}
+
+// Handle draft cup roster unlock command
+func handleUnlock(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	setLocked(false, false, s, m)
+}
+
+func setLocked(locked bool, strict bool, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can lock or unlock the roster.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", registration for this cup is already closed.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if currentCup.Locked == locked && currentCup.LockedStrict == strict {
+		if locked {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the roster is already locked.")
+		} else {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the roster is not locked.")
+		}
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	currentCup.Locked = locked
+	currentCup.LockedStrict = strict
+	switch {
+	case !locked:
+		currentCup.reply(s, bold(escape(m.Author.Username))+" unlocked the roster.\n", CupReportAll)
+	case strict:
+		currentCup.reply(s, bold(escape(m.Author.Username))+" locked the roster: nobody can join or leave for now.\n", CupReportAll)
+	default:
+		currentCup.reply(s, bold(escape(m.Author.Username))+" locked the roster: nobody can join for now, but players can still leave.\n", CupReportAll)
+	}
+}
+
+// Handle draft cup registration close
+func handleClose(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil {
+		_, _ = sendMessage(s, m.ChannelID, "No cup in progress in this channel, no sign-ups to close.")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can close sign-up.")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	switch currentCup.Status {
+	case CupStatusSignup:
+		// Hack to allow testing
+		if devHacks.fillUpOnClose > 0 {
+			if len(currentCup.Players) == 0 {
+				currentCup.Players = append(currentCup.Players, currentCup.Manager)
+			}
+			for i := len(currentCup.Players); i < devHacks.fillUpOnClose; i++ {
+				currentCup.Players = append(currentCup.Players, currentCup.Players[0])
+			}
+		}
+
+		signedUp := currentCup.playingCount()
+		minPlayers := currentCup.minPlayerCount()
+		if signedUp < minPlayers {
+			var who string
+			if signedUp == 0 {
+				who = "Nobody"
+			} else {
+				who = "Only " + numbered(signedUp, "player")
+			}
+			_, _ = sendMessage(s, currentCup.ChannelID, who+" signed up, cup aborted.")
+			currentCup.unpinAll(s)
+			deleteCup(s, m.ChannelID)
+			return
+		}
+
+		var token string
+		token, args = parseToken(args)
+		if len(token) != 0 {
 			count, err := strconv.Atoi(token)
 			if err != nil {
 				message := bold(escape(m.Author.Username)) + ", '" + token + "' doesn't look like a number, either leave it out or specify an actual number of players to keep.\n"
-				_, _ = s.ChannelMessageSend(m.ChannelID, message)
+				_, _ = sendMessage(s, m.ChannelID, message)
 				currentCup.reply(s, "", CupReportAll)
 				return
 			}
 			if count > signedUp {
 				message := bold(escape(m.Author.Username)) + ", " + token + " players haven't signed up yet.\n"
-				_, _ = s.ChannelMessageSend(m.ChannelID, message)
+				_, _ = sendMessage(s, m.ChannelID, message)
 				currentCup.reply(s, "", CupReportAll)
 				return
 			}
 			if count < minPlayers {
 				message := bold(escape(m.Author.Username)) + ", you need to keep at least " + strconv.Itoa(minPlayers) + " players.\n"
-				_, _ = s.ChannelMessageSend(m.ChannelID, message)
+				_, _ = sendMessage(s, m.ChannelID, message)
 				currentCup.reply(s, "", CupReportAll)
 				return
 			}
 			signedUp = count
 		}
 
-		numTeams := signedUp / currentCup.TeamSize
-
-		currentCup.Status = CupStatusPickup
-		currentCup.PickedPlayers = 0
-		currentCup.Teams = make([]Team, numTeams)
-		for i := 0; i < numTeams; i++ {
-			currentTeam := &currentCup.Teams[i]
-			currentTeam.resetTeam()
-		}
-		currentCup.chooseTeamNames()
-
-		message := fmt.Sprintf("Cup registration is now closed.\n\n")
-		currentCup.reply(s, message, CupReportAll)
+		currentCup.closeSignup(s, signedUp, "Cup registration is now closed.\n\n")
 
 	default:
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Too late, "+bold(escape(m.Author.Username))+", registration for this cup is already closed.")
+		_, _ = sendMessage(s, m.ChannelID, "Too late, "+bold(escape(m.Author.Username))+", registration for this cup is already closed.")
 	}
 }
 
 // Handle draft cup player picking
-func handlePick(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+func handlePick(args string, s DiscordSession, m *discordgo.MessageCreate) {
 	currentCup := getCup(m.ChannelID)
 	if currentCup == nil {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "No cup in progress in this channel. You can start one with "+bold(commandStart.syntax()))
+		_, _ = sendMessage(s, m.ChannelID, "No cup in progress in this channel. You can start one with "+bold(commandStart.syntax()))
 		return
 	}
 
 	switch currentCup.Status {
 	case CupStatusSignup:
 		message := bold(escape(m.Author.Username)) + ", we're not picking players yet.\n"
-		_, _ = s.ChannelMessageSend(m.ChannelID, message)
+		_, _ = sendMessage(s, m.ChannelID, message)
 		currentCup.reply(s, "", CupReportAll)
 		return
 
@@ -311,319 +943,2495 @@ func handlePick(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
 		who := currentCup.whoPicks(pickup)
 		numActive := currentCup.activePlayerCount()
 
-		if who == nil {
-			_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", it's not your turn to pick.\n")
-			currentCup.reply(s, "", CupReportAll^CupReportSubs)
-			return
-		}
+		if who == nil {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", it's not your turn to pick.\n")
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+
+		if who.ID != m.Author.ID {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", it's not your turn to pick, but "+currentCup.display(who)+"'s.\n")
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+
+		var token string
+		token, args = parseToken(args)
+		if len(token) == 0 {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a player number.")
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+		index, err := currentCup.parsePlayerNumber(token)
+		if err != nil {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+". You need to specify a player number.")
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+
+		if index >= numActive && index < len(currentCup.Players) {
+			sub := &currentCup.Players[index]
+			message := bold(escape(m.Author.Username)) + ", you can't pick " + currentCup.display(sub) + ", he's only registered as a substitute."
+			_, _ = sendMessage(s, m.ChannelID, message)
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+
+		selected := &currentCup.Players[index]
+		if selected.Team != -1 {
+			team := currentCup.Teams[selected.Team]
+			message := display(selected) + " already on team " + strconv.Itoa(selected.Team+1) + ", " + bold(team.coloredName())
+			_, _ = sendMessage(s, m.ChannelID, message)
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+
+		text, _ := currentCup.addPlayerToTeam(index, pickup.Team)
+
+		// Unless the manager wants it picked manually, the last player is automatically assigned to the remaining slot.
+		if currentCup.teamsReady() {
+			currentCup.removeLastReply(s)
+			deleteCommand(s, m)
+
+			currentCup.completeTeams(s, text)
+			return
+		}
+
+		currentCup.removeLastReply(s)
+		deleteCommand(s, m)
+		_, _ = sendMessage(s, currentCup.ChannelID, text)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+
+	default:
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", we're not picking players at this point.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+}
+
+// Handle draft cup unpick command
+func handleUnpick(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if currentCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", we're not picking players at this point.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can return picked players to the pool.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	if len(token) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a player number.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+	index, err := currentCup.parsePlayerNumber(token)
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+". You need to specify a player number.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	player := &currentCup.Players[index]
+	if player.Team == -1 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+currentCup.display(player)+" hasn't been picked yet.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	team := &currentCup.Teams[player.Team]
+	wasCaptain := team.First == index
+	teamDescription := currentCup.teamDescription(player.Team)
+
+	if wasCaptain && player.Next == -1 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+currentCup.display(player)+" is the only player on "+teamDescription+" and can't be returned to the pool.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	text := currentCup.display(player) + " was returned to the pool of available players by " + bold(escape(m.Author.Username)) + ".\n"
+	err = currentCup.removePlayerFromTeam(index)
+	if err != nil {
+		logError(logChannel(m.ChannelID), "Error removing player from team:", err)
+		return
+	}
+	if wasCaptain {
+		text += currentCup.display(&currentCup.Players[team.First]) + " is now the captain of " + teamDescription + ".\n"
+	}
+
+	currentCup.deleteAndReply(s, m, text, CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup replacecaptain command
+func handleReplaceCaptain(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if currentCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", captains can only be replaced while picking players.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can replace captains.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	var teamToken, playerToken string
+	teamToken, args = parseToken(args)
+	playerToken, args = parseToken(args)
+	if len(teamToken) == 0 || len(playerToken) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a team number and a player number, e.g. "+bold(commandReplaceCaptain.syntax()))
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	teamIndex, err := strconv.Atoi(teamToken)
+	teamIndex-- // 0-based
+	if err != nil || teamIndex < 0 || teamIndex >= len(currentCup.Teams) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+teamToken+"' is not a valid team number.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	playerIndex, err := strconv.Atoi(playerToken)
+	playerIndex-- // 0-based
+	if err != nil || playerIndex < 0 || playerIndex >= currentCup.activePlayerCount() || playerIndex >= len(currentCup.Players) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+playerToken+"' is not a valid player number.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	team := &currentCup.Teams[teamIndex]
+	player := &currentCup.Players[playerIndex]
+	teamDescription := currentCup.teamDescription(teamIndex)
+
+	if team.First == -1 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+teamDescription+" doesn't have a captain yet.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+	if team.First == playerIndex {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+currentCup.display(player)+" is already the captain of "+teamDescription+".")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+	if player.Team != -1 && player.Team != teamIndex {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+currentCup.display(player)+" plays for "+currentCup.teamDescription(player.Team)+".")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	oldCaptain := &currentCup.Players[team.First]
+	joined := player.Team == -1
+	err = currentCup.replaceCaptain(teamIndex, playerIndex)
+	if err != nil {
+		logError(logChannel(m.ChannelID), "Error replacing captain:", err)
+		return
+	}
+
+	text := bold(escape(m.Author.Username)) + " made " + mention(player) + " the captain of " + teamDescription
+	if joined {
+		text += ", replacing " + display(oldCaptain) + ", who was returned to the pool of available players.\n"
+	} else {
+		text += ", instead of " + display(oldCaptain) + ".\n"
+	}
+
+	currentCup.deleteAndReply(s, m, text, CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup promotion
+func handlePromote(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, "Cup can only be promoted when registration is open.")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	now := time.Now()
+	remaining := currentCup.nextPromoteTime(s, m.Author.ID).Sub(now)
+	if remaining > 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Too soon to promote, "+bold(escape(m.Author.Username))+". You can try again in "+humanize(remaining)+".")
+		return
+	}
+
+	currentCup.promote(s)
+}
+
+// Handle draft cup invite command
+func handleInvite(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+
+	if token == "channel" {
+		if !isAdmin(s, currentCup.GuildID, m.Author.ID) {
+			_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only admins can change where invites are posted.")
+			return
+		}
+
+		token, args = parseToken(args)
+		channelID := parseChannelMention(token)
+		if strings.EqualFold(token, "off") {
+			channelID = ""
+		} else if len(channelID) == 0 {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to mention a channel (e.g. #announcements), or use "+bold("off")+".")
+			return
+		} else if channel, err := s.StateChannel(channelID); err != nil || channel.GuildID != currentCup.GuildID {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+token+" is not a channel on this server.")
+			return
+		}
+
+		err := updateGuildConfig(currentCup.GuildID, func(config *GuildConfig) error {
+			config.InviteChannelID = channelID
+			return nil
+		})
+		if err != nil {
+			logError(logGuild(currentCup.GuildID), "Error saving guild settings:", err)
+		}
+
+		deleteCommand(s, m)
+		if len(channelID) == 0 {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" turned off invite cross-posting.")
+		} else {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" set the invite channel to "+mentionChannel(channelID)+".")
+		}
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, "Invites can only be posted when registration is open.")
+		return
+	}
+
+	everyone := token == "everyone"
+	if len(token) != 0 && !everyone {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid option. Type "+bold(commandInvite.syntax()))
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if everyone {
+		now := time.Now()
+		remaining := currentCup.nextPromoteTime(s, m.Author.ID).Sub(now)
+		if remaining > 0 {
+			_, _ = sendMessage(s, m.ChannelID, "Too soon to ping everyone, "+bold(escape(m.Author.Username))+". You can try again in "+humanize(remaining)+", or post the invite without pinging.")
+			return
+		}
+		currentCup.resetPromoteTimes(now)
+	}
+
+	targetID := getGuildConfig(currentCup.GuildID).InviteChannelID
+	if len(targetID) == 0 || targetID == currentCup.ChannelID {
+		_, _ = sendMessage(s, m.ChannelID, currentCup.inviteText(everyone))
+		return
+	}
+
+	_, err := sendMessage(s, targetID, currentCup.inviteText(everyone))
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the invite couldn't be posted in "+mentionChannel(targetID)+".")
+		return
+	}
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" posted an invite for this cup in "+mentionChannel(targetID)+".")
+}
+
+// Handle draft cup announce command
+func handleAnnounce(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can announce the cup in another channel.")
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, "The cup can only be announced when registration is open.")
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	targetID := parseChannelMention(token)
+	if len(targetID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to mention the channel to announce the cup in, e.g. "+bold(commandAnnounce.syntaxNoArgs()+" #general"))
+		return
+	}
+	if channel, err := s.StateChannel(targetID); err != nil || channel.GuildID != currentCup.GuildID {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+token+" is not a channel on this server.")
+		return
+	}
+	if targetID == currentCup.ChannelID {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the cup is already running in this channel. Use "+bold(commandInvite.syntaxNoArgs())+" instead.")
+		return
+	}
+
+	token, args = parseToken(args)
+	everyone := strings.EqualFold(token, "everyone")
+	if len(token) != 0 && !everyone {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid option. Type "+bold(commandAnnounce.syntax()))
+		return
+	}
+
+	required := discordgo.PermissionReadMessages | discordgo.PermissionSendMessages
+	if mention := announceMention(currentCup.GuildID); everyone && (mention == "@everyone" || mention == "@here") {
+		required |= discordgo.PermissionMentionEveryone
+	}
+	permissions, err := s.UserChannelPermissions(BotID, targetID)
+	if err != nil || permissions&required != required {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", I don't have permission to post that announcement in "+mentionChannel(targetID)+".")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if everyone {
+		now := time.Now()
+		remaining := currentCup.nextPromoteTime(s, m.Author.ID).Sub(now)
+		if remaining > 0 {
+			_, _ = sendMessage(s, m.ChannelID, "Too soon to ping everyone, "+bold(escape(m.Author.Username))+". You can try again in "+humanize(remaining)+", or post the announcement without pinging.")
+			return
+		}
+		currentCup.resetPromoteTimes(now)
+	}
+
+	_, err = sendMessage(s, targetID, currentCup.inviteText(everyone))
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the announcement couldn't be posted in "+mentionChannel(targetID)+".")
+		return
+	}
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" announced this cup in "+mentionChannel(targetID)+".")
+}
+
+// Handle draft cup time command
+func handleTime(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	deleteCommand(s, m)
+
+	now := time.Now()
+	var lines []string
+	if !currentCup.StartTime.IsZero() {
+		lines = append(lines, "Started "+humanize(now.Sub(currentCup.StartTime))+" ago")
+	}
+	if currentCup.Status == CupStatusSignup {
+		if remaining := currentCup.nextPromoteTime(s, m.Author.ID).Sub(now); remaining > 0 {
+			lines = append(lines, "You can promote the cup again in "+humanize(remaining))
+		} else {
+			lines = append(lines, "You can promote the cup now")
+		}
+		if cupOptions.staleTimeout > 0 {
+			lines = append(lines, "Aborted automatically in "+humanize(currentCup.abortTime().Sub(now))+", unless someone signs up or leaves")
+		}
+		if currentCup.AutoClose > 0 {
+			lines = append(lines, "Registration closes once "+numbered(currentCup.AutoClose, "player")+" sign up")
+		}
+	}
+	if !currentCup.ReminderTime.IsZero() {
+		lines = append(lines, "Next reminder due in "+humanize(currentCup.ReminderTime.Sub(now)))
+	}
+
+	message := bold(escape(m.Author.Username)) + ", here's the schedule for this cup:\n"
+	for _, line := range lines {
+		message += "- " + line + ".\n"
+	}
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
+
+// Handle draft cup describe command
+func handleDescribe(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change the cup description.")
+		return
+	}
+
+	description, err := parseDescription(args)
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+".")
+		return
+	}
+	currentCup.Description = description
+
+	// Keep the pinned registration message up to date (editing doesn't ping anyone again)
+	if currentCup.Status == CupStatusSignup && len(currentCup.StartMessageID) > 0 {
+		_, err := s.ChannelMessageEdit(currentCup.ChannelID, currentCup.StartMessageID, currentCup.announcement(currentCup.StartExtra))
+		if err != nil {
+			logWarn(logChannel(currentCup.ChannelID), "Error updating registration message:", err)
+		}
+	}
+
+	var text string
+	if len(currentCup.Description) == 0 {
+		text = bold(escape(m.Author.Username)) + " removed the cup description.\n"
+	} else {
+		text = bold(escape(m.Author.Username)) + " changed the cup description.\n\n"
+	}
+	currentCup.deleteAndReply(s, m, text, CupReportAll)
+}
+
+// Handle draft cup reminder command
+func handleRemind(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	deleteCommand(s, m)
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+	if len(token) == 0 {
+		var message string
+		if currentCup.ReminderTime.IsZero() {
+			message = bold(escape(m.Author.Username)) + ", there's no reminder scheduled for this cup."
+		} else {
+			message = bold(escape(m.Author.Username)) + ", the next reminder for this cup is due in " + humanize(time.Until(currentCup.ReminderTime)) + "."
+		}
+		_, _ = sendMessage(s, m.ChannelID, message)
+		return
+	}
+
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can schedule reminders.")
+		return
+	}
+
+	if token == "cancel" {
+		if currentCup.ReminderTime.IsZero() {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no reminder to cancel.")
+			return
+		}
+		currentCup.ReminderTime = time.Time{}
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" cancelled the scheduled reminder.")
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", reminders can only be scheduled when registration is open.")
+		return
+	}
+
+	delay, err := parseDuration(token)
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+" (or **cancel** to cancel the scheduled reminder).")
+		return
+	}
+	if delay <= 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the reminder needs to be scheduled in the future.")
+		return
+	}
+
+	currentCup.ReminderTime = time.Now().Add(delay)
+	currentCup.scheduleReminder(s)
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" scheduled a reminder for this cup in "+humanize(delay)+".")
+}
+
+// Handle draft cup extend command
+func handleExtend(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if cupOptions.staleTimeout <= 0 || currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", this cup won't be aborted automatically, so there's nothing to extend.")
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	if len(token) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", unless someone signs up or leaves, this cup will be aborted automatically in "+humanize(time.Until(currentCup.abortTime()))+".")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can extend the cup.")
+		return
+	}
+
+	extension, err := parseDuration(token)
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+".")
+		return
+	}
+	if extension <= 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the cup can only be extended by a positive amount of time.")
+		return
+	}
+
+	// Keep the total in check, so repeated extensions can't push the abort time out indefinitely
+	if currentCup.AbortExtension+extension > MaxDuration {
+		extension = MaxDuration - currentCup.AbortExtension
+		if extension <= 0 {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the cup can't be extended any further, the limit is "+humanize(MaxDuration)+" until someone signs up or leaves.")
+			return
+		}
+	}
+	currentCup.AbortExtension += extension
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" extended the cup by "+humanize(extension)+". Unless someone signs up or leaves, it will be aborted automatically in "+humanize(time.Until(currentCup.abortTime()))+".")
+}
+
+// Handle draft cup forfeit command
+func handleForfeit(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup != nil && currentCup.Status != CupStatusReady {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the teams for this cup aren't complete yet.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+	if currentCup == nil {
+		currentCup = getFinishedCup(m.ChannelID)
+	}
+	if currentCup == nil || len(currentCup.Teams) < 2 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no teams playing in this channel.")
+		return
+	}
+
+	if currentCup.Winner != 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the result of this cup was already recorded: "+currentCup.teamDescription(currentCup.Winner-1)+" won.")
+		return
+	}
+
+	captainOf := -1
+	if index := currentCup.findPlayer(m.Author.ID); index != -1 {
+		team := currentCup.Players[index].Team
+		if team >= 0 && team < len(currentCup.Teams) && currentCup.Teams[team].First == index {
+			captainOf = team
+		}
+	}
+	if captainOf == -1 && !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only team captains, "+display(&currentCup.Manager)+" (the cup manager) or an admin can forfeit.")
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	winner := -1
+	if len(token) == 0 {
+		if captainOf == -1 || len(currentCup.Teams) != 2 {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify the number of the winning team.")
+			return
+		}
+		winner = 1 - captainOf
+	} else {
+		number, err := strconv.Atoi(token)
+		if err != nil || number < 1 || number > len(currentCup.Teams) {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid team number.")
+			return
+		}
+		winner = number - 1
+	}
+
+	if winner == captainOf {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can't forfeit in favor of your own team.")
+		return
+	}
+
+	forfeited := captainOf
+	if forfeited == -1 && len(currentCup.Teams) == 2 {
+		forfeited = 1 - winner
+	}
+
+	deleteCommand(s, m)
+	currentCup.recordForfeit(forfeited, winner)
+	if err := currentCup.recordStats(); err != nil {
+		logError(logGuild(currentCup.GuildID), "Error saving player statistics:", err)
+	}
+	currentCup.deleteVoiceChannels(s)
+
+	var text string
+	if forfeited != -1 {
+		text = bold(escape(m.Author.Username)) + " forfeited on behalf of " + currentCup.teamDescription(forfeited) + ", so " + currentCup.teamDescription(winner) + " wins the cup!"
+	} else {
+		text = bold(escape(m.Author.Username)) + " declared " + currentCup.teamDescription(winner) + " the winner of the cup."
+	}
+	_, _ = sendMessage(s, m.ChannelID, text)
+
+	if currentCup.Status == CupStatusReady && getCup(m.ChannelID) == currentCup {
+		currentCup.removeLastReply(s)
+		finishCup(s, m.ChannelID)
+	}
+}
+
+// Returns the cup whose teams are playing in the given channel, if any
+func getPlayingCup(channelID string) *Cup {
+	currentCup := getCup(channelID)
+	if currentCup != nil && currentCup.Status != CupStatusInactive {
+		if currentCup.Status != CupStatusReady {
+			return nil
+		}
+	} else {
+		// Cups completed by picking keep their status once finished
+		currentCup = getFinishedCup(channelID)
+	}
+	if currentCup == nil || len(currentCup.Teams) == 0 {
+		return nil
+	}
+	return currentCup
+}
+
+// Returns the cup in the given channel whose teams are being picked or are complete, if any
+func getTeamsCup(channelID string) *Cup {
+	currentCup := getCup(channelID)
+	if currentCup != nil && (currentCup.Status == CupStatusPickup || currentCup.Status == CupStatusReady) {
+		return currentCup
+	}
+	return getFinishedCup(channelID)
+}
+
+// Handle draft cup mentionteam command
+func handleMentionTeam(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getTeamsCup(m.ChannelID)
+	if currentCup == nil || len(currentCup.Teams) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no teams in this channel.")
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	number, err := strconv.Atoi(token)
+	if err != nil || number < 1 || number > len(currentCup.Teams) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a team number between 1 and "+strconv.Itoa(len(currentCup.Teams))+
+			", e.g. "+bold(commandMentionTeam.example("1")))
+		return
+	}
+	index := number - 1
+
+	team := &currentCup.Teams[index]
+	captain := team.First >= 0 && currentCup.Players[team.First].ID == m.Author.ID
+	if !captain && !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only the captain of "+currentCup.teamDescription(index)+" or "+display(&currentCup.Manager)+", the cup manager, can call the team.")
+		return
+	}
+
+	if team.First == -1 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+currentCup.teamDescription(index)+" doesn't have any players yet.")
+		return
+	}
+
+	var mentions []string
+	for playerIndex := team.First; playerIndex != -1; playerIndex = currentCup.Players[playerIndex].Next {
+		mentions = append(mentions, mention(&currentCup.Players[playerIndex]))
+	}
+	deleteCommand(s, m)
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" is calling "+currentCup.teamDescription(index)+": "+strings.Join(mentions, " "))
+}
+
+// Handle draft cup rerandomize command
+func handleRerandomize(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getTeamsCup(m.ChannelID)
+	if currentCup == nil || len(currentCup.Teams) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no teams in this channel.")
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	number, err := strconv.Atoi(token)
+	if err != nil || number < 1 || number > len(currentCup.Teams) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a team number between 1 and "+strconv.Itoa(len(currentCup.Teams))+
+			", e.g. "+bold(commandRerandomize.example("1")))
+		return
+	}
+	index := number - 1
+
+	team := &currentCup.Teams[index]
+	captain := team.First >= 0 && currentCup.Players[team.First].ID == m.Author.ID
+	if !captain && !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only the captain of "+currentCup.teamDescription(index)+" or "+display(&currentCup.Manager)+", the cup manager, can rename the team.")
+		return
+	}
+
+	before := team.coloredName()
+	currentCup.rerollTeamName(index)
+
+	text := bold(escape(m.Author.Username)) + " renamed team " + strconv.Itoa(number) + " from " + bold(before) + " to " + bold(team.coloredName()) + ".\n\n"
+	currentCup.deleteAndReply(s, m, text, CupReportAll)
+}
+
+// Handle draft cup mentionall command
+func handleMentionAll(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getTeamsCup(m.ChannelID)
+	if currentCup == nil || len(currentCup.Teams) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no teams in this channel yet.")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can mention all players.")
+		return
+	}
+
+	if wait := MentionAllCooldown - time.Since(currentCup.lastMentionAll); wait > 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", all players were mentioned recently. You can do it again in "+humanize(wait)+".")
+		return
+	}
+
+	active := currentCup.activePlayerCount()
+	if active > len(currentCup.Players) {
+		active = len(currentCup.Players)
+	}
+	mentions := make([]string, 0, active)
+	for i := 0; i < active; i++ {
+		if player := &currentCup.Players[i]; !player.isPlaceholder() {
+			mentions = append(mentions, mention(player))
+		}
+	}
+	if len(mentions) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no players to mention.")
+		return
+	}
+
+	currentCup.lastMentionAll = time.Now()
+	deleteCommand(s, m)
+	header := bold(escape(m.Author.Username)) + " is calling all players:\n"
+	for i, chunk := range joinChunks(mentions, " ", MaxMessageLength-len(header)) {
+		if i == 0 {
+			chunk = header + chunk
+		}
+		if _, err := sendMessage(s, m.ChannelID, chunk); err != nil {
+			return
+		}
+	}
+}
+
+// Handle draft cup skip command
+func handleSkip(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if currentCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", picks can only be skipped while picking teams.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can skip a pick.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	skipped := currentCup.currentPickup()
+	if err := currentCup.skipPick(); err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the pick can't be skipped: "+err.Error()+".")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	message := bold(escape(m.Author.Username)) + " skipped the pick of " + currentCup.teamDescription(skipped.Team) +
+		", who will make it once the other teams are done.\n\n"
+	currentCup.deleteAndReply(s, m, message, CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup pass command
+func handlePass(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if currentCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only pass while picking teams.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	passed := currentCup.currentPickup()
+	who := currentCup.whoPicks(passed)
+	if who == nil || who.ID != m.Author.ID {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", it's not your turn to pick.\n")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if err := currentCup.passPick(); err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can't pass: "+err.Error()+".")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	message := bold(escape(m.Author.Username)) + " passed, so " + currentCup.teamDescription(passed.Team) +
+		" will make this pick at the end of the round.\n\n"
+	currentCup.deleteAndReply(s, m, message, CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup passes command
+func handlePasses(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can allow or forbid passing.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only change whether captains may pass during sign-up.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	allow := !currentCup.AllowPasses
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+
+	if len(token) > 0 {
+		if token == "on" {
+			allow = true
+		} else if token == "off" {
+			allow = false
+		} else {
+			message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid option. You need to specify either **on** or **off** after " + bold(commandPasses.syntaxNoArgs())
+			_, _ = sendMessage(s, m.ChannelID, message)
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+	}
+
+	currentCup.AllowPasses = allow
+	if allow {
+		_, _ = sendMessage(s, m.ChannelID, "Captains can now pass once per round with "+bold(commandPass.syntax())+", making their pick at the end of the round.")
+	} else {
+		_, _ = sendMessage(s, m.ChannelID, "Passing is now disabled.")
+	}
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup bestof command
+func handleBestOf(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		currentCup = getPlayingCup(m.ChannelID)
+		if currentCup != nil && len(currentCup.Teams) < 2 {
+			currentCup = nil
+		}
+	}
+	if currentCup == nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in this channel.")
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	if len(token) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the teams play a series of up to "+numbered(currentCup.seriesLength(), "game")+".")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change the length of the series.")
+		return
+	}
+
+	if currentCup.Winner != 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the result of this cup was already recorded: "+currentCup.teamDescription(currentCup.Winner-1)+" won.")
+		return
+	}
+
+	games, err := strconv.Atoi(token)
+	if err != nil || games < 1 || games > MaxBestOf || games%2 == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the series length needs to be an odd number between 1 and "+strconv.Itoa(MaxBestOf)+".")
+		return
+	}
+	if currentCup.seriesLead() > games/2 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", a team has already won more than "+numbered(games/2, "game")+" in this series.")
+		return
+	}
+
+	deleteCommand(s, m)
+	currentCup.BestOf = games
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" set the series length: the first team to win "+numbered(games/2+1, "game")+" wins the cup.")
+}
+
+// Handle draft cup game command
+func handleGame(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getPlayingCup(m.ChannelID)
+	if currentCup == nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no teams playing in this channel.")
+		return
+	}
+	if len(currentCup.Teams) < 2 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", this cup has a single team, so there are no games to record.")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can record game results.")
+		return
+	}
+
+	if currentCup.Winner != 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the result of this cup was already recorded: "+currentCup.teamDescription(currentCup.Winner-1)+" won.")
+		return
+	}
+
+	var token string
+	token, args = parseToken(args)
+	number, err := strconv.Atoi(token)
+	if err != nil || number < 1 || number > len(currentCup.Teams) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify the number of the team that won the game after "+bold(commandGame.syntaxNoArgs()))
+		return
+	}
+
+	deleteCommand(s, m)
+	winner := number - 1
+	decided := currentCup.recordGame(winner)
+	if decided {
+		if err := currentCup.recordStats(); err != nil {
+			logError(logGuild(currentCup.GuildID), "Error saving player statistics:", err)
+		}
+		currentCup.deleteVoiceChannels(s)
+	}
+
+	text := bold(escape(m.Author.Username)) + " recorded a win for " + currentCup.teamDescription(winner) + ".\nSeries score: " + currentCup.seriesDescription()
+	if decided {
+		text += "\n\n" + currentCup.teamDescription(winner) + " wins the cup!"
+	}
+	_, _ = sendMessage(s, m.ChannelID, text)
+
+	if decided && getCup(m.ChannelID) == currentCup {
+		currentCup.removeLastReply(s)
+		finishCup(s, m.ChannelID)
+	}
+}
+
+// Handle draft cup player list info command
+func handleWho(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		message := noCupHereMessage(s, m)
+		pinned, _ := lastPinned(s, m.ChannelID)
+		if pinned != nil {
+			// Apparently, ContentWithMentionsReplaced *doesn't* replace @everyone, @here or roles...
+			previous := defuseMentions(pinned.ContentWithMentionsReplaced())
+
+			message += "\n\n__***Last pinned cup message"
+			when, err := pinned.Timestamp.Parse()
+			if err == nil {
+				delta := time.Now().Sub(when)
+				// Only mention elapsed time if it's in the past...
+				if delta > 0 {
+					message += " (from " + humanize(delta) + " ago)"
+				}
+			}
+			message += ":***__\n\n" + previous
+		}
+		_, _ = sendMessage(s, m.ChannelID, message)
+		return
+	}
+	currentCup.refreshReply(s, m, CupReportAll)
+
+	if devHacks.saveOnWho {
+		currentCup.save()
+	}
+}
+
+// Handle draft cup count command
+func handleCount(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	_, _ = sendMessage(s, m.ChannelID, currentCup.headcount())
+}
+
+// Handle draft cup personal status command
+func handleMe(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	deleteCommand(s, m)
+
+	message := bold(escape(m.Author.Username)) + ", "
+	index := currentCup.findPlayer(m.Author.ID)
+	if index == -1 {
+		if currentCup.isManager(m.Author.ID) {
+			message += "you're managing this cup, but not playing in it."
+		} else {
+			message += "you're not registered for this cup."
+		}
+		if currentCup.Status == CupStatusSignup || currentCup.Status == CupStatusPickup {
+			message += " You can sign up by typing " + bold(commandAdd.syntaxNoArgs())
+		}
+		_, _ = sendMessage(s, m.ChannelID, message)
+		return
+	}
+
+	player := &currentCup.Players[index]
+	message += "you're player " + bold(strconv.Itoa(index+1)) + " of " + strconv.Itoa(len(currentCup.Players))
+
+	switch {
+	case currentCup.Status == CupStatusSignup:
+		message += ", waiting for sign-up to close."
+
+	case index >= currentCup.activePlayerCount():
+		message += ", registered as the " + nth(index-currentCup.activePlayerCount()+1) + " substitute."
+
+	case player.Team == -1:
+		message += ", waiting to be picked."
+
+	default:
+		team := &currentCup.Teams[player.Team]
+		message += ", playing for team " + strconv.Itoa(player.Team+1) + ", " + bold(team.coloredName())
+		if team.First == index {
+			message += " (as captain)"
+		}
+		message += "."
+	}
+
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
+
+// Handle draft cup moderation toggle command
+func handleModerate(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", moderation can only be enabled when a cup is active.\n")
+		return
+	}
+
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can enable or disable moderation.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	// Without arguments, toggle between full moderation and none
+	moderation := ModerationOff
+	if currentCup.Moderation == ModerationOff {
+		moderation = ModerationAll
+	}
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+
+	if len(token) > 0 {
+		moderation = parseModeration(token)
+		if moderation == -1 {
+			message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid option. You need to specify either **on**, **off**, **pickup** or **others** after " + bold(commandModerate.syntaxNoArgs())
+			_, _ = sendMessage(s, m.ChannelID, message)
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+	}
+
+	if moderation == currentCup.Moderation {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+currentCup.moderationDescription()+" already.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.Moderation = moderation
+	deleteCommand(s, m)
+	_, _ = sendMessage(s, currentCup.ChannelID, "Moderation changed: "+currentCup.moderationDescription()+".")
+}
+
+// Handle draft cup pin command
+func handlePin(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can pin the cup report.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	deleteCommand(s, m)
+	if len(currentCup.LastReplyID) == 0 {
+		currentCup.reply(s, "", CupReportAll)
+	}
+	if len(currentCup.LastReplyID) > 0 && pinMessage(s, currentCup.ChannelID, currentCup.LastReplyID) == nil {
+		// Leave the pinned report alone, so the next reply doesn't delete it
+		currentCup.LastReplyID = ""
+	}
+}
+
+// Handle draft cup unpin command
+func handleUnpin(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can unpin the cup messages.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	currentCup.unpinAll(s)
+	currentCup.deleteAndReply(s, m, bold(escape(m.Author.Username))+" unpinned the cup messages.\n\n", CupReportAll)
+}
+
+// Handle draft cup freeze command
+func handleFreeze(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can freeze the cup report.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	deleteCommand(s, m)
+
+	// Sent as a standalone message, not tracked as the last reply, so later updates don't delete it
+	text := "Snapshot by " + bold(escape(m.Author.Username)) + ", " + time.Now().UTC().Format("2006-01-02 15:04") + " UTC:\n" +
+		currentCup.report(CupReportTeams|CupReportSubs)
+	message, err := sendMessage(s, currentCup.ChannelID, text)
+	if err != nil || message == nil {
+		return
+	}
+	if pinMessage(s, currentCup.ChannelID, message.ID) == nil {
+		currentCup.FrozenMessageIDs = append(currentCup.FrozenMessageIDs, message.ID)
+	}
+}
+
+// Handle draft cup summary command
+func handleSummary(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getTeamsCup(m.ChannelID)
+	if currentCup == nil || len(currentCup.Teams) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no teams in this channel to summarize.")
+		return
+	}
+
+	if !currentCup.teamsReady() {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the teams aren't complete yet, so there's nothing to summarize.")
+		return
+	}
+
+	deleteCommand(s, m)
+	_, _ = sendMessage(s, m.ChannelID, currentCup.summary())
+}
+
+// Handle draft cup shuffleplayers command
+func handleShufflePlayers(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can shuffle the players.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if currentCup.Status != CupStatusPickup || currentCup.PickedPlayers > 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only shuffle the players after closing sign-up, before the first pick.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.shufflePlayers()
+	currentCup.reply(s, bold(escape(m.Author.Username))+" shuffled the players, so their numbers have changed.\n\n", CupReportAll)
+}
+
+// Handle draft reopen command
+func handleReopen(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if currentCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the cup can be only reopen for sign-up after picking has begun.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can discard current teams and reopen the cup for sign-up.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.Teams = nil
+	for i := range currentCup.Players {
+		player := &currentCup.Players[i]
+		player.resetTeam()
+	}
+	currentCup.Status = CupStatusSignup
+	currentCup.PickedPlayers = 0
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" discarded the teams and reopened the cup.")
+	currentCup.reply(s, "", CupReportAll)
+}
+
+// Handle draft cup reset command
+func handleReset(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if currentCup.Status != CupStatusPickup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", picks can only be reset while picking teams.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can reset the picks.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.clearPicks()
+	currentCup.deleteVoiceChannels(s)
+	message := bold(escape(m.Author.Username)) + " reset the picks, so picking starts over with the same teams and players.\n\n"
+
+	// Captains that were assigned automatically when sign-up closed stay in place
+	if currentCup.AutoCaptains {
+		for i := range currentCup.Teams {
+			join, _ := currentCup.addPlayerToTeam(i, i)
+			message += join
+		}
+		message += "\n"
+	}
+
+	currentCup.reply(s, message, CupReportAll)
+}
+
+// Handle draft cup teamsize command
+func handleTeamSize(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	var token string
+	token, args = parseToken(args)
+	if len(token) <= 0 {
+		message := bold(escape(m.Author.Username)) + ", team size is " + bold(strconv.Itoa(currentCup.TeamSize)) + ".\n"
+		if history := currentCup.teamSizeHistory(); len(history) > 0 {
+			message += "Changes made during the cup:\n```\n" + history + "```\n"
+		}
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change team size.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only change team size during sign-up.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	newSize, err := strconv.Atoi(token)
+	if err != nil {
+		message := bold(escape(m.Author.Username)) + ", '" + token + "' doesn't look like a number.\n\n"
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if newSize <= 0 {
+		message := bold(escape(m.Author.Username)) + ", " + token + " is not a valid team size."
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if newSize == currentCup.TeamSize {
+		message := bold(escape(m.Author.Username)) + ", team size is already " + token + "."
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	activeBefore := currentCup.signupActiveCount()
+	currentCup.recordTeamSizeChange(m.Author, newSize)
+
+	message := bold(escape(m.Author.Username)) + " has changed team size to " + bold(token) + "."
+	if len(currentCup.Players) > 0 {
+		message += "\n" + currentCup.teamSizeChangeSummary(activeBefore)
+	}
+	if currentCup.CompensationPick && newSize < 4 {
+		currentCup.CompensationPick = false
+		message += "\nThe compensation pick needs teams of at least 4 players, so it was disabled."
+	}
+	_, _ = sendMessage(s, m.ChannelID, message)
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup captains command
+func handleCaptains(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+	if len(token) <= 0 {
+		message := bold(escape(m.Author.Username)) + ", " + currentCup.captainModeDescription() + ".\n"
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change how captains are chosen.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only change how captains are chosen during sign-up.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	// On and off are accepted as well, for the captainsfirst alias
+	var autoCaptains bool
+	if token == "manager" || token == "off" {
+		autoCaptains = false
+	} else if token == "auto" || token == "on" {
+		autoCaptains = true
+	} else {
+		message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid option. You need to specify either " + bold("manager") + " or " + bold("auto") + " after " + bold(commandCaptains.syntaxNoArgs())
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if autoCaptains == currentCup.AutoCaptains {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+currentCup.captainModeDescription()+" already.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.AutoCaptains = autoCaptains
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" has changed how captains are chosen: "+currentCup.captainModeDescription()+".")
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup autoclose command
+func handleAutoClose(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+	if len(token) == 0 {
+		var message string
+		if currentCup.AutoClose > 0 {
+			message = bold(escape(m.Author.Username)) + ", registration closes automatically once " + numbered(currentCup.AutoClose, "player") + " sign up."
+		} else {
+			message = bold(escape(m.Author.Username)) + ", registration is closed manually by the cup manager."
+		}
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change when registration closes.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", registration is already closed.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if token == "off" {
+		currentCup.AutoClose = 0
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" turned off closing registration automatically.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	count, err := strconv.Atoi(token)
+	if err != nil {
+		message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid option. You need to specify either a number of players or " + bold("off") + " after " + bold(commandAutoClose.syntaxNoArgs())
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	minPlayers := currentCup.minPlayerCount()
+	if count < minPlayers || count%currentCup.TeamSize != 0 {
+		message := bold(escape(m.Author.Username)) + ", the number of players needs to be a multiple of the team size (" + strconv.Itoa(currentCup.TeamSize) + "), and at least " + strconv.Itoa(minPlayers) + "."
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if len(currentCup.Players) >= count {
+		message := bold(escape(m.Author.Username)) + ", " + numbered(len(currentCup.Players), "player") + " already signed up. You can close registration now by typing " + bold(commandClose.syntax())
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.AutoClose = count
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" set registration to close automatically once "+numbered(count, "player")+" sign up.")
+	currentCup.reply(s, "", CupReportAll)
+}
+
+// Handle draft cup compensation pick toggle command
+func handleCompensation(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can enable or disable the compensation pick.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only change the compensation pick during sign-up.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	compensation := !currentCup.CompensationPick
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+
+	if len(token) > 0 {
+		if token == "on" {
+			compensation = true
+		} else if token == "off" {
+			compensation = false
+		} else {
+			message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid option. You need to specify either **on** or **off** after " + bold(commandCompensation.syntaxNoArgs())
+			_, _ = sendMessage(s, m.ChannelID, message)
+			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+			return
+		}
+	}
+
+	if compensation && currentCup.TeamSize < 4 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the compensation pick needs teams of at least 4 players.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.CompensationPick = compensation
+	if compensation {
+		_, _ = sendMessage(s, m.ChannelID, "The team picking last in the first round will now get an extra pick early in the second round, as long as there are at least 3 teams.")
+	} else {
+		_, _ = sendMessage(s, m.ChannelID, "The compensation pick is now disabled.")
+	}
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup lastpick command
+func handleLastPick(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+	if len(token) == 0 {
+		message := "the last player is assigned to the remaining slot automatically."
+		if currentCup.ManualLastPick {
+			message = "the last player is picked manually, like the others."
+		}
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change how the last player is picked.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only change how the last player is picked during sign-up.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	switch token {
+	case "auto":
+		currentCup.ManualLastPick = false
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" changed the last pick: the last player will be assigned to the remaining slot automatically.")
+	case "manual":
+		currentCup.ManualLastPick = true
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" changed the last pick: the last player will be picked manually, like the others.")
+	default:
+		message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid option. You need to specify either **auto** or **manual** after " + bold(commandLastPick.syntaxNoArgs())
+		_, _ = sendMessage(s, m.ChannelID, message)
+	}
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup captainpick command
+func handleCaptainPick(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	var token string
+	token, args = parseToken(args)
+	if len(token) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+currentCup.captainOrderDescription()+".")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change the order in which captains are picked.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only change the captain order during sign-up.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	mode := parseCaptainOrder(token)
+	if mode == -1 {
+		message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid option. You need to specify one of " + strings.Join(captainOrderNames[:], ", ") + " after " + bold(commandCaptainPick.syntaxNoArgs())
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.CaptainOrder = mode
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" has changed the captain order: "+currentCup.captainOrderDescription()+".")
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup maxsubs command
+func handleMaxSubs(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+	if len(token) <= 0 {
+		var message string
+		if currentCup.LimitSubs {
+			message = bold(escape(m.Author.Username)) + ", the maximum number of substitutes is " + bold(strconv.Itoa(currentCup.MaxSubs)) + ".\n"
+		} else {
+			message = bold(escape(m.Author.Username)) + ", there's no limit on the number of substitutes.\n"
+		}
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change the maximum number of substitutes.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	if token == "off" {
+		currentCup.LimitSubs = false
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" removed the limit on the number of substitutes.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	newMax, err := strconv.Atoi(token)
+	if err != nil || newMax < 0 {
+		message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid number of substitutes. You need to specify a number, or **off** to remove the limit."
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
+
+	currentCup.LimitSubs = true
+	currentCup.MaxSubs = newMax
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" has changed the maximum number of substitutes to "+bold(token)+".")
+	currentCup.reply(s, "", CupReportAll)
+}
+
+// Handle draft cup minteams command
+func handleMinTeams(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
+
+	deleteCommand(s, m)
+
+	var token string
+	token, args = parseToken(args)
+	if len(token) <= 0 {
+		message := bold(escape(m.Author.Username)) + ", the minimum number of teams is " + bold(strconv.Itoa(currentCup.MinimumTeams)) + ".\n"
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change the minimum number of teams.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if currentCup.Status != CupStatusSignup {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you can only change the minimum number of teams during sign-up.")
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	newCount, err := strconv.Atoi(token)
+	if err != nil {
+		message := bold(escape(m.Author.Username)) + ", '" + token + "' doesn't look like a number.\n\n"
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if newCount < lowestMinimumTeams() {
+		message := bold(escape(m.Author.Username)) + ", the minimum number of teams can't be lower than " + strconv.Itoa(lowestMinimumTeams()) + "."
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	if newCount == currentCup.MinimumTeams {
+		message := bold(escape(m.Author.Username)) + ", the minimum number of teams is already " + token + "."
+		_, _ = sendMessage(s, m.ChannelID, message)
+		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		return
+	}
+
+	currentCup.MinimumTeams = newCount
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" has changed the minimum number of teams to "+bold(token)+".")
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup search command
+func handleSearch(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	text := strings.TrimSpace(args)
+	if len(text) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify part of a player name after "+bold(commandSearch.syntaxNoArgs()))
+		return
+	}
+
+	var matches []int
+	lowerText := strings.ToLower(text)
+	for i := range currentCup.Players {
+		if strings.Contains(strings.ToLower(currentCup.Players[i].Name), lowerText) {
+			matches = append(matches, i)
+		}
+	}
+
+	if len(matches) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", no player name in this cup contains '"+escape(text)+"'.")
+		return
+	}
+
+	active := currentCup.activePlayerCount()
+	message := numbered(len(matches), "player") + " matching '" + escape(text) + "':\n"
+	for _, index := range matches {
+		player := &currentCup.Players[index]
+		message += strconv.Itoa(index+1) + ". " + currentCup.display(player)
+		switch {
+		case player.Team >= 0 && player.Team < len(currentCup.Teams):
+			message += " (" + currentCup.teamDescription(player.Team) + ")"
+		case currentCup.Status != CupStatusSignup && index >= active:
+			message += " (substitute)"
+		}
+		message += "\n"
+	}
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
+
+// Handle draft cup roll command
+func handleRoll(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	var token string
+	token, args = parseToken(args)
+	if len(token) > 0 {
+		count, err := strconv.Atoi(token)
+		if err != nil || count <= 0 {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid number to roll.")
+			return
+		}
+		result := rand.Intn(count) + 1
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" rolled "+bold(strconv.Itoa(result))+" (1-"+token+").")
+		return
+	}
+
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel, so you need to specify a number to roll.")
+		return
+	}
+
+	count := len(currentCup.Players)
+	if currentCup.Status != CupStatusSignup && currentCup.activePlayerCount() < count {
+		count = currentCup.activePlayerCount()
+	}
+	if count == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no players to choose from yet.")
+		return
+	}
+
+	index := rand.Intn(count)
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" rolled player "+strconv.Itoa(index+1)+": "+currentCup.display(&currentCup.Players[index])+".")
+}
+
+// Handle draft cup log command
+func handleLog(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		currentCup = getFinishedCup(m.ChannelID)
+	}
+	if currentCup == nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in this channel to show the log for.")
+		return
+	}
+
+	if !currentCup.isSuperUser(s, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can view the cup log.")
+		return
+	}
+
+	// Backticks in names or commands could end the code block early
+	defuse := strings.NewReplacer("`", "'")
+	message := "Last " + numbered(len(currentCup.Log), "command") + " issued during the cup:\n```\n"
+	for _, entry := range currentCup.Log {
+		message += entry.Time.UTC().Format("2006-01-02 15:04:05") + " " + defuse.Replace(entry.UserName) + ": " + defuse.Replace(strings.TrimSpace(entry.Command)) + "\n"
+	}
+	message += "```\n"
+
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
+
+// Handle draft permissions check command
+func handlePerms(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	permissions, err := s.UserChannelPermissions(BotID, m.ChannelID)
+	if err != nil {
+		logError(logChannel(m.ChannelID), "Error retrieving channel permissions:", err)
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", I couldn't check my permissions in this channel.")
+		return
+	}
+
+	requiredPermissions := [...]struct {
+		Permission int
+		Name       string
+		Reason     string
+	}{
+		{discordgo.PermissionReadMessages, "Read messages", "to see commands"},
+		{discordgo.PermissionSendMessages, "Send messages", "to reply to commands"},
+		{discordgo.PermissionManageMessages, "Manage messages", "to delete commands and pin cup announcements"},
+		{discordgo.PermissionReadMessageHistory, "Read message history", "to find pinned cup messages"},
+		{discordgo.PermissionMentionEveryone, "Mention everyone", "to announce new cups"},
+	}
+
+	missing := ""
+	for _, required := range requiredPermissions {
+		if permissions&required.Permission != required.Permission {
+			missing += "- " + bold(required.Name) + ", " + required.Reason + "\n"
+		}
+	}
+
+	if len(missing) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", I have all the permissions I need in this channel.")
+		return
+	}
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", I'm missing the following permissions in this channel:\n"+missing)
+}
+
+// Handle draft cup balance report command
+func handleBalanceReport(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
+	}
+
+	if currentCup.Status != CupStatusPickup && currentCup.Status != CupStatusReady {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there are no teams to compare yet.")
+		return
+	}
 
-		if who.ID != m.Author.ID {
-			_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", it's not your turn to pick, but "+display(who)+"'s.\n")
-			currentCup.reply(s, "", CupReportAll^CupReportSubs)
-			return
+	message := "Team ratings:\n```\n"
+	lowest, highest := 0, 0
+	for i := range currentCup.Teams {
+		total, count := currentCup.teamRating(i)
+		average := 0
+		if count > 0 {
+			average = total / count
+		}
+		if i == 0 || average < lowest {
+			lowest = average
 		}
+		if i == 0 || average > highest {
+			highest = average
+		}
+		teamDescription := strconv.Itoa(i+1) + ". " + currentCup.Teams[i].coloredName()
+		message += fmt.Sprintf("%*s : total %d, average %d (%s)\n", -currentCup.longestTeamDescription, teamDescription, total, average, numbered(count, "player"))
+	}
+	message += "```\n"
+	if len(currentCup.Teams) > 1 {
+		message += "Spread between the highest and lowest average rating: " + bold(strconv.Itoa(highest-lowest)) + "\n"
+	}
+
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
 
+// Number of players shown by the topplayers command
+const (
+	DefaultLeaderboardSize = 10
+	MaxLeaderboardSize     = 25
+)
+
+// Handle draft topplayers command
+func handleTopPlayers(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	guildID := channelGuildID(s, m.ChannelID)
+	if len(guildID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the leaderboard is only available in a server channel.")
+		return
+	}
+
+	count, order := DefaultLeaderboardSize, LeaderboardByWins
+	for {
 		var token string
 		token, args = parseToken(args)
 		if len(token) == 0 {
-			_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a player number.")
-			currentCup.reply(s, "", CupReportAll^CupReportSubs)
-			return
+			break
 		}
-		index, err := strconv.Atoi(token)
-		if err != nil {
-			_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' doesn't look like a number. You need to specify a player number.")
-			currentCup.reply(s, "", CupReportAll^CupReportSubs)
-			return
+		token = strings.ToLower(token)
+		if token == LeaderboardByWins || token == LeaderboardByRating {
+			order = token
+			continue
 		}
-		index-- // 0-based
-
-		if index < 0 || index >= len(currentCup.Players) {
-			_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid player number.")
-			currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		number, err := strconv.Atoi(token)
+		if err != nil || number < 1 || number > MaxLeaderboardSize {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid option. You can specify a number of players (up to "+strconv.Itoa(MaxLeaderboardSize)+") and either **wins** or **rating**.")
 			return
 		}
+		count = number
+	}
 
-		if index >= numActive && index < len(currentCup.Players) {
-			sub := &currentCup.Players[index]
-			message := bold(escape(m.Author.Username)) + ", you can't pick " + display(sub) + ", he's only registered as a substitute."
-			_, _ = s.ChannelMessageSend(m.ChannelID, message)
-			currentCup.reply(s, "", CupReportAll^CupReportSubs)
-			return
+	players := topPlayers(guildID, order)
+	if len(players) == 0 {
+		message := "No cup results have been recorded on this server yet."
+		if order == LeaderboardByRating {
+			message = "No player ratings or seeds have been recorded on this server yet."
 		}
+		_, _ = sendMessage(s, m.ChannelID, message)
+		return
+	}
+	if len(players) > count {
+		players = players[:count]
+	}
 
-		selected := &currentCup.Players[index]
-		if selected.Team != -1 {
-			team := currentCup.Teams[selected.Team]
-			message := display(selected) + " already on team " + strconv.Itoa(selected.Team+1) + ", " + bold(team.Name)
-			_, _ = s.ChannelMessageSend(m.ChannelID, message)
-			currentCup.reply(s, "", CupReportAll^CupReportSubs)
-			return
+	nameLength := 0
+	for i := range players {
+		if length := utf8.RuneCountInString(players[i].Name); length > nameLength {
+			nameLength = length
 		}
+	}
+	rankDigits := digits10(len(players))
+
+	message := "Top players on this server by " + order + ":\n```\n"
+	rank := 0
+	for i := range players {
+		// Tied players share the same rank
+		if i == 0 || leaderboardValue(&players[i], order) != leaderboardValue(&players[i-1], order) {
+			rank = i + 1
+		}
+		line := rightpad(strconv.Itoa(rank)+". ", rankDigits+2) + rightpad(players[i].Name, nameLength) + " : "
+		if order == LeaderboardByRating {
+			line += "rating " + strconv.Itoa(players[i].Rating) + ", "
+		}
+		line += numbered(players[i].Wins, "win") + " in " + numbered(players[i].Played, "cup")
+		message += line + "\n"
+	}
+	message += "```"
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
 
-		text, _ := currentCup.addPlayerToTeam(index, pickup.Team)
-
-		// The last player isn't picked, but automatically assigned to the remaining slot.
-		if currentCup.PickedPlayers == numActive-1 {
-			currentCup.removeLastReply(s)
-			s.ChannelMessageDelete(m.ChannelID, m.ID)
-
-			lastPlayer := currentCup.nextAvailablePlayer()
-			lastSlot := currentCup.currentPickup()
-			lastJoin, _ := currentCup.addPlayerToTeam(lastPlayer, lastSlot.Team)
-			text += lastJoin
-
-			// We send the last two join messages separately, instead of merging them with the final report.
-			// This way, the last two players to get picked aren't highlighted at the end if the report mentions @everyone.
-			_, _ = s.ChannelMessageSend(currentCup.ChannelID, text)
-
-			currentCup.unpinAll(s)
+// Handle draft cup setname command
+func handleSetName(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		return
+	}
 
-			text = "Teams are now complete and the games can begin!\n" +
-				display(&currentCup.Manager) + " will take things from here, setting up matches and tracking scores.\n\n" +
-				currentCup.report(CupReportTeams|CupReportSubs) +
-				"Good luck and have fun, @everyone!"
+	deleteCommand(s, m)
 
-			lastMessage, err := s.ChannelMessageSend(currentCup.ChannelID, text)
-			if err == nil {
-				s.ChannelMessagePin(lastMessage.ChannelID, lastMessage.ID)
-			}
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change player names.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
 
-			deleteCup(currentCup.ChannelID)
-			return
-		}
+	var token string
+	token, args = parseToken(args)
+	name := strings.TrimSpace(args)
+	if len(token) == 0 || len(name) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a player number and a new name.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
 
-		currentCup.removeLastReply(s)
-		s.ChannelMessageDelete(m.ChannelID, m.ID)
-		_, _ = s.ChannelMessageSend(currentCup.ChannelID, text)
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	index, err := currentCup.parsePlayerNumber(token)
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+". You need to specify a player number.")
+		currentCup.reply(s, "", CupReportAll)
+		return
+	}
 
-	default:
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", we're not picking players at this point.")
+	// The name shows up in every report from now on, so it must not ping anyone
+	name = defuseUserMentions(defuseMentions(name))
+	if utf8.RuneCountInString(name) > MaxPlayerNameLength {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", player names can't be longer than "+strconv.Itoa(MaxPlayerNameLength)+" characters.")
 		currentCup.reply(s, "", CupReportAll)
 		return
 	}
+
+	player := &currentCup.Players[index]
+	message := bold(escape(m.Author.Username)) + " renamed " + currentCup.display(player) + " to "
+	if len(player.RealName) == 0 {
+		player.RealName = player.Name
+	}
+	player.Name = name
+	message += currentCup.display(player) + ".\n"
+
+	currentCup.reply(s, message, CupReportAll)
 }
 
-// Handle draft cup promotion
-func handlePromote(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+// Handle draft cup seed command
+func handleSeed(args string, s DiscordSession, m *discordgo.MessageCreate) {
 	currentCup := getCup(m.ChannelID)
 	if currentCup == nil || currentCup.Status == CupStatusInactive {
-		_, _ = s.ChannelMessageSend(m.ChannelID, noCupHereMessage(s, m))
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
 		return
 	}
 
-	if currentCup.Status != CupStatusSignup {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Cup can only be promoted when registration is open.")
+	deleteCommand(s, m)
+
+	if !currentCup.isManager(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can seed players.")
+		currentCup.reply(s, "", CupReportAll)
 		return
 	}
 
-	s.ChannelMessageDelete(m.ChannelID, m.ID)
-
-	var nextTime *time.Time
-	if currentCup.isSuperUser(m.Author.ID) {
-		nextTime = &currentCup.NextPromoteTimeManager
-	} else {
-		nextTime = &currentCup.NextPromoteTime
+	var token, rankToken string
+	token, args = parseToken(args)
+	rankToken, args = parseToken(args)
+	if len(token) == 0 || len(rankToken) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you need to specify a player number and a seed (1 to "+strconv.Itoa(MaxSeed)+", or none) after "+bold(commandSeed.syntaxNoArgs()))
+		currentCup.reply(s, "", CupReportAll)
+		return
 	}
 
-	now := time.Now()
-	remaining := nextTime.Sub(now)
-	if remaining > 0 {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Too soon to promote, "+bold(escape(m.Author.Username))+". You can try again in "+humanize(remaining)+".")
+	index, err := currentCup.parsePlayerNumber(token)
+	if err != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+err.Error()+". You need to specify a player number.")
+		currentCup.reply(s, "", CupReportAll)
 		return
 	}
 
-	currentCup.NextPromoteTime = now.Add(MinimumPromotionInterval)
-	currentCup.NextPromoteTimeManager = now.Add(MinimumPromotionIntervalManager)
+	seed := 0
+	if !strings.EqualFold(rankToken, "none") {
+		seed, err = strconv.Atoi(rankToken)
+		if err != nil || seed < 1 || seed > MaxSeed {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the seed needs to be a number between 1 (strongest) and "+strconv.Itoa(MaxSeed)+", or none.")
+			currentCup.reply(s, "", CupReportAll)
+			return
+		}
+	}
 
-	text := "Hey, @everyone!\n\nDon't forget that registration is now open for a new draft cup, managed by " + display(&currentCup.Manager) + ".\n"
-	if len(currentCup.Description) > 0 {
-		text += "\n" + currentCup.Description
+	player := &currentCup.Players[index]
+	player.Seed = seed
+	message := bold(escape(m.Author.Username)) + " removed the seed of " + currentCup.display(player) + ".\n"
+	if seed > 0 {
+		message = bold(escape(m.Author.Username)) + " seeded " + currentCup.display(player) + " " + nth(seed) + ".\n"
 	}
-	_, _ = s.ChannelMessageSend(m.ChannelID, text)
-	currentCup.reply(s, "", CupReportAll)
+	currentCup.reply(s, message, CupReportAll)
 }
 
-// Handle draft cup player list info command
-func handleWho(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
-	currentCup := getCup(m.ChannelID)
-	if currentCup == nil || currentCup.Status == CupStatusInactive {
-		message := noCupHereMessage(s, m)
-		pinned, _ := lastPinned(s, m.ChannelID)
-		if pinned != nil {
-			// Apparently, ContentWithMentionsReplaced *doesn't* replace @everyone...
-			previous := strings.Replace(pinned.ContentWithMentionsReplaced(), "@everyone", "everyone", -1)
-
-			message += "\n\n__***Last pinned cup message"
-			when, err := pinned.Timestamp.Parse()
-			if err == nil {
-				delta := time.Now().Sub(when)
-				// Only mention elapsed time if it's in the past...
-				if delta > 0 {
-					message += " (from " + humanize(delta) + " ago)"
-				}
-			}
-			message += ":***__\n\n" + previous
-		}
-		_, _ = s.ChannelMessageSend(m.ChannelID, message)
+// Handle draft language command
+func handleLanguage(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	guildID := channelGuildID(s, m.ChannelID)
+	if len(guildID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", the language can only be changed in a server channel.")
 		return
 	}
-	currentCup.deleteAndReply(s, m, "", CupReportAll)
 
-	if devHacks.saveOnWho {
-		currentCup.save()
+	var token string
+	token, args = parseToken(args)
+	token = strings.ToLower(token)
+	if len(token) == 0 {
+		language := guildLanguage(guildID)
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", the language used on this server is "+bold(tr(language, "language"))+" ("+language+"). Supported languages: "+supportedLanguages()+".")
+		return
 	}
-}
 
-// Handle draft cup moderation toggle command
-func handleModerate(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
-	currentCup := getCup(m.ChannelID)
-	if currentCup == nil || currentCup.Status == CupStatusInactive {
-		_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", moderation can only be enabled when a cup is active.\n")
+	if !isAdmin(s, guildID, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only admins can change the language.")
 		return
 	}
 
-	if !currentCup.isSuperUser(m.Author.ID) {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, or an admin can enable or disable moderation.")
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	if !isLanguageSupported(token) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a supported language. Supported languages: "+supportedLanguages()+".")
 		return
 	}
 
-	moderation := !currentCup.Moderated
+	err := updateGuildConfig(guildID, func(config *GuildConfig) error {
+		config.Language = token
+		return nil
+	})
+	if err != nil {
+		logError(logGuild(guildID), "Error saving guild settings:", err)
+	}
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" changed the language used on this server to "+bold(tr(token, "language"))+".")
+}
+
+// Handle draft mention command
+func handleMention(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	guildID := channelGuildID(s, m.ChannelID)
+	if len(guildID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", announcements can only be configured in a server channel.")
+		return
+	}
 
 	var token string
 	token, args = parseToken(args)
 	token = strings.ToLower(token)
+	if len(token) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", announcements on this server mention "+bold(describeAnnounceSetting(announceSetting(guildID)))+".")
+		return
+	}
 
-	if len(token) > 0 {
-		if token == "on" {
-			moderation = true
-		} else if token == "off" {
-			moderation = false
-		} else {
-			message := bold(escape(m.Author.Username)) + ", '" + token + "' is not a valid option. You need to specify either **on** or **off** after " + bold(commandModerate.syntaxNoArgs())
-			_, _ = s.ChannelMessageSend(m.ChannelID, message)
-			currentCup.reply(s, "", CupReportAll^CupReportSubs)
-			return
-		}
+	if !isAdmin(s, guildID, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only admins can change who gets mentioned in announcements.")
+		return
 	}
 
-	if moderation == currentCup.Moderated {
-		if currentCup.Moderated {
-			_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", this channel is already moderated.")
-		} else {
-			_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", this channel is already unmoderated.")
-		}
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	setting := token
+	if strings.HasPrefix(token, "<@&") && strings.HasSuffix(token, ">") {
+		setting = token[3 : len(token)-1]
+	}
+	if !isValidAnnounceMention(setting) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+token+"' is not a valid option. Use "+bold(AnnounceEveryone)+", "+bold(AnnounceHere)+", "+bold(AnnounceNone)+" or mention a role.")
 		return
 	}
 
-	currentCup.Moderated = moderation
-	if currentCup.Moderated {
-		s.ChannelMessageDelete(m.ChannelID, m.ID)
-		_, _ = s.ChannelMessageSend(currentCup.ChannelID, "This channel is now moderated while the cup is active.\nAny message that is not a bot command will be removed.")
-	} else {
-		s.ChannelMessageDelete(m.ChannelID, m.ID)
-		_, _ = s.ChannelMessageSend(currentCup.ChannelID, "This channel is no longer moderated.")
+	err := updateGuildConfig(guildID, func(config *GuildConfig) error {
+		config.AnnounceMention = setting
+		return nil
+	})
+	if err != nil {
+		logError(logGuild(guildID), "Error saving guild settings:", err)
 	}
+
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" changed announcements on this server to mention "+bold(describeAnnounceSetting(setting))+".")
 }
 
-// Handle draft reopen command
-func handleReopen(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
-	currentCup := getCup(m.ChannelID)
-	if currentCup == nil || currentCup.Status == CupStatusInactive {
-		_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+// Handle draft whoami command, explaining the caller's cup permissions (sent as a direct message)
+func handleWhoAmI(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	guildID := channelGuildID(s, m.ChannelID)
+	if len(guildID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", permissions can only be checked in a server channel.")
 		return
 	}
 
-	s.ChannelMessageDelete(m.ChannelID, m.ID)
+	roleNames, err := memberRoleNames(s, guildID, m.Author.ID)
+	if err != nil {
+		logWarn(logGuild(guildID), "Error retrieving guild member:", err)
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", I couldn't retrieve your roles on this server.")
+		return
+	}
+	adminRole := matchAdminRole(guildID, roleNames)
 
-	if currentCup.Status != CupStatusPickup {
-		_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", the cup can be only reopen for sign-up after picking has begun.")
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	// Only users with cup rights get to see the details. These follow isSuperUser exactly:
+	// the cup manager, or anyone with one of the guild's admin roles.
+	currentCup := getCup(m.ChannelID)
+	manager := currentCup != nil && currentCup.isManager(m.Author.ID)
+	if !manager && len(adminRole) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only cup managers and admins can check their permissions.")
 		return
 	}
 
-	if !currentCup.isManager(m.Author.ID) {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can discard current teams and reopen the cup for sign-up.")
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	text := "Permissions for " + bold(escape(m.Author.Username)) + " in " + mentionChannel(m.ChannelID) + ":\n```\n"
+	if len(roleNames) == 0 {
+		text += "Roles         : none\n"
+	} else {
+		text += "Roles         : " + strings.Join(roleNames, ", ") + "\n"
+	}
+	if len(adminRole) > 0 {
+		text += "Admin role    : yes (" + adminRole + ")\n"
+	} else {
+		text += "Admin role    : no (recognized roles: " + strings.Join(guildAdminRoles(guildID), ", ") + ")\n"
+	}
+	if currentCup == nil {
+		text += "Cup manager   : no cup in progress\n"
+	} else {
+		text += "Cup manager   : " + yesNo(manager) + " (" + currentCup.Manager.Name + ")\n"
+		switch {
+		case manager:
+			text += "Cup superuser : yes (cup manager)\n"
+		case len(adminRole) > 0:
+			text += "Cup superuser : yes (admin role)\n"
+		default:
+			text += "Cup superuser : no\n"
+		}
+	}
+	text += "```"
+
+	deleteCommand(s, m)
+
+	channel, err := s.UserChannelCreate(m.Author.ID)
+	if err != nil {
+		logWarn("Error creating DM channel:", err)
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", I couldn't send you a direct message.")
 		return
 	}
+	_, _ = sendMessage(s, channel.ID, text)
+}
 
-	currentCup.Teams = nil
-	for i := range currentCup.Players {
-		player := &currentCup.Players[i]
-		player.resetTeam()
+// Handle draft cup spectate command
+func handleSpectate(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
+		return
 	}
-	currentCup.Status = CupStatusSignup
-	currentCup.PickedPlayers = 0
 
-	_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+" discarded the teams and reopened the cup.")
-	currentCup.reply(s, "", CupReportAll)
+	deleteCommand(s, m)
+
+	var message string
+	switch {
+	case currentCup.findPlayer(m.Author.ID) != -1:
+		message = bold(escape(m.Author.Username)) + ", you're already taking part in this cup."
+	case currentCup.findSpectator(m.Author.ID) != -1:
+		message = bold(escape(m.Author.Username)) + ", you're already watching this cup."
+	default:
+		currentCup.Spectators = append(currentCup.Spectators, Player{Name: m.Author.Username, ID: m.Author.ID, Team: -1, Next: -1})
+		message = bold(escape(m.Author.Username)) + " is now watching the cup, and will get the final teams by direct message. To stop, type " + bold(commandUnspectate.syntax())
+	}
+	_, _ = sendMessage(s, m.ChannelID, message)
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
 }
 
-// Handle draft cup teamsize command
-func handleTeamSize(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+// Handle draft cup unspectate command
+func handleUnspectate(args string, s DiscordSession, m *discordgo.MessageCreate) {
 	currentCup := getCup(m.ChannelID)
 	if currentCup == nil || currentCup.Status == CupStatusInactive {
-		_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", there's no cup in progress in this channel.\n")
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
 		return
 	}
 
-	s.ChannelMessageDelete(m.ChannelID, m.ID)
+	deleteCommand(s, m)
 
-	var token string
-	token, args = parseToken(args)
-	if len(token) <= 0 {
-		message := bold(escape(m.Author.Username)) + ", team size is " + bold(strconv.Itoa(currentCup.TeamSize)) + ".\n"
-		_, _ = s.ChannelMessageSend(m.ChannelID, message)
+	if !currentCup.removeSpectator(m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", you weren't watching this cup anyway.")
 		currentCup.reply(s, "", CupReportAll^CupReportSubs)
 		return
 	}
 
-	if !currentCup.isManager(m.Author.ID) {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Only "+display(&currentCup.Manager)+", the cup manager, can change team size.")
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" stopped watching the cup.")
+	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+}
+
+// Handle draft cup spectators command
+func handleSpectators(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	currentCup := getCup(m.ChannelID)
+	if currentCup == nil || currentCup.Status == CupStatusInactive {
+		_, _ = sendMessage(s, m.ChannelID, noCupHereMessage(s, m))
 		return
 	}
 
-	if currentCup.Status != CupStatusSignup {
-		_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+", you can only change team size during sign-up.")
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	if len(currentCup.Spectators) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Nobody is watching this cup yet. To get the final teams by direct message, type "+bold(commandSpectate.syntax()))
 		return
 	}
 
-	newSize, err := strconv.Atoi(token)
+	message := numbered(len(currentCup.Spectators), "spectator") + " watching this cup:\n```\n"
+	for i := range currentCup.Spectators {
+		message += strconv.Itoa(i+1) + ". " + currentCup.Spectators[i].Name + "\n"
+	}
+	message += "```"
+	_, _ = sendMessage(s, m.ChannelID, message)
+}
+
+// Handle draft subscribe command
+func handleSubscribe(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	changeSubscription(s, m, true)
+}
+
+// Handle draft unsubscribe command
+func handleUnsubscribe(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	changeSubscription(s, m, false)
+}
+
+func changeSubscription(s DiscordSession, m *discordgo.MessageCreate, subscribed bool) {
+	guildID := channelGuildID(s, m.ChannelID)
+	if len(guildID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", notifications can only be set up in a server channel.")
+		return
+	}
+
+	changed, err := setSubscribed(guildID, m.Author.ID, subscribed)
 	if err != nil {
-		message := bold(escape(m.Author.Username)) + ", '" + token + "' doesn't look like a number.\n\n"
-		_, _ = s.ChannelMessageSend(m.ChannelID, message)
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+		logError(logGuild(guildID), "Error saving guild settings:", err)
+	}
+
+	var message string
+	switch {
+	case subscribed && changed:
+		message = "you'll get a direct message whenever a cup starts on this server. To stop, type " + bold(commandUnsubscribe.syntax())
+	case subscribed:
+		message = "you're already getting notified about new cups on this server."
+	case changed:
+		message = "you won't be notified about new cups on this server anymore."
+	default:
+		message = "you weren't getting notified about new cups on this server."
+	}
+	deleteCommand(s, m)
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+message)
+}
+
+// Handle draft config command
+func handleConfig(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	guildID := channelGuildID(s, m.ChannelID)
+	if len(guildID) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", settings can only be configured in a server channel.")
 		return
 	}
 
-	if newSize <= 0 {
-		message := bold(escape(m.Author.Username)) + ", " + token + " is not a valid team size."
-		_, _ = s.ChannelMessageSend(m.ChannelID, message)
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	var name string
+	name, args = parseToken(args)
+	value := strings.TrimSpace(args)
+	config := getGuildConfig(guildID)
+
+	if len(name) == 0 {
+		longestName := 0
+		for i := range configSettings {
+			if len(configSettings[i].name) > longestName {
+				longestName = len(configSettings[i].name)
+			}
+		}
+
+		message := "Settings for this server:\n```\n"
+		for i := range configSettings {
+			setting := &configSettings[i]
+			message += fmt.Sprintf("%*s : %s\n", -longestName, setting.name, setting.get(&config))
+		}
+		message += "```\nAdmins can change a setting by typing " + bold(commandConfig.syntax()) + ", or restore its default value with " + bold(ConfigDefaultValue) + " as the value."
+		_, _ = sendMessage(s, m.ChannelID, message)
 		return
 	}
 
-	if newSize == currentCup.TeamSize {
-		message := bold(escape(m.Author.Username)) + ", team size is already " + token + "."
-		_, _ = s.ChannelMessageSend(m.ChannelID, message)
-		currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	setting := findConfigSetting(name)
+	if setting == nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", '"+name+"' is not a valid setting. Type "+bold(commandConfig.syntaxNoArgs())+" for a list of settings.")
+		return
+	}
+
+	if len(value) == 0 {
+		_, _ = sendMessage(s, m.ChannelID, setting.description+": "+bold(setting.get(&config)))
 		return
 	}
 
-	currentCup.TeamSize = newSize
+	if !isAdmin(s, guildID, m.Author.ID) {
+		_, _ = sendMessage(s, m.ChannelID, "Sorry, "+bold(escape(m.Author.Username))+", only admins can change settings.")
+		return
+	}
 
-	_, _ = s.ChannelMessageSend(m.ChannelID, bold(escape(m.Author.Username))+" has changed team size to "+bold(token)+".")
-	currentCup.reply(s, "", CupReportAll^CupReportSubs)
+	var setErr error
+	err := updateGuildConfig(guildID, func(config *GuildConfig) error {
+		if strings.EqualFold(value, ConfigDefaultValue) {
+			setting.reset(config)
+			return nil
+		}
+		setErr = setting.set(config, value)
+		return setErr
+	})
+	if setErr != nil {
+		_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+setErr.Error()+".")
+		return
+	}
+	if err != nil {
+		logError(logGuild(guildID), "Error saving guild settings:", err)
+	}
+
+	config = getGuildConfig(guildID)
+	_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+" changed "+bold(setting.name)+" to "+bold(setting.get(&config))+".")
 }
 
 // Handle draft cup help command
-func handleHelp(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
+func handleHelp(args string, s DiscordSession, m *discordgo.MessageCreate) {
+	if name := strings.TrimSpace(args); len(name) > 0 {
+		cmd := findCommand(name)
+		if cmd == nil {
+			_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", there's no command called '"+name+"'. Type "+bold(commandHelp.syntaxNoArgs())+" for a list of commands.")
+			return
+		}
+
+		message := bold(escape(cmd.syntax())) + "\n" + cmd.help + "\n"
+		if len(cmd.usage) > 0 {
+			message += "\n" + cmd.usage + "\n"
+		}
+		if len(cmd.aliases) > 0 {
+			message += "\nAlso available as " + bold(strings.Join(cmd.aliases, ", ")) + ".\n"
+		}
+		if len(cmd.examples) > 0 {
+			message += "\nExamples:\n```\n"
+			for _, example := range cmd.examples {
+				message += cmd.example(example) + "\n"
+			}
+			message += "```"
+		}
+		_, _ = sendMessage(s, m.ChannelID, message)
+		return
+	}
+
 	message := "Supported commands:\n```Note: arguments marked [] are optional, <> are mandatory.\n\n"
 
 	for i, group := range commandGroups {
@@ -650,5 +3458,5 @@ func handleHelp(args string, s *discordgo.Session, m *discordgo.MessageCreate) {
 
 	message += "```\n"
 
-	_, _ = s.ChannelMessageSend(m.ChannelID, message)
+	_, _ = sendMessage(s, m.ChannelID, message)
 }
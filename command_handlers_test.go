@@ -0,0 +1,791 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Starts a cup through the fake session, with teams of two. The cup is removed when the test ends.
+func startFakeCup(t *testing.T, s *fakeSession, channelID string) *Cup {
+	handleMessage(s, fakeMessageCreate(channelID, "100", "?draft start"))
+	currentCup := getCup(channelID)
+	if currentCup == nil {
+		t.Fatal("cup not started")
+	}
+	t.Cleanup(func() {
+		deleteCup(s, channelID)
+		lockCups.Lock()
+		delete(finishedCups, channelID)
+		lockCups.Unlock()
+	})
+	currentCup.TeamSize = 2
+	currentCup.MinimumTeams = 2
+	return currentCup
+}
+
+// Signs up the given users for the cup in the given channel
+func signUpFakePlayers(s *fakeSession, channelID string, userIDs ...string) {
+	for _, id := range userIDs {
+		handleMessage(s, fakeMessageCreate(channelID, id, "?draft add"))
+	}
+}
+
+// Drafts the first four players of a cup started by startFakeCup into two teams, closing sign-up first
+// if needed: users 1 and 3 against users 2 and 4. Fails the test unless the cup finishes.
+func completeFakeDraft(t *testing.T, s *fakeSession, channelID string) {
+	if currentCup := getCup(channelID); currentCup != nil && currentCup.Status == CupStatusSignup {
+		handleMessage(s, fakeMessageCreate(channelID, "100", "?draft close"))
+	}
+	handleMessage(s, fakeMessageCreate(channelID, "100", "?draft pick 1"))
+	handleMessage(s, fakeMessageCreate(channelID, "100", "?draft pick 2"))
+	handleMessage(s, fakeMessageCreate(channelID, "1", "?draft pick 3"))
+	if getFinishedCup(channelID) == nil {
+		t.Fatal("cup not finished once the teams were complete")
+	}
+}
+
+func TestHandleAdd(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "add")
+	if len(s.pinned) != 1 {
+		t.Errorf("%d messages pinned on start, expected the announcement", len(s.pinned))
+	}
+
+	handleMessage(s, fakeMessageCreate("add", "1", "?draft add"))
+	handleMessage(s, fakeMessageCreate("add", "2", "?draft add"))
+	if len(currentCup.Players) != 2 || currentCup.Players[0].ID != "1" || currentCup.Players[1].ID != "2" {
+		t.Fatalf("got players %v, expected 1 and 2", currentCup.Players)
+	}
+
+	handleMessage(s, fakeMessageCreate("add", "1", "?draft add"))
+	if len(currentCup.Players) != 2 {
+		t.Errorf("player added twice")
+	}
+	if !s.saw("add", "already registered") {
+		t.Errorf("duplicate sign-up not reported")
+	}
+}
+
+func TestHandleClose(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "close")
+	signUpFakePlayers(s, "close", "1", "2", "3", "4", "5")
+
+	handleMessage(s, fakeMessageCreate("close", "1", "?draft close"))
+	if currentCup.Status != CupStatusSignup {
+		t.Fatal("sign-up closed by a player")
+	}
+
+	handleMessage(s, fakeMessageCreate("close", "100", "?draft close"))
+	if currentCup.Status != CupStatusPickup {
+		t.Fatal("sign-up not closed by the manager")
+	}
+	if len(currentCup.Teams) != 2 || currentCup.activePlayerCount() != 4 {
+		t.Errorf("got %d teams with %d players, expected 2 with 4", len(currentCup.Teams), currentCup.activePlayerCount())
+	}
+}
+
+func TestHandlePick(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "pick")
+	signUpFakePlayers(s, "pick", "1", "2", "3", "4")
+	handleMessage(s, fakeMessageCreate("pick", "100", "?draft close"))
+
+	// The manager picks the captains, then the captains pick their players
+	handleMessage(s, fakeMessageCreate("pick", "100", "?draft pick 1"))
+	handleMessage(s, fakeMessageCreate("pick", "100", "?draft pick 2"))
+
+	handleMessage(s, fakeMessageCreate("pick", "2", "?draft pick 3"))
+	if currentCup.PickedPlayers != 2 || !s.saw("pick", "not your turn") {
+		t.Errorf("player picked out of turn")
+	}
+
+	handleMessage(s, fakeMessageCreate("pick", "1", "?draft pick 3"))
+	if getCup("pick") != nil || getFinishedCup("pick") != currentCup {
+		t.Fatal("cup not finished once the teams were complete")
+	}
+	for i, expected := range []string{"User1, User3", "User2, User4"} {
+		if lineup, _ := currentCup.getLineup(i); lineup != expected {
+			t.Errorf("team %d: got %q, expected %q", i+1, lineup, expected)
+		}
+	}
+	if !s.saw("pick", "Teams are now complete") {
+		t.Errorf("completion not announced")
+	}
+}
+
+func TestPlaceholderCaptain(t *testing.T) {
+	s := newFakeSession("guild")
+
+	// A reserved slot becomes captain as one of the first sign-ups
+	auto := startFakeCup(t, s, "autoplaceholder")
+	handleMessage(s, fakeMessageCreate("autoplaceholder", "100", "?draft captains auto"))
+	handleMessage(s, fakeMessageCreate("autoplaceholder", "100", "?draft fill 1"))
+	signUpFakePlayers(s, "autoplaceholder", "1", "2", "3")
+	handleMessage(s, fakeMessageCreate("autoplaceholder", "100", "?draft close"))
+	if who := auto.whoPicks(auto.currentPickup()); who == nil || who.ID != "100" {
+		t.Fatalf("manager not picking for the reserved captain: %v", who)
+	}
+	handleMessage(s, fakeMessageCreate("autoplaceholder", "100", "?draft pick 3"))
+	if getFinishedCup("autoplaceholder") != auto {
+		t.Errorf("manager couldn't pick for the reserved captain, %d players picked", auto.PickedPlayers)
+	}
+
+	// The manager picks a reserved slot as captain
+	manual := startFakeCup(t, s, "pickplaceholder")
+	signUpFakePlayers(s, "pickplaceholder", "1", "2", "3")
+	handleMessage(s, fakeMessageCreate("pickplaceholder", "100", "?draft fill 1"))
+	handleMessage(s, fakeMessageCreate("pickplaceholder", "100", "?draft close"))
+	handleMessage(s, fakeMessageCreate("pickplaceholder", "100", "?draft pick 4"))
+	handleMessage(s, fakeMessageCreate("pickplaceholder", "100", "?draft pick 1"))
+	if who := manual.whoPicks(manual.currentPickup()); who == nil || who.ID != "100" {
+		t.Fatalf("manager not picking for the reserved captain: %v", who)
+	}
+	handleMessage(s, fakeMessageCreate("pickplaceholder", "100", "?draft pick 2"))
+	if getFinishedCup("pickplaceholder") != manual {
+		t.Errorf("manager couldn't pick for the reserved captain, %d players picked", manual.PickedPlayers)
+	}
+}
+
+func TestHandleWhoLeft(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "wholeft")
+	signUpFakePlayers(s, "wholeft", "1", "2", "3")
+
+	handleMessage(s, fakeMessageCreate("wholeft", "2", "?draft leave"))
+	handleMessage(s, fakeMessageCreate("wholeft", "2", "?draft add"))
+	handleMessage(s, fakeMessageCreate("wholeft", "2", "?draft remove"))
+	handleMessage(s, fakeMessageCreate("wholeft", "100", "?draft remove 1"))
+	if len(currentCup.Departures) != 2 {
+		t.Fatalf("got %d departures, expected 2 (removals by the manager don't count)", len(currentCup.Departures))
+	}
+
+	handleMessage(s, fakeMessageCreate("wholeft", "100", "?draft wholeft"))
+	if !s.saw("wholeft", "1. User2 (2 times)") {
+		t.Errorf("departures not listed:\n%v", s.sentTo("wholeft"))
+	}
+}
+
+func TestHandleMentionTeam(t *testing.T) {
+	s := newFakeSession("guild")
+	startFakeCup(t, s, "mentionteam")
+	signUpFakePlayers(s, "mentionteam", "1", "2", "3", "4", "5")
+	completeFakeDraft(t, s, "mentionteam")
+
+	handleMessage(s, fakeMessageCreate("mentionteam", "1", "?draft mentionteam 2"))
+	handleMessage(s, fakeMessageCreate("mentionteam", "5", "?draft mentionteam 1"))
+	if s.saw("mentionteam", "is calling") {
+		t.Errorf("team called by someone other than its captain or the manager")
+	}
+	handleMessage(s, fakeMessageCreate("mentionteam", "100", "?draft mentionteam 3"))
+	if !s.saw("mentionteam", "between 1 and 2") {
+		t.Errorf("invalid team number accepted")
+	}
+
+	handleMessage(s, fakeMessageCreate("mentionteam", "1", "?draft mentionteam 1"))
+	if !s.saw("mentionteam", "<@1> <@3>") {
+		t.Errorf("team members not mentioned:\n%v", s.sentTo("mentionteam"))
+	}
+}
+
+func TestHandleMentionAll(t *testing.T) {
+	s := newFakeSession("guild")
+	startFakeCup(t, s, "mentionall")
+	signUpFakePlayers(s, "mentionall", "1", "2", "3", "4", "5")
+
+	handleMessage(s, fakeMessageCreate("mentionall", "100", "?draft mentionall"))
+	if s.saw("mentionall", "is calling") {
+		t.Errorf("players mentioned during sign-up")
+	}
+
+	handleMessage(s, fakeMessageCreate("mentionall", "100", "?draft close"))
+	handleMessage(s, fakeMessageCreate("mentionall", "1", "?draft mentionall"))
+	if s.saw("mentionall", "is calling") {
+		t.Errorf("players mentioned by someone other than the manager")
+	}
+
+	handleMessage(s, fakeMessageCreate("mentionall", "100", "?draft mentionall"))
+	if !s.saw("mentionall", "<@1> <@2> <@3> <@4>") || s.saw("mentionall", "<@5>") {
+		t.Errorf("active players not mentioned, or substitute mentioned:\n%v", s.sentTo("mentionall"))
+	}
+	handleMessage(s, fakeMessageCreate("mentionall", "100", "?draft mentionall"))
+	if !s.saw("mentionall", "mentioned recently") {
+		t.Errorf("cooldown not enforced")
+	}
+}
+
+func TestHandleAnnounce(t *testing.T) {
+	s := newFakeSession("guild")
+	startFakeCup(t, s, "announce")
+	handleMessage(s, fakeMessageCreate("announce", "1", "?draft add"))
+
+	handleMessage(s, fakeMessageCreate("announce", "100", "?draft announce general"))
+	if len(s.sentTo("general")) != 0 {
+		t.Fatal("cup announced without a channel mention")
+	}
+
+	handleMessage(s, fakeMessageCreate("announce", "100", "?draft announce <#general>"))
+	if !s.saw("general", "Registration is open for a draft cup in <#announce>") {
+		t.Errorf("announcement not posted:\n%v", s.sentTo("general"))
+	}
+	if !s.saw("announce", "announced this cup in <#general>") {
+		t.Errorf("announcement not confirmed in the cup channel")
+	}
+}
+
+func TestKeepCommands(t *testing.T) {
+	s := newFakeSession("keep")
+	lockGuilds.Lock()
+	guildConfigs["keep"] = &GuildConfig{GuildID: "keep", KeepCommands: true}
+	lockGuilds.Unlock()
+	defer func() {
+		lockGuilds.Lock()
+		delete(guildConfigs, "keep")
+		lockGuilds.Unlock()
+	}()
+
+	startFakeCup(t, s, "keepcommands")
+	handleMessage(s, fakeMessageCreate("keepcommands", "1", "?draft add"))
+	handleMessage(s, fakeMessageCreate("keepcommands", "1", "?draft who"))
+	for _, id := range s.deleted {
+		if strings.HasPrefix(id, "command") {
+			t.Errorf("command message %s deleted", id)
+		}
+	}
+}
+
+func TestRemoteAdd(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "remote")
+
+	handleMessage(s, fakeMessageCreate("lobby", "1", "?draft add <#nowhere>"))
+	if !s.saw("lobby", "no cup in progress in <#nowhere>") {
+		t.Errorf("missing cup not reported:\n%v", s.sentTo("lobby"))
+	}
+
+	handleMessage(s, fakeMessageCreate("lobby", "1", "?draft add <#remote>"))
+	if currentCup.findPlayer("1") != 0 {
+		t.Fatalf("player not signed up: %v", currentCup.Players)
+	}
+	if !s.saw("remote", "<@1> signed up from <#lobby>") {
+		t.Errorf("sign-up not announced in the cup channel:\n%v", s.sentTo("remote"))
+	}
+
+	handleMessage(s, fakeMessageCreate("lobby", "1", "?draft join <#remote>"))
+	if len(currentCup.Players) != 1 || !s.saw("lobby", "already registered") {
+		t.Errorf("duplicate sign-up not rejected")
+	}
+
+	// Signing up from elsewhere closes a full cup just like adding in the channel
+	currentCup.AutoClose = 4
+	handleMessage(s, fakeMessageCreate("lobby", "2", "?draft add <#remote>"))
+	handleMessage(s, fakeMessageCreate("lobby", "3", "?draft join <#remote>"))
+	handleMessage(s, fakeMessageCreate("lobby", "4", "?draft add <#remote>"))
+	if currentCup.Status != CupStatusPickup || !s.saw("remote", "registration is now closed automatically") {
+		t.Errorf("full cup not closed automatically, status %d", currentCup.Status)
+	}
+}
+
+func TestHandleLock(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "lock")
+	signUpFakePlayers(s, "lock", "1", "2", "3")
+
+	handleMessage(s, fakeMessageCreate("lock", "1", "?draft lock"))
+	if currentCup.Locked {
+		t.Fatal("roster locked by a player")
+	}
+
+	handleMessage(s, fakeMessageCreate("lock", "100", "?draft lock"))
+	handleMessage(s, fakeMessageCreate("lock", "4", "?draft add"))
+	handleMessage(s, fakeMessageCreate("lock", "100", "?draft remove 1"))
+	handleMessage(s, fakeMessageCreate("lock", "100", "?draft kick 2"))
+	if len(currentCup.Players) != 3 || len(currentCup.Banned) != 0 {
+		t.Fatalf("roster changed while locked: %v", currentCup.Players)
+	}
+	if report := currentCup.report(CupReportAll); !strings.Contains(report, "locked for now, but players can still leave") {
+		t.Errorf("lock not shown in the report:\n%s", report)
+	}
+
+	handleMessage(s, fakeMessageCreate("lock", "100", "?draft lock strict"))
+	handleMessage(s, fakeMessageCreate("lock", "100", "?draft pause"))
+	report := currentCup.report(CupReportAll)
+	if !strings.Contains(report, "nobody can join or leave") || !strings.Contains(report, "paused") {
+		t.Errorf("strict lock and pause not both shown in the report:\n%s", report)
+	}
+	handleMessage(s, fakeMessageCreate("lock", "100", "?draft open"))
+	handleMessage(s, fakeMessageCreate("lock", "3", "?draft leave"))
+	if len(currentCup.Players) != 3 {
+		t.Fatal("player left despite a strict lock")
+	}
+
+	handleMessage(s, fakeMessageCreate("lock", "100", "?draft lock"))
+	handleMessage(s, fakeMessageCreate("lock", "3", "?draft leave"))
+	if len(currentCup.Players) != 2 {
+		t.Fatal("player couldn't leave a regular lock")
+	}
+
+	handleMessage(s, fakeMessageCreate("lock", "100", "?draft unlock"))
+	handleMessage(s, fakeMessageCreate("lock", "4", "?draft add"))
+	if currentCup.Locked || len(currentCup.Players) != 3 {
+		t.Errorf("sign-up not possible after unlocking: %v", currentCup.Players)
+	}
+}
+
+func TestSingleTeamCup(t *testing.T) {
+	savedOption := cupOptions.allowSingleTeam
+	defer func() { cupOptions.allowSingleTeam = savedOption }()
+	cupOptions.allowSingleTeam = true
+
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "single")
+	currentCup.TeamSize = 3
+	handleMessage(s, fakeMessageCreate("single", "100", "?draft minteams 1"))
+	if currentCup.MinimumTeams != 1 {
+		t.Fatalf("minimum teams is %d, expected 1", currentCup.MinimumTeams)
+	}
+	signUpFakePlayers(s, "single", "1", "2", "3", "4")
+
+	handleMessage(s, fakeMessageCreate("single", "100", "?draft close"))
+	if currentCup.Status != CupStatusPickup || len(currentCup.Teams) != 1 {
+		t.Fatalf("got status %d with %d teams, expected picking with one team", currentCup.Status, len(currentCup.Teams))
+	}
+	if currentCup.activePlayerCount() != 3 {
+		t.Errorf("%d active players, expected 3 and a substitute", currentCup.activePlayerCount())
+	}
+
+	if report := currentCup.report(CupReportAll); !strings.Contains(report, "1 competing team:") {
+		t.Errorf("single team not described as such:\n%s", report)
+	}
+
+	handleMessage(s, fakeMessageCreate("single", "100", "?draft pick 2"))
+	if report := currentCup.report(CupReportAll); !strings.Contains(report, "1 team, with 1 player picked out of 3") {
+		t.Errorf("single team not described as such:\n%s", report)
+	}
+	if pickup := currentCup.currentPickup(); pickup != (pickupSlot{0, 1}) {
+		t.Errorf("got pick %v after the captain, expected the second player of team 1", pickup)
+	}
+	if who := currentCup.whoPicks(currentCup.currentPickup()); who == nil || who.ID != "2" {
+		t.Errorf("captain not picking: %v", who)
+	}
+	handleMessage(s, fakeMessageCreate("single", "2", "?draft pick 1"))
+	handleMessage(s, fakeMessageCreate("single", "2", "?draft pick 3"))
+
+	if getCup("single") != nil || getFinishedCup("single") != currentCup {
+		t.Fatal("cup not finished once the team was complete")
+	}
+	if lineup, _ := currentCup.getLineup(0); lineup != "User2, User1, User3" {
+		t.Errorf("got lineup %q", lineup)
+	}
+	if !s.saw("single", "Teams are now complete") {
+		t.Errorf("completion not announced:\n%s", strings.Join(s.sentTo("single"), "\n---\n"))
+	}
+
+	// A single team has no one to play against, so there are no results to record
+	handleMessage(s, fakeMessageCreate("single", "100", "?draft game 1"))
+	if currentCup.Winner != 0 || len(currentCup.SeriesScore) != 0 {
+		t.Errorf("result recorded for a single team")
+	}
+	if !s.saw("single", "single team, so there are no games to record") {
+		t.Errorf("game result not refused:\n%s", strings.Join(s.sentTo("single"), "\n---\n"))
+	}
+	handleMessage(s, fakeMessageCreate("single", "100", "?draft forfeit 1"))
+	if currentCup.Winner != 0 {
+		t.Errorf("forfeit recorded for a single team")
+	}
+}
+
+func TestHandleSummary(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "summary")
+	handleMessage(s, fakeMessageCreate("summary", "100", "?draft describe *Friday* cup, ask <@5>"))
+	signUpFakePlayers(s, "summary", "1", "2", "3", "4")
+	handleMessage(s, fakeMessageCreate("summary", "100", "?draft close"))
+	handleMessage(s, fakeMessageCreate("summary", "1", "?draft summary"))
+	if !s.saw("summary", "aren't complete yet") {
+		t.Errorf("summary shown before the teams were complete")
+	}
+
+	completeFakeDraft(t, s, "summary")
+
+	handleMessage(s, fakeMessageCreate("summary", "1", "?draft summary"))
+	sent := s.sentTo("summary")
+	summary := sent[len(sent)-1]
+	for _, expected := range []string{"\\*Friday\\* cup", "Manager: User100", "Team 1 (" + currentCup.Teams[0].Name + "): User1, User3", "Team 2 (" + currentCup.Teams[1].Name + "): User2, User4", " UTC"} {
+		if !strings.Contains(summary, expected) {
+			t.Errorf("summary missing %q:\n%s", expected, summary)
+		}
+	}
+	if strings.Contains(summary, "<@5>") || strings.Contains(summary, "**") {
+		t.Errorf("summary contains mentions or formatting:\n%s", summary)
+	}
+}
+
+func TestFreezeStaysPinned(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "freeze")
+	signUpFakePlayers(s, "freeze", "1", "2", "3", "4")
+	handleMessage(s, fakeMessageCreate("freeze", "100", "?draft freeze"))
+	if len(currentCup.FrozenMessageIDs) != 1 {
+		t.Fatalf("snapshot not recorded: %v", currentCup.FrozenMessageIDs)
+	}
+	frozenID := currentCup.FrozenMessageIDs[0]
+
+	completeFakeDraft(t, s, "freeze")
+	if !s.wasUnpinned(currentCup.StartMessageID) {
+		t.Errorf("start announcement still pinned after the teams were complete")
+	}
+	if s.wasUnpinned(frozenID) {
+		t.Errorf("snapshot unpinned after the teams were complete")
+	}
+}
+
+func TestPinnedReportKept(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "pin")
+	handleMessage(s, fakeMessageCreate("pin", "1", "?draft add"))
+	handleMessage(s, fakeMessageCreate("pin", "100", "?draft pin"))
+	pinnedID := s.pinned[len(s.pinned)-1]
+	if pinnedID == currentCup.StartMessageID || currentCup.LastReplyID == pinnedID {
+		t.Fatalf("report not pinned, or still used as the last reply")
+	}
+
+	handleMessage(s, fakeMessageCreate("pin", "2", "?draft add"))
+	for _, deleted := range s.deleted {
+		if deleted == pinnedID {
+			t.Errorf("pinned report deleted by the next reply")
+		}
+	}
+}
+
+func TestCaptainsFirstAlias(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "captainsfirst")
+	handleMessage(s, fakeMessageCreate("captainsfirst", "100", "?draft captainsfirst on"))
+	if !currentCup.AutoCaptains {
+		t.Errorf("captainsfirst on didn't turn on automatic captains")
+	}
+	handleMessage(s, fakeMessageCreate("captainsfirst", "100", "?draft captains manager"))
+	if currentCup.AutoCaptains {
+		t.Errorf("captains manager didn't turn off automatic captains")
+	}
+	if findCommand("captainsfirst") != &commandCaptains {
+		t.Errorf("captainsfirst not found as an alias of captains")
+	}
+}
+
+func TestHandleLog(t *testing.T) {
+	s := newFakeSession("guild")
+	startFakeCup(t, s, "log")
+	handleMessage(s, fakeMessageCreate("log", "1", "?draft add ```"))
+	handleMessage(s, fakeMessageCreate("log", "100", "?draft log"))
+
+	sent := s.sentTo("log")
+	log := sent[len(sent)-1]
+	if !strings.Contains(log, "User1: ?draft add '''") {
+		t.Errorf("command not logged:\n%s", log)
+	}
+	if count := strings.Count(log, "```"); count != 2 {
+		t.Errorf("log has %d code fences, expected 2:\n%s", count, log)
+	}
+}
+
+func TestSpectatorSignsUp(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "spectate")
+	handleMessage(s, fakeMessageCreate("spectate", "1", "?draft spectate"))
+	if currentCup.findSpectator("1") == -1 {
+		t.Fatal("spectator not recorded")
+	}
+
+	signUpFakePlayers(s, "spectate", "1")
+	if currentCup.findPlayer("1") == -1 || currentCup.findSpectator("1") != -1 {
+		t.Errorf("player still spectating after signing up: %v", currentCup.Spectators)
+	}
+}
+
+func TestCupOutsideAllowedChannels(t *testing.T) {
+	savedConfigs := guildConfigs
+	defer func() { guildConfigs = savedConfigs }()
+	guildConfigs = make(map[string]*GuildConfig)
+
+	s := newFakeSession("guild")
+	command := func(userID string, content string) {
+		m := fakeMessageCreate("moved", userID, content)
+		m.GuildID = "guild"
+		handleMessage(s, m)
+	}
+
+	currentCup := startFakeCup(t, s, "moved")
+	guildConfigs["guild"] = &GuildConfig{GuildID: "guild", AllowedChannels: []string{"elsewhere"}}
+
+	// The cup started before the channel was taken off the list can still be played out
+	command("1", "?draft add")
+	if len(currentCup.Players) != 1 {
+		t.Error("sign-up refused for a cup already running in the channel")
+	}
+	command("100", "?draft abort")
+	if getCup("moved") != nil {
+		t.Fatal("abort refused for a cup already running in the channel")
+	}
+
+	// But no new cup can be started there
+	command("100", "?draft start")
+	if getCup("moved") != nil {
+		t.Error("new cup started outside the allowed channels")
+	}
+	if last := s.sent[len(s.sent)-1].Content; !strings.Contains(last, "can only be run in") {
+		t.Errorf("got %q, expected the allowed channels hint", last)
+	}
+}
+
+func TestHandleSetName(t *testing.T) {
+	savedDir, savedStats := ChannelDataDir, guildStats
+	defer func() {
+		ChannelDataDir, guildStats = savedDir, savedStats
+	}()
+	ChannelDataDir = ""
+	guildStats = make(map[string]*GuildStats)
+
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "setname")
+	signUpFakePlayers(s, "setname", "1", "2", "3", "4")
+
+	handleMessage(s, fakeMessageCreate("setname", "100", "?draft setname 1 @everyone <@5> <@&6>"))
+	if name := currentCup.Players[0].Name; strings.Contains(name, "@everyone") || strings.Contains(name, "<@5>") || strings.Contains(name, "<@&") {
+		t.Errorf("name %q still pings", name)
+	}
+	last := s.sent[len(s.sent)-1].Content
+	if strings.Contains(last, "@everyone") || strings.Contains(last, "<@5>") {
+		t.Errorf("report pings: %q", last)
+	}
+
+	// The new name only applies to this cup
+	completeFakeDraft(t, s, "setname")
+	handleMessage(s, fakeMessageCreate("setname", "100", "?draft game 1"))
+	recorded := false
+	for _, entry := range topPlayers("guild", LeaderboardByWins) {
+		if entry.ID == "1" {
+			recorded = true
+			if entry.Name != "User1" {
+				t.Errorf("renamed player recorded as %q, expected the original name", entry.Name)
+			}
+		}
+	}
+	if !recorded {
+		t.Error("result not recorded")
+	}
+}
+
+func TestSignUpNumberArguments(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "numbers")
+	signUpFakePlayers(s, "numbers", "1", "2", "3", "4")
+	handleMessage(s, fakeMessageCreate("numbers", "1", "?draft leave"))
+
+	// Sign-up numbers stay put when others leave, unlike positions in the list
+	handleMessage(s, fakeMessageCreate("numbers", "100", "?draft setname #2 Second"))
+	if player := &currentCup.Players[0]; player.ID != "2" || player.Name != "Second" {
+		t.Errorf("setname #2 renamed %s to %s, expected User2", player.ID, player.Name)
+	}
+
+	handleMessage(s, fakeMessageCreate("numbers", "100", "?draft kick #3"))
+	if currentCup.findPlayer("3") != -1 || len(currentCup.Players) != 2 {
+		t.Errorf("kick #3 didn't kick User3: %+v", currentCup.Players)
+	}
+
+	handleMessage(s, fakeMessageCreate("numbers", "100", "?draft unban #3"))
+	if len(currentCup.Banned) != 0 {
+		t.Errorf("unban #3 didn't lift the ban: %+v", currentCup.Banned)
+	}
+
+	handleMessage(s, fakeMessageCreate("numbers", "100", "?draft kick #1"))
+	if len(currentCup.Players) != 2 {
+		t.Error("kicked a player by a sign-up number nobody has")
+	}
+}
+
+func TestHandleExtend(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "extend")
+
+	for i := 0; i < 3; i++ {
+		handleMessage(s, fakeMessageCreate("extend", "100", "?draft extend 4800h"))
+	}
+	if currentCup.AbortExtension != MaxDuration {
+		t.Errorf("got an extension of %v, expected it to stop at %v", currentCup.AbortExtension, MaxDuration)
+	}
+	if last := s.sent[len(s.sent)-1].Content; !strings.Contains(last, "can't be extended any further") {
+		t.Errorf("got %q, expected the limit to be explained", last)
+	}
+
+	// Sign-ups start the countdown over, without the extension
+	signUpFakePlayers(s, "extend", "1")
+	if currentCup.AbortExtension != 0 {
+		t.Errorf("extension of %v kept after a sign-up", currentCup.AbortExtension)
+	}
+}
+
+func TestAdminRole(t *testing.T) {
+	s := newFakeSession("guild")
+	s.roles = map[string][]string{"1": {"Regulars"}, "2": {"Regulars", "supervisor"}}
+	startFakeCup(t, s, "admin")
+
+	handleMessage(s, fakeMessageCreate("admin", "1", "?draft abort"))
+	if getCup("admin") == nil {
+		t.Fatal("cup aborted by a player without an admin role")
+	}
+	handleMessage(s, fakeMessageCreate("admin", "2", "?draft abort"))
+	if getCup("admin") != nil {
+		t.Error("cup not aborted by a player with an admin role")
+	}
+}
+
+func TestHandleCompensation(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "compensation")
+
+	handleMessage(s, fakeMessageCreate("compensation", "100", "?draft compensation on"))
+	if currentCup.CompensationPick {
+		t.Error("compensation pick enabled for teams of 2")
+	}
+
+	handleMessage(s, fakeMessageCreate("compensation", "100", "?draft teamsize 4"))
+	handleMessage(s, fakeMessageCreate("compensation", "100", "?draft compensation on"))
+	if !currentCup.CompensationPick {
+		t.Fatal("compensation pick not enabled for teams of 4")
+	}
+	handleMessage(s, fakeMessageCreate("compensation", "100", "?draft teamsize 3"))
+	if currentCup.CompensationPick {
+		t.Error("compensation pick still enabled after shrinking the teams to 3")
+	}
+}
+
+func TestDescribeKeepsStartNote(t *testing.T) {
+	s := newFakeSession("guild")
+	startFakeCup(t, s, "describe")
+	signUpFakePlayers(s, "describe", "1", "2", "3", "4")
+	completeFakeDraft(t, s, "describe")
+
+	handleMessage(s, fakeMessageCreate("describe", "100", "?draft copy"))
+	currentCup := getCup("describe")
+	if currentCup == nil {
+		t.Fatal("cup not copied")
+	}
+	handleMessage(s, fakeMessageCreate("describe", "100", "?draft describe Rematch night"))
+	if len(s.edited) == 0 {
+		t.Fatal("registration message not updated")
+	}
+	edited := s.edited[len(s.edited)-1].Content
+	for _, expected := range []string{"Rematch night", "Players from the previous cup have been signed up again"} {
+		if !strings.Contains(edited, expected) {
+			t.Errorf("registration message missing %q:\n%s", expected, edited)
+		}
+	}
+}
+
+func TestHandleWhoAmI(t *testing.T) {
+	s := newFakeSession("guild")
+	s.roles = map[string][]string{"2": {"supervisor"}}
+	startFakeCup(t, s, "whoami")
+
+	// Discord permissions don't grant cup rights, so they don't unlock the details either
+	handleMessage(s, fakeMessageCreate("whoami", "1", "?draft whoami"))
+	if !s.saw("whoami", "only cup managers and admins") || len(s.sentTo("dm1")) != 0 {
+		t.Errorf("permissions shown to a player without cup rights")
+	}
+
+	handleMessage(s, fakeMessageCreate("whoami", "2", "?draft whoami"))
+	if !s.saw("dm2", "Admin role    : yes (supervisor)") || !s.saw("dm2", "Cup superuser : yes (admin role)") {
+		t.Errorf("admin role not reported: %v", s.sentTo("dm2"))
+	}
+	handleMessage(s, fakeMessageCreate("whoami", "100", "?draft whoami"))
+	if !s.saw("dm100", "Cup superuser : yes (cup manager)") {
+		t.Errorf("manager not reported: %v", s.sentTo("dm100"))
+	}
+}
+
+// Starts a cup with two teams of three and picks both captains and the first player of team 1:
+// users 1 and 3 on team 1, user 2 on team 2, with users 4 to 6 still available.
+func startFakePickup(t *testing.T, s *fakeSession, channelID string) *Cup {
+	currentCup := startFakeCup(t, s, channelID)
+	currentCup.TeamSize = 3
+	signUpFakePlayers(s, channelID, "1", "2", "3", "4", "5", "6")
+	handleMessage(s, fakeMessageCreate(channelID, "100", "?draft close"))
+	handleMessage(s, fakeMessageCreate(channelID, "100", "?draft pick 1"))
+	handleMessage(s, fakeMessageCreate(channelID, "100", "?draft pick 2"))
+	handleMessage(s, fakeMessageCreate(channelID, "1", "?draft pick 3"))
+	if currentCup.Status != CupStatusPickup || currentCup.PickedPlayers != 3 {
+		t.Fatalf("got status %d with %d players picked, expected picking with 3", currentCup.Status, currentCup.PickedPlayers)
+	}
+	return currentCup
+}
+
+func TestHandleUnpick(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakePickup(t, s, "unpick")
+
+	handleMessage(s, fakeMessageCreate("unpick", "1", "?draft unpick 3"))
+	if currentCup.Players[2].Team != 0 {
+		t.Fatal("player returned to the pool by a captain")
+	}
+	handleMessage(s, fakeMessageCreate("unpick", "100", "?draft unpick 4"))
+	if !s.saw("unpick", "hasn't been picked yet") {
+		t.Errorf("unpicking an available player not refused")
+	}
+	handleMessage(s, fakeMessageCreate("unpick", "100", "?draft unpick 2"))
+	if currentCup.Players[1].Team != 1 || !s.saw("unpick", "is the only player on") {
+		t.Errorf("only player of a team returned to the pool")
+	}
+
+	handleMessage(s, fakeMessageCreate("unpick", "100", "?draft unpick 3"))
+	if currentCup.Players[2].Team != -1 || currentCup.PickedPlayers != 2 {
+		t.Fatalf("player not returned to the pool: team %d, %d players picked", currentCup.Players[2].Team, currentCup.PickedPlayers)
+	}
+	if who := currentCup.whoPicks(currentCup.currentPickup()); who == nil || who.ID != "1" {
+		t.Errorf("team 1 not picking again after the unpick: %v", who)
+	}
+
+	// Returning a captain makes the next teammate the captain
+	handleMessage(s, fakeMessageCreate("unpick", "1", "?draft pick 3"))
+	handleMessage(s, fakeMessageCreate("unpick", "100", "?draft unpick #1"))
+	if currentCup.Players[0].Team != -1 || currentCup.Teams[0].First != 2 {
+		t.Fatalf("captain not replaced by the next teammate: first player %d", currentCup.Teams[0].First)
+	}
+	if !s.saw("unpick", "is now the captain of") {
+		t.Errorf("new captain not announced")
+	}
+}
+
+func TestHandleReplaceCaptain(t *testing.T) {
+	s := newFakeSession("guild")
+	currentCup := startFakePickup(t, s, "captain")
+
+	handleMessage(s, fakeMessageCreate("captain", "1", "?draft replacecaptain 1 3"))
+	if currentCup.Teams[0].First != 0 {
+		t.Fatal("captain replaced by a player")
+	}
+	handleMessage(s, fakeMessageCreate("captain", "100", "?draft replacecaptain 3 4"))
+	if !s.saw("captain", "is not a valid team number") {
+		t.Errorf("invalid team number not refused")
+	}
+	handleMessage(s, fakeMessageCreate("captain", "100", "?draft replacecaptain 1 2"))
+	if currentCup.Teams[0].First != 0 || !s.saw("captain", "plays for") {
+		t.Errorf("player from another team made captain")
+	}
+
+	// A teammate takes over as captain, keeping both on the team
+	handleMessage(s, fakeMessageCreate("captain", "100", "?draft replacecaptain 1 3"))
+	if currentCup.Teams[0].First != 2 || currentCup.Players[0].Team != 0 {
+		t.Fatalf("teammate not made captain: first player %d", currentCup.Teams[0].First)
+	}
+
+	// An available player takes over, and the old captain is returned to the pool
+	handleMessage(s, fakeMessageCreate("captain", "100", "?draft replacecaptain 2 5"))
+	if currentCup.Teams[1].First != 4 || currentCup.Players[4].Team != 1 || currentCup.Players[1].Team != -1 {
+		t.Fatalf("available player not made captain: first player %d", currentCup.Teams[1].First)
+	}
+	if who := currentCup.whoPicks(currentCup.currentPickup()); who == nil || who.ID != "5" {
+		t.Errorf("new captain not picking for team 2: %v", who)
+	}
+}
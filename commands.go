@@ -1,6 +1,11 @@
 package main
 
 import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/bwmarrin/discordgo"
 )
 
@@ -13,28 +18,98 @@ type commandGroup struct {
 }
 
 type command struct {
-	group   *commandGroup
-	name    string
-	args    string
-	execute func(string, *discordgo.Session, *discordgo.MessageCreate)
-	help    string
+	group    *commandGroup
+	name     string
+	args     string
+	execute  func(string, DiscordSession, *discordgo.MessageCreate)
+	help     string
+	usage    string   // detailed explanation shown by help <command>, optional
+	examples []string // sample arguments shown by help <command>, optional
+	aliases  []string // other names the command can be invoked by, optional
 }
 
 var (
 	// Note: we don't initialize commands here in order to avoid an initialization loop
 
-	commandHelp     command
-	commandStart    command
-	commandAbort    command
-	commandAdd      command
-	commandRemove   command
-	commandWho      command
-	commandModerate command
-	commandTeamSize command
-	commandClose    command
-	commandPick     command
-	commandPromote  command
-	commandReopen   command
+	commandHelp           command
+	commandStart          command
+	commandAbort          command
+	commandAdd            command
+	commandAddSub         command
+	commandFill           command
+	commandRemove         command
+	commandLeave          command
+	commandWhoLeft        command
+	commandReliability    command
+	commandWho            command
+	commandCount          command
+	commandMe             command
+	commandModerate       command
+	commandTeamSize       command
+	commandMinTeams       command
+	commandCaptains       command
+	commandMaxSubs        command
+	commandCompensation   command
+	commandPasses         command
+	commandCaptainPick    command
+	commandLastPick       command
+	commandAutoClose      command
+	commandPause          command
+	commandOpen           command
+	commandLock           command
+	commandUnlock         command
+	commandClose          command
+	commandShufflePlayers command
+	commandPick           command
+	commandUnpick         command
+	commandSkip           command
+	commandPass           command
+	commandReplaceCaptain command
+	commandPromote        command
+	commandPin            command
+	commandUnpin          command
+	commandFreeze         command
+	commandInvite         command
+	commandAnnounce       command
+	commandRerandomize    command
+	commandSummary        command
+	commandRemind         command
+	commandTime           command
+	commandDescribe       command
+	commandExtend         command
+	commandReopen         command
+	commandReset          command
+	commandMentionTeam    command
+	commandMentionAll     command
+	commandForfeit        command
+	commandGame           command
+	commandBestOf         command
+	commandCopy           command
+	commandRematch        command
+	commandClone          command
+	commandRoll           command
+	commandSearch         command
+	commandLog            command
+	commandPerms          command
+	commandBalance        command
+	commandTopPlayers     command
+	commandSetName        command
+	commandSeed           command
+	commandKick           command
+	commandUnban          command
+	commandLanguage       command
+	commandMention        command
+	commandWhoAmI         command
+	commandConfig         command
+	commandSubscribe      command
+	commandUnsubscribe    command
+	commandSpectate       command
+	commandUnspectate     command
+	commandSpectators     command
+
+	commandAdminReload command
+	commandAdminGuilds command
+	commandAdminCups   command
 
 	draftCommands = commandGroup{
 		prefix:      "?draft",
@@ -44,22 +119,101 @@ var (
 			&commandStart,
 			&commandAbort,
 			&commandAdd,
+			&commandFill,
+			&commandAddSub,
 			&commandRemove,
+			&commandLeave,
+			&commandWhoLeft,
+			&commandReliability,
 			&commandWho,
+			&commandCount,
+			&commandMe,
 			&commandModerate,
 			&commandTeamSize,
+			&commandMinTeams,
+			&commandCaptains,
+			&commandMaxSubs,
+			&commandCompensation,
+			&commandPasses,
+			&commandCaptainPick,
+			&commandLastPick,
+			&commandAutoClose,
+			&commandPause,
+			&commandOpen,
+			&commandLock,
+			&commandUnlock,
 			&commandClose,
+			&commandShufflePlayers,
 			&commandPick,
+			&commandUnpick,
+			&commandSkip,
+			&commandPass,
+			&commandReplaceCaptain,
 			&commandPromote,
+			&commandPin,
+			&commandUnpin,
+			&commandFreeze,
+			&commandInvite,
+			&commandAnnounce,
+			&commandRemind,
+			&commandTime,
+			&commandDescribe,
+			&commandExtend,
 			&commandReopen,
+			&commandReset,
+			&commandRerandomize,
+			&commandMentionTeam,
+			&commandMentionAll,
+			&commandForfeit,
+			&commandGame,
+			&commandBestOf,
+			&commandSummary,
+			&commandCopy,
+			&commandRematch,
+			&commandClone,
+			&commandRoll,
+			&commandSearch,
+			&commandLog,
+			&commandPerms,
+			&commandBalance,
+			&commandTopPlayers,
+			&commandSetName,
+			&commandSeed,
+			&commandKick,
+			&commandUnban,
+			&commandLanguage,
+			&commandMention,
+			&commandWhoAmI,
+			&commandConfig,
+			&commandSubscribe,
+			&commandUnsubscribe,
+			&commandSpectate,
+			&commandUnspectate,
+			&commandSpectators,
+		},
+	}
+
+	adminCommands = commandGroup{
+		prefix:      "?admin",
+		description: "Admin commands (bot owner only)",
+		commands: []*command{
+			&commandAdminReload,
+			&commandAdminGuilds,
+			&commandAdminCups,
 		},
 	}
 
 	commandGroups = [...]*commandGroup{
 		&draftCommands,
+		&adminCommands,
 	}
 )
 
+// Argument for signing up to the only active cup in the guild from another channel
+const (
+	RemoteAddKeyword = "there"
+)
+
 func (cmd *command) syntax() string {
 	return cmd.group.prefix + " " + cmd.name + cmd.args
 }
@@ -68,6 +222,41 @@ func (cmd *command) syntaxNoArgs() string {
 	return cmd.group.prefix + " " + cmd.name
 }
 
+// Returns the command line for the given example arguments
+func (cmd *command) example(args string) string {
+	if len(args) == 0 {
+		return cmd.syntaxNoArgs()
+	}
+	return cmd.syntaxNoArgs() + " " + args
+}
+
+// Returns the command with the given name (with or without the group prefix), or nil if there's none
+func findCommand(name string) *command {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, group := range commandGroups {
+		shortName := strings.TrimSpace(strings.TrimPrefix(name, group.prefix))
+		for _, cmd := range group.commands {
+			if cmd.hasName(shortName) {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true if the command goes by the given name, either its own or an alias
+func (cmd *command) hasName(name string) bool {
+	if cmd.name == name {
+		return true
+	}
+	for _, alias := range cmd.aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (cmd *command) syntaxLength() int {
 	return len(cmd.group.prefix) + 1 + len(cmd.name) + len(cmd.args)
 }
@@ -75,30 +264,113 @@ func (cmd *command) syntaxLength() int {
 ////////////////////////////////////////////////////////////////
 
 // Handle chat messages that don't belong to any command group
-func handleChat(s *discordgo.Session, m *discordgo.MessageCreate) {
+func handleChat(s DiscordSession, m *discordgo.MessageCreate) {
 	currentCup := getCup(m.ChannelID)
-	if currentCup == nil || currentCup.Status == CupStatusInactive || !currentCup.Moderated {
+	if currentCup == nil || currentCup.Status == CupStatusInactive || !currentCup.isModerated(m.Author.ID) {
+		return
+	}
+	if m.Author.Bot && cupOptions.moderationExemptBots {
+		return
+	}
+	if cupOptions.moderationExemptAdmins && currentCup.isSuperUser(s, m.Author.ID) {
 		return
 	}
-	s.ChannelMessageDelete(m.ChannelID, m.ID)
+	if deleteMessage(s, m.ChannelID, m.ID) == nil {
+		sendModerationNotice(s, m, currentCup)
+	}
+}
+
+// Ways of letting users know their messages were removed by moderation
+const (
+	ModerationNoticeOff     = "off"
+	ModerationNoticeDM      = "dm"
+	ModerationNoticeChannel = "channel"
+)
+
+// Timing of moderation notices
+const (
+	ModerationNoticeInterval = 10 * time.Minute // per user and channel
+	ModerationNoticeLifetime = 15 * time.Second // for notices posted in the channel
+)
+
+// Last time each user was notified about moderation in each channel
+var (
+	lockModerationNotices sync.Mutex
+	moderationNotices     = make(map[string]time.Time)
+)
+
+// Explain to the author of a removed message why it was removed, unless we did so recently
+func sendModerationNotice(s DiscordSession, m *discordgo.MessageCreate, currentCup *Cup) {
+	if cupOptions.moderationNotice == ModerationNoticeOff {
+		return
+	}
+
+	key := m.ChannelID + ":" + m.Author.ID
+	now := time.Now()
+
+	lockModerationNotices.Lock()
+	last, found := moderationNotices[key]
+	recent := found && now.Sub(last) < ModerationNoticeInterval
+	if !recent {
+		// Forget notices old enough not to matter anymore, so the map doesn't keep growing
+		for other, notified := range moderationNotices {
+			if now.Sub(notified) >= ModerationNoticeInterval {
+				delete(moderationNotices, other)
+			}
+		}
+		moderationNotices[key] = now
+	}
+	lockModerationNotices.Unlock()
+
+	if recent {
+		return
+	}
+
+	text := "Messages in " + mentionChannel(m.ChannelID) + " are moderated: " + currentCup.moderationDescription() + ".\n"
+	if currentCup.Moderation == ModerationNonPlayers {
+		text += "Type " + bold(commandAdd.syntaxNoArgs()) + " to sign up, or " + bold(commandHelp.syntax()) + " for a list of commands."
+	} else {
+		text += "Type " + bold(commandHelp.syntax()) + " for a list of commands."
+	}
+
+	switch cupOptions.moderationNotice {
+	case ModerationNoticeDM:
+		channel, err := s.UserChannelCreate(m.Author.ID)
+		if err != nil {
+			logWarn("Error creating DM channel:", err)
+			return
+		}
+		_, _ = sendMessage(s, channel.ID, "Hey, "+bold(escape(m.Author.Username))+"! "+text)
+
+	case ModerationNoticeChannel:
+		message, err := sendMessage(s, m.ChannelID, mentionUser(m.Author.ID)+", "+text)
+		if err == nil {
+			time.AfterFunc(ModerationNoticeLifetime, func() {
+				deleteMessage(s, message.ChannelID, message.ID)
+			})
+		}
+	}
 }
 
 ////////////////////////////////////////////////////////////////
 
 func setupDraftCommands() {
 	commandHelp = command{
-		group:   &draftCommands,
-		name:    "help",
-		args:    "",
-		execute: handleHelp,
-		help:    "Show this list",
+		group:    &draftCommands,
+		name:     "help",
+		args:     " [command]",
+		execute:  handleHelp,
+		help:     "Show this list, or details about one command",
+		usage:    "Without arguments, lists all commands. With a command name (e.g. close), explains that command in more detail.",
+		examples: []string{"close"},
 	}
 	commandStart = command{
-		group:   &draftCommands,
-		name:    "start",
-		args:    " [message]",
-		execute: handleStart,
-		help:    "Start a new cup, with an optional description",
+		group:    &draftCommands,
+		name:     "start",
+		args:     " [message]",
+		execute:  handleStart,
+		help:     "Start a new cup, with an optional description",
+		examples: []string{"", "Friday night 4v4, maps picked by the captains"},
 	}
 	commandAbort = command{
 		group:   &draftCommands,
@@ -108,18 +380,64 @@ func setupDraftCommands() {
 		help:    "Abort current cup",
 	}
 	commandAdd = command{
+		group:    &draftCommands,
+		name:     "add",
+		aliases:  []string{"join"},
+		args:     " [there|#channel]",
+		execute:  handleAdd,
+		help:     "Sign up to play in the cup, or in the cup running in another channel on this server",
+		usage:    "Without arguments, signs you up for the cup in this channel.\nWith a channel mention, signs you up for the cup running in that channel, announcing it there. In a channel without a cup, " + RemoteAddKeyword + " does the same for the only cup running on this server.",
+		examples: []string{"", RemoteAddKeyword, "#draft-cup"},
+	}
+	commandFill = command{
+		group:    &draftCommands,
+		name:     "fill",
+		args:     " [count]",
+		execute:  handleFill,
+		help:     "Sign yourself up, or reserve a number of placeholder slots (manager only)",
+		usage:    "Without a count, signs you up like add does.\nWith a count, reserves that many slots for people who haven't signed up yet (at most " + strconv.Itoa(MaxPlaceholders) + " per cup). Reserved slots can be renamed with setname once the players are known, or freed up with remove.",
+		examples: []string{"", "3"},
+	}
+	commandAddSub = command{
+		group:    &draftCommands,
+		name:     "addsub",
+		args:     " <@player>",
+		execute:  handleAddSub,
+		help:     "Register a player as a substitute, who won't be one of the active players (manager only)",
+		usage:    "The player is added at the end of the list and stays a substitute when sign-up closes, however many players signed up.",
+		examples: []string{"@Player"},
+	}
+	commandRemove = command{
+		group:    &draftCommands,
+		name:     "remove",
+		args:     " [number]",
+		execute:  handleRemove,
+		help:     "Remove yourself from the cup (or another player, if admin)",
+		usage:    "Without a number, takes you off the list of players, just like leave.\nWith the number of a player from the list, the cup manager can remove that player instead. Once picking has started, removed players are replaced by a substitute.\nSubstitutes are listed with their sign-up number (e.g. #9), which stays the same when others leave and can be used instead.",
+		examples: []string{"", "5", "#9"},
+	}
+	commandLeave = command{
 		group:   &draftCommands,
-		name:    "add",
+		name:    "leave",
 		args:    "",
-		execute: handleAdd,
-		help:    "Sign up to play in the cup",
+		execute: handleLeave,
+		help:    "Leave the cup, giving up your spot",
 	}
-	commandRemove = command{
+	commandWhoLeft = command{
+		group:   &draftCommands,
+		name:    "wholeft",
+		args:    "",
+		execute: handleWhoLeft,
+		help:    "Show the players who left the cup after signing up (manager or admin only)",
+	}
+	commandReliability = command{
 		group:   &draftCommands,
-		name:    "remove",
-		args:    " [number]",
-		execute: handleRemove,
-		help:    "Remove yourself from the cup (or another player, if admin)",
+		name:    "reliability",
+		args:    "",
+		execute: handleReliability,
+		help:    "Show the players on this server who left cups recently, least reliable first (manager or admin only)",
+		usage: "Leaving a cup after signing up costs a player " + strconv.Itoa(LeavePenalty) + "% reliability, and every cup they stay in until the teams are complete " +
+			"wins back 1/" + strconv.Itoa(PenaltyDecayDivisor) + " of what's missing. When an active player leaves, the most reliable substitute takes the spot.",
 	}
 	commandWho = command{
 		group:   &draftCommands,
@@ -128,33 +446,190 @@ func setupDraftCommands() {
 		execute: handleWho,
 		help:    "Show list of players in cup",
 	}
-	commandModerate = command{
+	commandCount = command{
 		group:   &draftCommands,
-		name:    "moderate",
-		args:    " [on|off]",
-		execute: handleModerate,
-		help:    "Enable/disable or toggle channel moderation when a cup is active",
+		name:    "count",
+		args:    "",
+		execute: handleCount,
+		help:    "Show how many players signed up, without the full list",
+	}
+	commandMe = command{
+		group:   &draftCommands,
+		name:    "me",
+		args:    "",
+		execute: handleMe,
+		help:    "Show your own status in the cup",
+	}
+	commandModerate = command{
+		group:    &draftCommands,
+		name:     "moderate",
+		args:     " [on|off|pickup|others]",
+		execute:  handleModerate,
+		help:     "Change or toggle channel moderation when a cup is active (all, none, only during picking or only non-players)",
+		examples: []string{"", "pickup", "off"},
 	}
 	commandTeamSize = command{
+		group:    &draftCommands,
+		name:     "teamsize",
+		args:     " [number]",
+		execute:  handleTeamSize,
+		help:     "Show current team size and how it changed during the cup, or change it",
+		examples: []string{"5"},
+	}
+	commandMinTeams = command{
+		group:    &draftCommands,
+		name:     "minteams",
+		args:     " [number]",
+		execute:  handleMinTeams,
+		help:     "Show or change the minimum number of teams",
+		examples: []string{"3"},
+	}
+	commandCaptains = command{
+		group:    &draftCommands,
+		name:     "captains",
+		args:     " [manager|auto]",
+		execute:  handleCaptains,
+		help:     "Show or change whether captains are picked by the manager or are the first to sign up",
+		usage:    "With auto, the first players to sign up become captains when sign-up closes. On and off work as well, as in captainsfirst on.",
+		examples: []string{"auto"},
+		aliases:  []string{"captainsfirst"},
+	}
+	commandMaxSubs = command{
+		group:    &draftCommands,
+		name:     "maxsubs",
+		args:     " [number|off]",
+		execute:  handleMaxSubs,
+		help:     "Show or change the maximum number of substitutes",
+		examples: []string{"4", "off"},
+	}
+	commandCompensation = command{
+		group:    &draftCommands,
+		name:     "compensation",
+		args:     " [on|off]",
+		execute:  handleCompensation,
+		help:     "Enable/disable or toggle an extra pick for the team picking last in the first round",
+		usage:    "The team picking last in the first round gets its next player early in the second round, right after the following team's pick, instead of waiting for the third round.\nOnly applies to cups with at least 3 teams of 4 or more players.",
+		examples: []string{"on"},
+	}
+	commandPasses = command{
+		group:    &draftCommands,
+		name:     "passes",
+		args:     " [on|off]",
+		execute:  handlePasses,
+		help:     "Allow/forbid or toggle captains passing once per round",
+		examples: []string{"on"},
+	}
+	commandCaptainPick = command{
+		group:    &draftCommands,
+		name:     "captainpick",
+		args:     " [sequential|reverse|random]",
+		execute:  handleCaptainPick,
+		help:     "Show or change the order in which teams get their captains",
+		usage:    "sequential: captains are picked starting with the first team.\nreverse: captains are picked starting with the last team.\nrandom: the order is chosen at random when sign-up closes.",
+		examples: []string{"random"},
+	}
+	commandLastPick = command{
+		group:    &draftCommands,
+		name:     "lastpick",
+		args:     " [auto|manual]",
+		execute:  handleLastPick,
+		help:     "Show or change whether the last player is assigned automatically or picked like the others",
+		examples: []string{"", "manual"},
+	}
+	commandAutoClose = command{
+		group:    &draftCommands,
+		name:     "autoclose",
+		args:     " [off|players]",
+		execute:  handleAutoClose,
+		help:     "Show or change the number of sign-ups that closes registration automatically",
+		usage:    "With a number of players, registration closes by itself as soon as that many have signed up. Use off to close registration manually again.",
+		examples: []string{"16", "off"},
+	}
+	commandPause = command{
+		group:   &draftCommands,
+		name:    "pause",
+		args:    "",
+		execute: handlePause,
+		help:    "Temporarily stop accepting sign-ups",
+	}
+	commandOpen = command{
 		group:   &draftCommands,
-		name:    "teamsize",
-		args:    " [number]",
-		execute: handleTeamSize,
-		help:    "Show or change current team size",
+		name:    "open",
+		args:    "",
+		execute: handleOpen,
+		help:    "Accept sign-ups again after a pause",
+	}
+	commandLock = command{
+		group:    &draftCommands,
+		name:     "lock",
+		args:     " [strict]",
+		execute:  handleLock,
+		help:     "Freeze the list of players without closing sign-up, optionally keeping players from leaving (manager only)",
+		usage:    "While the roster is locked, nobody can sign up, be removed by the manager or be kicked. Players can still leave, unless the lock is strict.",
+		examples: []string{"", "strict"},
+	}
+	commandUnlock = command{
+		group:   &draftCommands,
+		name:    "unlock",
+		args:    "",
+		execute: handleUnlock,
+		help:    "Let players sign up and leave again after a lock (manager only)",
 	}
 	commandClose = command{
+		group:    &draftCommands,
+		name:     "close",
+		args:     " [number]",
+		execute:  handleClose,
+		help:     "Close cup for sign-ups, optionally keeping only [number] players",
+		usage:    "Closes registration and starts picking.\nWith a number, only the first [number] players to sign up take part, and the others become substitutes. The cup is aborted if fewer players than needed for the minimum number of teams signed up.",
+		examples: []string{"", "12"},
+	}
+	commandShufflePlayers = command{
 		group:   &draftCommands,
-		name:    "close",
-		args:    " [number]",
-		execute: handleClose,
-		help:    "Close cup for sign-ups, optionally keeping only [number] players",
+		name:    "shuffleplayers",
+		args:    "",
+		execute: handleShufflePlayers,
+		help:    "Randomize the order of the players after closing sign-up, before the first pick",
 	}
 	commandPick = command{
+		group:    &draftCommands,
+		name:     "pick",
+		args:     " <number>",
+		execute:  handlePick,
+		help:     "Pick the player with the given number",
+		examples: []string{"7"},
+	}
+	commandUnpick = command{
+		group:    &draftCommands,
+		name:     "unpick",
+		args:     " <number>",
+		execute:  handleUnpick,
+		help:     "Return a picked player to the pool of available players",
+		examples: []string{"7"},
+	}
+	commandSkip = command{
 		group:   &draftCommands,
-		name:    "pick",
-		args:    " <number>",
-		execute: handlePick,
-		help:    "Pick the player with the given number",
+		name:    "skip",
+		args:    "",
+		execute: handleSkip,
+		help:    "Let the next team pick, postponing the current pick until the other teams are done (manager only)",
+		usage:   "Useful when a captain is away for a moment. Captain picks can't be skipped.",
+	}
+	commandPass = command{
+		group:   &draftCommands,
+		name:    "pass",
+		args:    "",
+		execute: handlePass,
+		help:    "Let the next team pick first, making your pick at the end of the round (captains only, if passes are allowed)",
+		usage:   "Each team can pass once per round. There's no time limit on picks, so a passed pick simply waits for the rest of the round.",
+	}
+	commandReplaceCaptain = command{
+		group:    &draftCommands,
+		name:     "replacecaptain",
+		args:     " <team> <number>",
+		execute:  handleReplaceCaptain,
+		help:     "Make a team member or an available player the captain of a team",
+		examples: []string{"2 9"},
 	}
 	commandPromote = command{
 		group:   &draftCommands,
@@ -163,6 +638,76 @@ func setupDraftCommands() {
 		execute: handlePromote,
 		help:    "Promote the cup",
 	}
+	commandPin = command{
+		group:   &draftCommands,
+		name:    "pin",
+		args:    "",
+		execute: handlePin,
+		help:    "Pin the current cup report (manager only)",
+	}
+	commandUnpin = command{
+		group:   &draftCommands,
+		name:    "unpin",
+		args:    "",
+		execute: handleUnpin,
+		help:    "Unpin all of the bot's messages in this channel (manager only)",
+	}
+	commandFreeze = command{
+		group:   &draftCommands,
+		name:    "freeze",
+		args:    "",
+		execute: handleFreeze,
+		help:    "Post a pinned copy of the current teams that later updates won't remove (manager or admin only)",
+	}
+	commandInvite = command{
+		group:    &draftCommands,
+		name:     "invite",
+		args:     " [everyone|channel]",
+		execute:  handleInvite,
+		help:     "Post an invite for the cup, optionally pinging everyone, or set the channel invites are posted to (admin only)",
+		examples: []string{"", "everyone", "#looking-for-game"},
+	}
+	commandAnnounce = command{
+		group:    &draftCommands,
+		name:     "announce",
+		args:     " <#channel> [everyone]",
+		execute:  handleAnnounce,
+		help:     "Post an announcement for the cup in another channel, optionally pinging everyone (manager or admin only)",
+		examples: []string{"#general", "#general everyone"},
+	}
+	commandRemind = command{
+		group:    &draftCommands,
+		name:     "remind",
+		args:     " [delay|cancel]",
+		execute:  handleRemind,
+		help:     "Show, schedule (e.g. 30, 90m, 1h30m) or cancel a reminder for the cup",
+		usage:    "With a delay, such as 30 (minutes), 90m or 1h30m, the bot reminds everyone about the cup once that time has passed. Use cancel to drop the pending reminder, or leave out the arguments to see when it is due.",
+		examples: []string{"30", "1h30m", "cancel"},
+	}
+	commandTime = command{
+		group:   &draftCommands,
+		name:    "time",
+		args:    "",
+		execute: handleTime,
+		help:    "Show all upcoming deadlines for the cup",
+	}
+	commandDescribe = command{
+		group:    &draftCommands,
+		name:     "describe",
+		args:     " [text]",
+		execute:  handleDescribe,
+		help:     "Change the cup description, or remove it if no text is given",
+		examples: []string{"Finals, best of 3", ""},
+	}
+	commandExtend = command{
+		group:    &draftCommands,
+		name:     "extend",
+		args:     " [time]",
+		execute:  handleExtend,
+		help:     "Show or push back the time when an inactive cup gets aborted automatically",
+		usage:    "Cups without sign-up activity are aborted automatically after a while. With a time, such as 30m or 2h, that deadline is pushed back by the given amount, up to a year in total. Extensions only last until the next sign-up or withdrawal.",
+		examples: []string{"2h"},
+	}
 	commandReopen = command{
 		group:   &draftCommands,
 		name:    "reopen",
@@ -170,8 +715,266 @@ func setupDraftCommands() {
 		execute: handleReopen,
 		help:    "Discard current teams and reopen cup for sign-up",
 	}
+	commandReset = command{
+		group:   &draftCommands,
+		name:    "reset",
+		args:    "",
+		execute: handleReset,
+		help:    "Undo all picks and start picking again, keeping the same teams and players",
+	}
+	commandRerandomize = command{
+		group:    &draftCommands,
+		name:     "rerandomize",
+		args:     " <team>",
+		execute:  handleRerandomize,
+		help:     "Give a team a new random name, keeping the other names (manager or team captain only)",
+		examples: []string{"2"},
+	}
+	commandMentionTeam = command{
+		group:    &draftCommands,
+		name:     "mentionteam",
+		args:     " <team>",
+		execute:  handleMentionTeam,
+		help:     "Mention every member of a team (manager or team captain only)",
+		examples: []string{"2"},
+	}
+	commandMentionAll = command{
+		group:   &draftCommands,
+		name:    "mentionall",
+		args:    "",
+		execute: handleMentionAll,
+		help:    "Mention all active players, leaving out substitutes (manager only)",
+		usage:   "Can be used once every " + humanize(MentionAllCooldown) + ".",
+	}
+	commandForfeit = command{
+		group:    &draftCommands,
+		name:     "forfeit",
+		args:     " [team]",
+		execute:  handleForfeit,
+		help:     "Forfeit the cup as a team captain, or declare the winning team (manager only)",
+		usage:    "Team captains can forfeit on behalf of their team; with two teams, the other team wins. The cup manager or an admin can also declare the winning team by giving its number.",
+		examples: []string{"", "2"},
+	}
+	commandGame = command{
+		group:    &draftCommands,
+		name:     "game",
+		args:     " <team>",
+		execute:  handleGame,
+		help:     "Record the winner of a game in the series (manager only)",
+		usage:    "Records a win for the team with the given number. Once a team wins the majority of the games in the series (see bestof), it wins the cup.",
+		examples: []string{"1"},
+	}
+	commandBestOf = command{
+		group:    &draftCommands,
+		name:     "bestof",
+		args:     " [games]",
+		execute:  handleBestOf,
+		help:     "Show or change the number of games in the series (manager only)",
+		usage:    "Sets the number of games in the series, which needs to be odd (e.g. 3 or 5). The first team to win more than half of them wins the cup.",
+		examples: []string{"3"},
+	}
+	commandSummary = command{
+		group:   &draftCommands,
+		name:    "summary",
+		args:    "",
+		execute: handleSummary,
+		help:    "Show a plain recap of the final teams, without mentions, to copy elsewhere",
+		usage:   "Works once the teams are complete, including after the cup has finished.",
+	}
+	commandCopy = command{
+		group:   &draftCommands,
+		name:    "copy",
+		args:    "",
+		execute: handleCopy,
+		help:    "Start a new cup with the players from the last finished one",
+	}
+	commandRematch = command{
+		group:   &draftCommands,
+		name:    "rematch",
+		args:    "",
+		execute: handleRematch,
+		help:    "Start a new cup with the same teams as the last finished one",
+	}
+	commandClone = command{
+		group:    &draftCommands,
+		name:     "clone",
+		args:     " <#channel>",
+		execute:  handleClone,
+		help:     "Start a new cup with the same settings as the cup in another channel",
+		examples: []string{"#draft-eu"},
+	}
+	commandRoll = command{
+		group:    &draftCommands,
+		name:     "roll",
+		args:     " [number]",
+		execute:  handleRoll,
+		help:     "Pick a random number up to [number], or a random player in the cup",
+		examples: []string{"", "6"},
+	}
+	commandSearch = command{
+		group:    &draftCommands,
+		name:     "search",
+		args:     " <text>",
+		execute:  handleSearch,
+		help:     "Find the numbers of players whose name contains the given text",
+		examples: []string{"smith"},
+	}
+	commandLog = command{
+		group:   &draftCommands,
+		name:    "log",
+		args:    "",
+		execute: handleLog,
+		help:    "Show the commands issued during the cup",
+	}
+	commandPerms = command{
+		group:   &draftCommands,
+		name:    "perms",
+		args:    "",
+		execute: handlePerms,
+		help:    "Check whether the bot has the permissions it needs in this channel",
+	}
+	commandBalance = command{
+		group:   &draftCommands,
+		name:    "balance-report",
+		args:    "",
+		execute: handleBalanceReport,
+		help:    "Show the rating of each team and how even they are",
+	}
+	commandTopPlayers = command{
+		group:    &draftCommands,
+		name:     "topplayers",
+		args:     " [count] [wins|rating]",
+		execute:  handleTopPlayers,
+		help:     "Show the best players on this server, by cups won or by rating",
+		usage:    "Shows up to [count] players, ranked by cups won (wins) or by their last known rating (rating), which for seeded players is the rating their seed stands for. Players with the same score share the same rank.",
+		examples: []string{"", "5 rating"},
+	}
+	commandSetName = command{
+		group:    &draftCommands,
+		name:     "setname",
+		args:     " <number> <name>",
+		execute:  handleSetName,
+		help:     "Change the name shown for a player in this cup",
+		examples: []string{"4 Mystery Guest"},
+	}
+	commandSeed = command{
+		group:    &draftCommands,
+		name:     "seed",
+		args:     " <number> <seed>",
+		execute:  handleSeed,
+		help:     "Put a player in a skill tier (1 is the strongest), used when there are no ratings",
+		usage:    "Puts the player with the given number in a skill tier from 1 (strongest) to " + strconv.Itoa(MaxSeed) + ", or none to remove the seed. Seeds are shown in the player list and used in place of ratings for players without one.",
+		examples: []string{"3 1", "3 none"},
+	}
+	commandKick = command{
+		group:    &draftCommands,
+		name:     "kick",
+		args:     " <number>",
+		execute:  handleKick,
+		help:     "Remove a player from the cup and prevent him from signing up again",
+		examples: []string{"8"},
+	}
+	commandUnban = command{
+		group:    &draftCommands,
+		name:     "unban",
+		args:     " [number]",
+		execute:  handleUnban,
+		help:     "Show players kicked from the cup, or allow one of them to sign up again",
+		examples: []string{"", "1"},
+	}
+	commandLanguage = command{
+		group:   &draftCommands,
+		name:    "language",
+		args:    " [code]",
+		execute: handleLanguage,
+		help:    "Show or change the language used for cup reports on this server",
+	}
+	commandMention = command{
+		group:    &draftCommands,
+		name:     "mention",
+		args:     " [everyone|here|none|@role]",
+		execute:  handleMention,
+		help:     "Show or change who gets mentioned in announcements on this server (admin only)",
+		examples: []string{"here", "none"},
+	}
+	commandWhoAmI = command{
+		group:   &draftCommands,
+		name:    "whoami",
+		args:    "",
+		execute: handleWhoAmI,
+		help:    "Send yourself a direct message explaining your cup permissions (managers and admins only)",
+	}
+	commandConfig = command{
+		group:    &draftCommands,
+		name:     "config",
+		args:     " [setting] [value]",
+		execute:  handleConfig,
+		help:     "Show the settings for this server, or change one of them (admin only)",
+		usage:    "Without arguments, shows all the settings for this server. With a setting name, shows that setting; with a value as well, changes it. Use default as the value to reset a setting.",
+		examples: []string{"", "teamsize 5", "teamsize default"},
+	}
+	commandSubscribe = command{
+		group:   &draftCommands,
+		name:    "subscribe",
+		args:    "",
+		execute: handleSubscribe,
+		help:    "Get a direct message whenever a cup starts on this server",
+	}
+	commandUnsubscribe = command{
+		group:   &draftCommands,
+		name:    "unsubscribe",
+		args:    "",
+		execute: handleUnsubscribe,
+		help:    "Stop getting direct messages about new cups",
+	}
+	commandSpectate = command{
+		group:   &draftCommands,
+		name:    "spectate",
+		args:    "",
+		execute: handleSpectate,
+		help:    "Watch the cup without playing, getting the final teams by direct message",
+	}
+	commandUnspectate = command{
+		group:   &draftCommands,
+		name:    "unspectate",
+		args:    "",
+		execute: handleUnspectate,
+		help:    "Stop watching the cup",
+	}
+	commandSpectators = command{
+		group:   &draftCommands,
+		name:    "spectators",
+		args:    "",
+		execute: handleSpectators,
+		help:    "Show who is watching the cup",
+	}
+}
+
+func setupAdminCommands() {
+	commandAdminReload = command{
+		group:   &adminCommands,
+		name:    "reload",
+		args:    "",
+		execute: handleAdminReload,
+		help:    "Reload the server settings from disk, without restarting",
+	}
+	commandAdminGuilds = command{
+		group:   &adminCommands,
+		name:    "guilds",
+		args:    "",
+		execute: handleAdminGuilds,
+		help:    "List the servers the bot is in",
+	}
+	commandAdminCups = command{
+		group:   &adminCommands,
+		name:    "cups",
+		args:    "",
+		execute: handleAdminCups,
+		help:    "List the cups running on all servers",
+	}
 }
 
 func setupCommands() {
 	setupDraftCommands()
+	setupAdminCommands()
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindCommand(t *testing.T) {
+	tests := map[string]*command{
+		"close":         &commandClose,
+		"CLOSE":         &commandClose,
+		"?draft close":  &commandClose,
+		"?admin reload": &commandAdminReload,
+		"reload":        &commandAdminReload,
+		"nonsense":      nil,
+	}
+	for name, expected := range tests {
+		if cmd := findCommand(name); cmd != expected {
+			t.Errorf("findCommand(%q): got %v, expected %v", name, cmd, expected)
+		}
+	}
+}
+
+func TestCommandExamples(t *testing.T) {
+	for _, group := range commandGroups {
+		for _, cmd := range group.commands {
+			mandatory := strings.Contains(cmd.args, "<")
+			for _, example := range cmd.examples {
+				if mandatory && len(example) == 0 {
+					t.Errorf("%s: example without the mandatory arguments", cmd.syntaxNoArgs())
+				}
+				if len(cmd.args) == 0 && len(example) > 0 {
+					t.Errorf("%s: example %q for a command without arguments", cmd.syntaxNoArgs(), example)
+				}
+				if strings.HasPrefix(example, group.prefix) {
+					t.Errorf("%s: example %q should only contain the arguments", cmd.syntaxNoArgs(), example)
+				}
+			}
+		}
+	}
+}
+
+func TestModerationNotice(t *testing.T) {
+	savedNotice := cupOptions.moderationNotice
+	defer func() { cupOptions.moderationNotice = savedNotice }()
+	cupOptions.moderationNotice = ModerationNoticeChannel
+
+	lockModerationNotices.Lock()
+	moderationNotices["stale:1"] = time.Now().Add(-2 * ModerationNoticeInterval)
+	lockModerationNotices.Unlock()
+	defer func() {
+		lockModerationNotices.Lock()
+		delete(moderationNotices, "moderated:7")
+		lockModerationNotices.Unlock()
+	}()
+
+	s := newFakeSession("guild")
+	currentCup := startFakeCup(t, s, "moderated")
+	currentCup.Moderation = ModerationNonPlayers
+	handleMessage(s, fakeMessageCreate("moderated", "7", "hello"))
+	if !s.saw("moderated", "users that haven't signed up") || !s.saw("moderated", "to sign up") {
+		t.Errorf("notice doesn't match the moderation mode:\n%v", s.sentTo("moderated"))
+	}
+
+	lockModerationNotices.Lock()
+	_, stale := moderationNotices["stale:1"]
+	lockModerationNotices.Unlock()
+	if stale {
+		t.Errorf("expired notice not forgotten")
+	}
+}
@@ -2,15 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -20,24 +23,93 @@ const (
 	CupStatusInactive = iota
 	CupStatusSignup   = iota
 	CupStatusPickup   = iota
+	CupStatusReady    = iota
+)
+
+// Moderation modes
+const (
+	ModerationOff        = iota
+	ModerationAll        = iota
+	ModerationPickup     = iota
+	ModerationNonPlayers = iota
+)
+
+// Order in which captains are picked
+const (
+	CaptainOrderSequential = iota
+	CaptainOrderReverse    = iota
+	CaptainOrderRandom     = iota
+)
+
+var (
+	captainOrderNames = [...]string{"sequential", "reverse", "random"}
+)
+
+// Manual seeding, used in place of ratings: each seed is worth SeedRatingStep
+// rating points more than the next one, with the middle seed at the default rating
+const (
+	MaxSeed        = 9
+	SeedRatingStep = 100
+)
+
+// Rating used for players without one
+const (
+	DefaultRating = 1000
+)
+
+// Maximum length of a player name set by the cup manager (same as Discord's nicknames)
+const (
+	MaxPlayerNameLength = 32
+)
+
+// Maximum length of a cup description, leaving enough room for the rest of the messages it appears in
+const (
+	MaxDescriptionLength = 1000
+)
+
+// Placeholder players, reserving slots for people not signed up yet
+const (
+	PlaceholderName = "TBD"
+	MaxPlaceholders = 16
+)
+
+// Minimum time between two mentions of all active players in a cup
+const (
+	MentionAllCooldown = 5 * time.Minute
+)
+
+// Longest series of games that can be played between the same teams
+const (
+	MaxBestOf = 9
 )
 
 // Player counts
 const (
-	DefaultTeamSize = 4
-	MinimumTeams    = 2
+	DefaultTeamSize     = 4
+	DefaultMinimumTeams = 2
 )
 
 // Cup report fields
 const (
-	CupReportTeams      = 1 << iota
-	CupReportPlayers    = 1 << iota
-	CupReportSubs       = 1 << iota
-	CupReportNextAction = 1 << iota
+	CupReportTeams       = 1 << iota
+	CupReportPlayers     = 1 << iota
+	CupReportSubs        = 1 << iota
+	CupReportNextAction  = 1 << iota
+	CupReportDescription = 1 << iota
 
 	CupReportAll = -1
 )
 
+// Reports requested again within this interval update the previous one instead of being re-posted
+const (
+	ReportRefreshInterval = 10 * time.Second
+)
+
+// Maximum number of commands kept in a cup's log
+const (
+	MaxLogEntries = 200
+)
+
 // Minimum amount of time that has to pass between promotions
 const (
 	MinimumPromotionInterval        = time.Hour * 2
@@ -47,10 +119,16 @@ const (
 type (
 	// Player holds data for a signed up user
 	Player struct {
-		Name string
-		ID   string
-		Team int
-		Next int
+		Name    string
+		ID      string
+		Team    int
+		Next    int
+		Rating  int  `json:",omitempty"` // 0 if unknown
+		Seed    int  `json:",omitempty"` // skill tier set by the manager, 1 being the strongest; 0 if unseeded
+		SubOnly bool `json:",omitempty"` // registered by the manager as a substitute, never one of the active players
+		Number  int  `json:",omitempty"` // sign-up number, kept when others leave; 0 for players signed up before it existed
+
+		RealName string `json:",omitempty"` // name the player signed up with, if the manager renamed them for this cup
 	}
 
 	// Team holds data for an assembled team
@@ -58,10 +136,22 @@ type (
 		First int
 		Last  int
 		Name  string
+		Color int
+		Emoji string
 
 		nameIndex int // only used during initialization
 	}
 
+	// LogEntry holds data for a command issued during a cup, or for a change it made
+	LogEntry struct {
+		Time        time.Time
+		UserID      string
+		UserName    string
+		Command     string
+		OldTeamSize int `json:",omitempty"` // set for team size changes, along with NewTeamSize
+		NewTeamSize int `json:",omitempty"`
+	}
+
 	pickupSlot struct {
 		Team   int
 		Player int
@@ -70,30 +160,88 @@ type (
 	// Cup holds data for an ongoing event
 	Cup struct {
 		Status                 int
-		Moderated              bool
+		Moderated              bool // deprecated, replaced by Moderation
+		Moderation             int
 		PickedPlayers          int
 		Manager                Player
 		Players                []Player
+		SignUps                int // number of sign-ups so far, including players who left; used to number players
 		Teams                  []Team
 		ChannelID              string
 		GuildID                string
 		StartMessageID         string
+		StartExtra             string // extra text in the registration message (e.g. copy or rematch notes), kept for re-rendering it
 		LastReplyID            string
+		FrozenMessageIDs       []string // report snapshots pinned by freeze, which stay pinned
 		Description            string
 		StartTime              time.Time
 		NextPromoteTime        time.Time
 		NextPromoteTimeManager time.Time
+		ReminderTime           time.Time
+		LastActivity           time.Time     // last sign-up or withdrawal
+		AbortExtension         time.Duration // added to the stale timeout by the manager since the last activity, up to MaxDuration
 		TeamSize               int
+		MinimumTeams           int
+		AutoCaptains           bool
+		CompensationPick       bool
+		Log                    []LogEntry
+		Banned                 []Player
+		Spectators             []Player // not taking part, but sent the final teams
+		Departures             []Player // players who removed themselves after signing up, in order
+		LimitSubs              bool
+		MaxSubs                int
+		Paused                 bool
+		Locked                 bool  // roster frozen during sign-up: nobody can join or be removed, but players can still leave
+		LockedStrict           bool  // while locked, players can't leave either
+		AutoClose              int   // number of sign-ups that closes registration, 0 if disabled
+		ManualLastPick         bool  // the last player is picked like the others, instead of being assigned automatically
+		CaptainOrder           int   // captain picking mode
+		CaptainSequence        []int // teams in captain picking order, chosen when sign-up closes
+		SkippedPicks           []int // positions in the picking order postponed until the other picks are made
+		AllowPasses            bool  // captains may pass once per round, making their pick at the end of the round
+		PassedPicks            []int // positions in the picking order passed by their team, made at the end of their round
+		Winner                 int   // 1-based team number, 0 if no result was recorded
+		ForfeitedBy            int   // 1-based team number, 0 if no team forfeited
+		BestOf                 int   // number of games in the series, 0 for a single game
+		SeriesScore            []int // games won by each team
+		ResultTime             time.Time
+		VoiceChannelIDs        []string  // temporary voice channels created for the teams
+		VoiceChannelExpiry     time.Time // when the voice channels are deleted, if no result was recorded by then
 
 		longestTeamName        int // for nicer string formatting
 		longestTeamDescription int // ditto
+
+		lastReplyTime   time.Time // when LastReplyID was posted
+		lastReplyText   string    // text of LastReplyID preceding the report
+		lastReplyReport string    // report included in LastReplyID
+
+		sendFailures   int       // consecutive messages that couldn't be sent due to lost access
+		lastMentionAll time.Time // when all active players were last mentioned
+	}
+)
+
+// Team colors, in order of assignment
+var (
+	TeamColors = [...]struct {
+		Value int
+		Emoji string
+	}{
+		{0xDD2E44, "\U0001F534"}, // red
+		{0x55ACEE, "\U0001F535"}, // blue
+		{0x78B159, "\U0001F7E2"}, // green
+		{0xFDCB58, "\U0001F7E1"}, // yellow
+		{0xAA8ED6, "\U0001F7E3"}, // purple
+		{0xF4900C, "\U0001F7E0"}, // orange
+		{0xC1694F, "\U0001F7E4"}, // brown
 	}
 )
 
 var (
 	lockCups   sync.Mutex
 	activeCups = make(map[string]*Cup)
-	done       = make(chan bool)
+	// Last completed cup in each channel, kept around for reuse
+	finishedCups = make(map[string]*Cup)
+	done         = make(chan bool)
 )
 
 ////////////////////////////////////////////////////////////////
@@ -107,160 +255,1019 @@ func makePlayer(user *discordgo.User) Player {
 	}
 }
 
+// Like makePlayer, but using the user's nickname in the given guild, if any
+func makeMemberPlayer(s DiscordSession, guildID string, user *discordgo.User) Player {
+	player := makePlayer(user)
+	player.Name = memberName(s, guildID, user)
+	return player
+}
+
+// How long guild member names are cached
+const (
+	MemberNameCacheDuration = 10 * time.Minute
+)
+
+type cachedMemberName struct {
+	Name string
+	Time time.Time
+}
+
+// Cached guild member names, to avoid excessive API calls
+var (
+	lockMemberNames sync.Mutex
+	memberNames     = make(map[string]cachedMemberName)
+)
+
+// Returns the name a user goes by in the given guild: the nickname if set, or the username otherwise
+func memberName(s DiscordSession, guildID string, user *discordgo.User) string {
+	if len(guildID) == 0 {
+		return user.Username
+	}
+
+	key := guildID + ":" + user.ID
+	now := time.Now()
+
+	lockMemberNames.Lock()
+	cached, found := memberNames[key]
+	lockMemberNames.Unlock()
+	if found && now.Sub(cached.Time) < MemberNameCacheDuration {
+		return cached.Name
+	}
+
+	member, err := s.StateMember(guildID, user.ID)
+	if err != nil {
+		member, err = s.GuildMember(guildID, user.ID)
+	}
+	if err != nil {
+		logWarn(logGuild(guildID), "Error retrieving guild member:", err)
+		return user.Username
+	}
+
+	name := user.Username
+	if len(member.Nick) > 0 {
+		name = member.Nick
+	}
+
+	lockMemberNames.Lock()
+	memberNames[key] = cachedMemberName{name, now}
+	lockMemberNames.Unlock()
+
+	return name
+}
+
+// Returns a player reserving a slot, without an associated user
+func makePlaceholder(number int) Player {
+	return Player{
+		Name: PlaceholderName + " " + strconv.Itoa(number),
+		Team: -1,
+		Next: -1,
+	}
+}
+
+func (player *Player) isPlaceholder() bool {
+	return len(player.ID) == 0
+}
+
 func (player *Player) resetTeam() {
 	player.Team = -1
 	player.Next = -1
 }
 
-func mention(who *Player) string {
-	return mentionUser(who.ID)
+// Undoes a rename by the manager, which only applies to the cup it was made in
+func (player *Player) restoreName() {
+	if len(player.RealName) > 0 {
+		player.Name = player.RealName
+		player.RealName = ""
+	}
+}
+
+func (player *Player) effectiveRating() int {
+	if player.Rating == 0 {
+		if player.Seed > 0 {
+			return DefaultRating + ((MaxSeed+1)/2-player.Seed)*SeedRatingStep
+		}
+		return DefaultRating
+	}
+	return player.Rating
+}
+
+func mention(who *Player) string {
+	if who.isPlaceholder() {
+		return display(who)
+	}
+	return mentionUser(who.ID)
+}
+
+func display(who *Player) string {
+	return bold(escape(who.Name))
+}
+
+// Number of trailing user ID digits used to tell apart players with the same name
+const (
+	NameDiscriminatorDigits = 4
+)
+
+// Returns the player name, followed by the last digits of the user ID if another player in the cup
+// has the same name (e.g. "Player #1234"). Mentions keep using the ID, so they're never ambiguous.
+func (currentCup *Cup) distinctName(who *Player) string {
+	if len(who.ID) == 0 {
+		return who.Name // placeholders are numbered already
+	}
+	for i := range currentCup.Players {
+		other := &currentCup.Players[i]
+		if other.Name == who.Name && other.ID != who.ID {
+			suffix := who.ID
+			if len(suffix) > NameDiscriminatorDigits {
+				suffix = suffix[len(suffix)-NameDiscriminatorDigits:]
+			}
+			return who.Name + " #" + suffix
+		}
+	}
+	return who.Name
+}
+
+// Like display, but tells apart players with the same name
+func (currentCup *Cup) display(who *Player) string {
+	return bold(escape(currentCup.distinctName(who)))
+}
+
+////////////////////////////////////////////////////////////////
+
+func (currentTeam *Team) resetTeam() {
+	currentTeam.First = -1
+	currentTeam.Last = -1
+	currentTeam.Name = ""
+	currentTeam.Color = 0
+	currentTeam.Emoji = ""
+	currentTeam.nameIndex = -1
+}
+
+// Returns the team name, prefixed by its color emoji (if any)
+func (currentTeam *Team) coloredName() string {
+	if len(currentTeam.Emoji) == 0 {
+		return currentTeam.Name
+	}
+	return currentTeam.Emoji + " " + currentTeam.Name
+}
+
+////////////////////////////////////////////////////////////////
+
+func getCup(channelID string) *Cup {
+	lockCups.Lock()
+	currentCup := activeCups[channelID]
+	lockCups.Unlock()
+	return currentCup
+}
+
+// Creates a new cup in the given channel, using the defaults configured for the guild
+func addCup(s DiscordSession, channelID string, guildID string) *Cup {
+	config := getGuildConfig(guildID)
+
+	currentCup := new(Cup)
+	currentCup.Status = CupStatusSignup
+	currentCup.ChannelID = channelID
+	currentCup.GuildID = guildID
+	currentCup.TeamSize = config.teamSize()
+	currentCup.MinimumTeams = cupOptions.minimumTeams
+	if config.MinimumTeams != 0 {
+		currentCup.MinimumTeams = config.MinimumTeams
+	}
+
+	lockCups.Lock()
+	activeCups[channelID] = currentCup
+	lockCups.Unlock()
+
+	scheduleBotStatusUpdate(s)
+
+	return currentCup
+}
+
+func deleteCup(s DiscordSession, channelID string) {
+	lockCups.Lock()
+	delete(activeCups, channelID)
+	lockCups.Unlock()
+
+	scheduleBotStatusUpdate(s)
+}
+
+// Number of consecutive failed messages, due to lost access, after which a cup is dropped
+const (
+	MaxSendFailures = 3
+)
+
+// Keeps track of messages that couldn't be sent to the channel of an active cup.
+// After repeated failures due to lost access, the cup is saved separately and dropped.
+func noteSendResult(s DiscordSession, channelID string, err error) {
+	currentCup := getCup(channelID)
+	if currentCup == nil {
+		return
+	}
+	if err == nil || !isAccessLost(err) {
+		currentCup.sendFailures = 0
+		return
+	}
+
+	currentCup.sendFailures++
+	if currentCup.sendFailures < MaxSendFailures {
+		return
+	}
+
+	logWarn(logChannel(channelID), logGuild(currentCup.GuildID), "Lost access to the channel, dropping cup")
+	if len(ChannelDataDir) > 0 {
+		if err := currentCup.setAside(SetAsideOrphaned); err != nil {
+			logError(logChannel(channelID), "Error saving dropped cup:", err)
+		}
+	}
+	deleteCup(s, channelID)
+}
+
+func activeCupCount() int {
+	lockCups.Lock()
+	defer lockCups.Unlock()
+	return len(activeCups)
+}
+
+// Moves the cup in the given channel from the active list to the finished one
+func finishCup(s DiscordSession, channelID string) {
+	lockCups.Lock()
+	currentCup := activeCups[channelID]
+	previous := finishedCups[channelID]
+	if currentCup != nil {
+		finishedCups[channelID] = currentCup
+		delete(activeCups, channelID)
+	}
+	lockCups.Unlock()
+
+	// The cup replaced in the finished list won't be played anymore
+	if currentCup != nil && previous != nil {
+		previous.deleteVoiceChannels(s)
+	}
+
+	scheduleBotStatusUpdate(s)
+}
+
+func getFinishedCup(channelID string) *Cup {
+	lockCups.Lock()
+	currentCup := finishedCups[channelID]
+	lockCups.Unlock()
+	return currentCup
+}
+
+// Creates a new cup in the message's channel, managed by the message author
+func startCup(s DiscordSession, m *discordgo.MessageCreate, description string) *Cup {
+	currentCup := addCup(s, m.ChannelID, channelGuildID(s, m.ChannelID))
+	currentCup.Description = description
+	currentCup.LastActivity = time.Now()
+
+	currentCup.Manager = makeMemberPlayer(s, currentCup.GuildID, m.Author)
+
+	return currentCup
+}
+
+// Turns a cup description given by a user into the form stored in the cup, with formatting escaped.
+// Fails if the result is too long.
+func parseDescription(text string) (string, error) {
+	description := escape(strings.TrimSpace(text))
+	if length := utf8.RuneCountInString(description); length > MaxDescriptionLength {
+		return "", fmt.Errorf("the cup description can't be longer than %d characters (yours has %d)", MaxDescriptionLength, length)
+	}
+	return description, nil
+}
+
+// Returns the cup description, shortened if needed so it can't push messages over Discord's limit
+func (currentCup *Cup) shortDescription() string {
+	return truncate(currentCup.Description, MaxDescriptionLength)
+}
+
+// Returns the registration message for the cup, with the given extra text before the sign-up hint
+func (currentCup *Cup) announcement(extra string) string {
+	text := announceGreeting(currentCup.GuildID) + "Registration is now open for a new draft cup, managed by " + display(&currentCup.Manager) + ".\n\n"
+	if len(currentCup.Description) > 0 {
+		text += currentCup.shortDescription() + "\n\n"
+	}
+	text += extra
+	text += "You can sign up now by typing " + bold(commandAdd.syntaxNoArgs())
+	return text
+}
+
+// Sends and pins the registration message for a newly started cup.
+// If the message can't be sent, the cup is aborted and false is returned.
+func (currentCup *Cup) announceStart(s DiscordSession, m *discordgo.MessageCreate, extra string) bool {
+	text := currentCup.announcement(extra)
+
+	currentCup.StartTime = time.Now()
+	currentCup.resetPromoteTimes(currentCup.StartTime)
+
+	deleteCommand(s, m)
+	message, err := sendMessage(s, currentCup.ChannelID, text)
+	if err != nil {
+		logError(logChannel(currentCup.ChannelID), "Unable to send cup start message, aborting cup:", err)
+		deleteCup(s, currentCup.ChannelID)
+		return false
+	}
+
+	currentCup.unpinAll(s)
+	currentCup.StartMessageID = message.ID
+	currentCup.StartExtra = extra
+	pinMessage(s, currentCup.ChannelID, message.ID)
+
+	currentCup.notifyWebhook(WebhookEventStart)
+	currentCup.notifySubscribers(s)
+	return true
+}
+
+// Returns the active players that are no longer members of the cup's guild
+func (currentCup *Cup) absentPlayers(s DiscordSession) []*Player {
+	var absent []*Player
+	numActive := currentCup.activePlayerCount()
+	for i := 0; i < numActive && i < len(currentCup.Players); i++ {
+		player := &currentCup.Players[i]
+		if player.isPlaceholder() {
+			continue
+		}
+		_, err := s.GuildMember(currentCup.GuildID, player.ID)
+		if err != nil {
+			absent = append(absent, player)
+		}
+	}
+	return absent
+}
+
+// Changes the team size, recording the change in the cup log so it can be reviewed after closing and reopening sign-up
+func (currentCup *Cup) recordTeamSizeChange(user *discordgo.User, newSize int) {
+	currentCup.appendLog(LogEntry{
+		Time:        time.Now(),
+		UserID:      user.ID,
+		UserName:    user.Username,
+		Command:     "team size changed from " + strconv.Itoa(currentCup.TeamSize) + " to " + strconv.Itoa(newSize),
+		OldTeamSize: currentCup.TeamSize,
+		NewTeamSize: newSize,
+	})
+	currentCup.TeamSize = newSize
+}
+
+// Returns the history of team size changes still in the cup log, one per line
+func (currentCup *Cup) teamSizeHistory() string {
+	history := ""
+	for _, entry := range currentCup.Log {
+		if entry.NewTeamSize > 0 {
+			history += entry.Time.UTC().Format("2006-01-02 15:04:05") + " " + entry.UserName + ": " + strconv.Itoa(entry.OldTeamSize) + " -> " + strconv.Itoa(entry.NewTeamSize) + "\n"
+		}
+	}
+	return history
+}
+
+// Appends a command to the cup log
+func (currentCup *Cup) logCommand(user *discordgo.User, command string) {
+	currentCup.appendLog(LogEntry{
+		Time:     time.Now(),
+		UserID:   user.ID,
+		UserName: user.Username,
+		Command:  command,
+	})
+}
+
+// Appends an entry to the cup log, discarding the oldest entries if needed
+func (currentCup *Cup) appendLog(entry LogEntry) {
+	currentCup.Log = append(currentCup.Log, entry)
+	if excess := len(currentCup.Log) - MaxLogEntries; excess > 0 {
+		currentCup.Log = append(currentCup.Log[:0], currentCup.Log[excess:]...)
+	}
+}
+
+func (currentCup *Cup) placeholderCount() int {
+	count := 0
+	for i := range currentCup.Players {
+		if currentCup.Players[i].isPlaceholder() {
+			count++
+		}
+	}
+	return count
+}
+
+func (currentCup *Cup) findPlayer(id string) int {
+	if len(id) == 0 {
+		return -1 // placeholders can't be looked up
+	}
+	for i := range currentCup.Players {
+		if currentCup.Players[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (currentCup *Cup) isBanned(id string) bool {
+	for i := range currentCup.Banned {
+		if currentCup.Banned[i].ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the index of the spectator with the given ID, or -1 if not found
+func (currentCup *Cup) findSpectator(id string) int {
+	for i := range currentCup.Spectators {
+		if currentCup.Spectators[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Removes the spectator with the given ID. Returns false if there's no such spectator.
+func (currentCup *Cup) removeSpectator(id string) bool {
+	index := currentCup.findSpectator(id)
+	if index == -1 {
+		return false
+	}
+	currentCup.Spectators = append(currentCup.Spectators[:index:index], currentCup.Spectators[index+1:]...)
+	return true
+}
+
+// Cross-posts the final teams to the results channel configured for the guild, if any
+func (currentCup *Cup) postResults(s DiscordSession) {
+	resultsID := getGuildConfig(currentCup.GuildID).ResultsChannelID
+	if len(resultsID) == 0 || resultsID == currentCup.ChannelID {
+		return
+	}
+
+	text := "Teams for the draft cup in " + mentionChannel(currentCup.ChannelID) + ", managed by " + display(&currentCup.Manager) +
+		" (" + time.Now().UTC().Format("2006-01-02 15:04") + " UTC):\n\n"
+	if len(currentCup.Description) > 0 {
+		text += defuseMentions(currentCup.shortDescription()) + "\n\n"
+	}
+	text += currentCup.report(CupReportTeams)
+
+	if _, err := sendMessage(s, resultsID, text); err != nil {
+		logWarn(logChannel(currentCup.ChannelID), "Could not post results to", resultsID+":", err)
+	}
+}
+
+// Sends the final teams to everyone watching the cup, then forgets about them
+func (currentCup *Cup) notifySpectators(s DiscordSession) {
+	spectators := currentCup.Spectators
+	currentCup.Spectators = nil
+	if len(spectators) == 0 {
+		return
+	}
+
+	text := "The teams for the cup in " + mentionChannel(currentCup.ChannelID) + " are complete!\n\n"
+	if len(currentCup.Description) > 0 {
+		text += currentCup.shortDescription() + "\n\n"
+	}
+	text += currentCup.report(CupReportTeams)
+
+	channelID := currentCup.ChannelID
+	go func() {
+		for i := range spectators {
+			channel, err := s.UserChannelCreate(spectators[i].ID)
+			if err == nil {
+				// Users may have DMs turned off, so failures are only logged
+				_, err = s.ChannelMessageSend(channel.ID, text)
+			}
+			if err != nil {
+				logDebug(logChannel(channelID), "Could not notify spectator", spectators[i].ID+":", err)
+			}
+			time.Sleep(SubscriberNotificationInterval)
+		}
+	}()
+}
+
+// Returns true if the list of players can't change at the moment, except for players leaving (unless strict)
+func (currentCup *Cup) rosterLocked() bool {
+	return currentCup.Status == CupStatusSignup && currentCup.Locked
+}
+
+// Signs up the given player, giving him the next sign-up number
+func (currentCup *Cup) addPlayer(player Player) {
+	// Players get the final teams anyway, so they stop spectating
+	currentCup.removeSpectator(player.ID)
+	currentCup.SignUps++
+	player.Number = currentCup.SignUps
+	currentCup.Players = append(currentCup.Players, player)
+}
+
+// Returns the index of the player referred to by the given token: either a position in the
+// list of players (e.g. 3) or a sign-up number (e.g. #9), as shown for substitutes.
+func (currentCup *Cup) parsePlayerNumber(token string) (int, error) {
+	return parsePlayerNumberIn(currentCup.Players, token)
+}
+
+// Same as parsePlayerNumber, but for the given list of players (e.g. the kicked ones)
+func parsePlayerNumberIn(players []Player, token string) (int, error) {
+	if strings.HasPrefix(token, "#") {
+		number, err := strconv.Atoi(token[1:])
+		if err != nil {
+			return -1, fmt.Errorf("'%s' doesn't look like a sign-up number", token)
+		}
+		for i := range players {
+			if number > 0 && players[i].Number == number {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("nobody in the cup has sign-up number %s", token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return -1, fmt.Errorf("'%s' doesn't look like a number", token)
+	}
+	if index < 1 || index > len(players) {
+		return -1, fmt.Errorf("%s is not a valid player number", token)
+	}
+	return index - 1, nil
+}
+
+// Returns the label a substitute is listed with: his sign-up number, which doesn't change as others leave
+func (player *Player) subLabel(index int) string {
+	if player.Number > 0 {
+		return "#" + strconv.Itoa(player.Number)
+	}
+	return strconv.Itoa(index + 1)
+}
+
+// Removes the player with the given index from the cup.
+// Once picking has begun, active players are replaced by the first substitute, and the removal is announced
+// (e.g. "<player> has left the cup"). Returns false, after letting the user know, if there's no substitute available.
+func (currentCup *Cup) removePlayer(s DiscordSession, m *discordgo.MessageCreate, which int, verb string) bool {
+	if currentCup.Status >= CupStatusPickup {
+		active := currentCup.activePlayerCount()
+		player := &currentCup.Players[which]
+
+		// if the player to be removed isn't a substitute
+		if which < active {
+			// ...but a substitute is available
+			if active < len(currentCup.Players) {
+				subIndex := currentCup.mostReliableSub()
+				sub := &currentCup.Players[subIndex]
+				sub.ID, player.ID = player.ID, sub.ID
+				sub.Name, player.Name = player.Name, sub.Name
+				sub.Rating, player.Rating = player.Rating, sub.Rating
+				sub.Seed, player.Seed = player.Seed, sub.Seed
+				sub.Number, player.Number = player.Number, sub.Number
+				sub.RealName, player.RealName = player.RealName, sub.RealName
+				which = subIndex
+				message := mention(sub) + " " + verb + " the cup and " + mention(player) + " will take his place."
+				sendMessage(s, m.ChannelID, message)
+			} else {
+				var target string
+				if m.Author.ID == player.ID {
+					target = "you"
+				} else {
+					target = mention(player)
+				}
+
+				message := bold(escape(m.Author.Username)) + ", there's no substitute available to replace " + target +
+					".\nYou need to find a substitute first and have him sign up by typing " + bold(commandAdd.syntaxNoArgs())
+				sendMessage(s, m.ChannelID, message)
+				return false
+			}
+		} else {
+			message := mention(player) + " " + verb + " the cup."
+			sendMessage(s, m.ChannelID, message)
+		}
+	}
+
+	currentCup.Players = append(currentCup.Players[:which], currentCup.Players[which+1:]...)
+	currentCup.noteActivity()
+	return true
+}
+
+// Returns the index of the substitute to promote when an active player drops out:
+// the most reliable one, or the first to sign up among equally reliable ones.
+// Returns -1 if there are no substitutes.
+func (currentCup *Cup) mostReliableSub() int {
+	best, bestReliability := -1, -1
+	for i := currentCup.activePlayerCount(); i < len(currentCup.Players); i++ {
+		reliability := playerReliability(currentCup.GuildID, currentCup.Players[i].ID)
+		if reliability > bestReliability {
+			best, bestReliability = i, reliability
+		}
+	}
+	return best
+}
+
+// Returns the nth player in the list of active players
+// that hasn't been assigned to a team yet, or -1 if none.
+// Note: subs are not taken into consideration
+func (currentCup *Cup) findAvailablePlayer(nth int) int {
+	numActive := currentCup.activePlayerCount()
+	if nth < 0 || nth > numActive {
+		return -1
+	}
+	for i := 0; i < numActive; i++ {
+		player := &currentCup.Players[i]
+		if player.Team == -1 {
+			if nth == 0 {
+				return i
+			}
+			nth--
+		}
+	}
+	return -1
+}
+
+func (currentCup *Cup) nextAvailablePlayer() int {
+	return currentCup.findAvailablePlayer(0)
+}
+
+func (currentCup *Cup) isManager(id string) bool {
+	return currentCup.Status != CupStatusInactive && currentCup.Manager.ID == id
+}
+
+func (currentCup *Cup) isSuperUser(s DiscordSession, id string) bool {
+	// Check cup manager first
+	if currentCup.isManager(id) {
+		return true
+	}
+
+	// If not the manager, check for an appropriate role
+	return isAdmin(s, currentCup.GuildID, id)
+}
+
+func (currentCup *Cup) targetPlayerCount() int {
+	target := currentCup.playingCount()
+	target += currentCup.TeamSize - 1
+	target -= target % currentCup.TeamSize
+	minPlayers := currentCup.minPlayerCount()
+	if target < minPlayers {
+		target = minPlayers
+	}
+	return target
+}
+
+// Returns true if enough players signed up to close registration automatically
+func (currentCup *Cup) shouldAutoClose() bool {
+	return currentCup.Status == CupStatusSignup &&
+		currentCup.AutoClose > 0 &&
+		currentCup.AutoClose >= currentCup.minPlayerCount() &&
+		currentCup.playingCount() >= currentCup.AutoClose
+}
+
+// Closes registration if enough players signed up, prefixing the closing report with the given text.
+// Returns true if the cup was closed.
+func (currentCup *Cup) autoCloseIfFull(s DiscordSession, text string) bool {
+	if !currentCup.shouldAutoClose() {
+		return false
+	}
+	currentCup.closeSignup(s, currentCup.AutoClose, text+"The cup is full with "+numbered(currentCup.AutoClose, "player")+", so registration is now closed automatically.\n\n")
+	return true
+}
+
+// Returns the number of players that can be on a team, i.e. everyone not registered as a substitute only
+func (currentCup *Cup) playingCount() int {
+	count := 0
+	for i := range currentCup.Players {
+		if !currentCup.Players[i].SubOnly {
+			count++
+		}
+	}
+	return count
+}
+
+// Moves the players registered as substitutes only after everyone else, keeping the order otherwise
+func (currentCup *Cup) moveSubOnlyLast() {
+	sort.SliceStable(currentCup.Players, func(i, j int) bool {
+		return !currentCup.Players[i].SubOnly && currentCup.Players[j].SubOnly
+	})
+}
+
+func (currentCup *Cup) activePlayerCount() int {
+	return len(currentCup.Teams) * currentCup.TeamSize
+}
+
+// Returns the number of players that would be active if sign-up closed now,
+// i.e. everyone who fits on a full team (or everyone, if there aren't enough players for the minimum number of teams)
+func (currentCup *Cup) signupActiveCount() int {
+	playing := currentCup.playingCount()
+	active := playing - playing%currentCup.TeamSize
+	if active < currentCup.minPlayerCount() {
+		active = playing
+	}
+	return active
 }
 
-func display(who *Player) string {
-	return bold(escape(who.Name))
+// Describes how the players signed up so far are split into active players and substitutes
+// after a team size change, given the number of active players before it
+func (currentCup *Cup) teamSizeChangeSummary(activeBefore int) string {
+	total := len(currentCup.Players)
+	active := currentCup.signupActiveCount()
+	if active < currentCup.minPlayerCount() {
+		return "There aren't enough players for " + numbered(currentCup.MinimumTeams, "team") + " of " + strconv.Itoa(currentCup.TeamSize) + " yet (" +
+			numbered(total, "player") + " signed up, " + strconv.Itoa(currentCup.minPlayerCount()) + " needed)."
+	}
+
+	text := "If sign-up closed now, that would make " + numbered(active/currentCup.TeamSize, "team") + " (" + numbered(active, "active player") +
+		") and " + numbered(total-active, "substitute")
+	if active != activeBefore {
+		text += ", instead of " + numbered(activeBefore, "active player") + " and " + numbered(total-activeBefore, "substitute")
+	}
+	return text + "."
 }
 
-////////////////////////////////////////////////////////////////
+// Returns a one-line summary of how many players signed up, for a quick headcount
+func (currentCup *Cup) headcount() string {
+	total := len(currentCup.Players)
+	var active int
+	if currentCup.Status == CupStatusSignup {
+		active = currentCup.signupActiveCount()
+	} else {
+		active = currentCup.activePlayerCount()
+		if active > total {
+			active = total
+		}
+	}
 
-func (currentTeam *Team) resetTeam() {
-	currentTeam.First = -1
-	currentTeam.Last = -1
-	currentTeam.Name = ""
-	currentTeam.nameIndex = -1
+	text := bold(strconv.Itoa(total)) + " signed up: " + numbered(active, "active player") + ", " + numbered(total-active, "substitute")
+	if currentCup.Status == CupStatusSignup {
+		text += ", target " + strconv.Itoa(currentCup.targetPlayerCount())
+	} else {
+		text += ", " + strconv.Itoa(currentCup.PickedPlayers) + " picked"
+	}
+	return text + "."
 }
 
-////////////////////////////////////////////////////////////////
+// Randomizes the order of the players taking part in the draft, leaving substitutes in place.
+// Must only be called before any picks are made.
+func (currentCup *Cup) shufflePlayers() {
+	active := currentCup.activePlayerCount()
+	if active > len(currentCup.Players) {
+		active = len(currentCup.Players)
+	}
+	rand.Shuffle(active, func(i, j int) {
+		currentCup.Players[i], currentCup.Players[j] = currentCup.Players[j], currentCup.Players[i]
+	})
+}
 
-func getCup(channelID string) *Cup {
-	lockCups.Lock()
-	currentCup := activeCups[channelID]
-	lockCups.Unlock()
-	return currentCup
+func (currentCup *Cup) subCount() int {
+	subs := len(currentCup.Players) - currentCup.activePlayerCount()
+	if subs < 0 {
+		return 0
+	}
+	return subs
 }
 
-func addCup(channelID string) *Cup {
-	currentCup := new(Cup)
-	currentCup.Status = CupStatusSignup
-	currentCup.ChannelID = channelID
-	currentCup.TeamSize = DefaultTeamSize
+// Returns true if no more substitutes are accepted
+func (currentCup *Cup) subsFull() bool {
+	return currentCup.LimitSubs && currentCup.subCount() >= currentCup.MaxSubs
+}
 
-	lockCups.Lock()
-	activeCups[channelID] = currentCup
-	lockCups.Unlock()
+func (currentCup *Cup) minPlayerCount() int {
+	return currentCup.TeamSize * currentCup.MinimumTeams
+}
 
-	return currentCup
+// Returns the smallest allowed value for the minimum number of teams
+func lowestMinimumTeams() int {
+	if cupOptions.allowSingleTeam {
+		return 1
+	}
+	return DefaultMinimumTeams
 }
 
-func deleteCup(channelID string) {
-	lockCups.Lock()
-	delete(activeCups, channelID)
-	lockCups.Unlock()
+// Returns the first slot in picking order that hasn't been filled yet.
+// Normally, this is the slot for the next pick, but it also covers players returned to the pool.
+func (currentCup *Cup) currentPickup() pickupSlot {
+	slot, _ := currentCup.currentPickupIndex()
+	return slot
 }
 
-func (currentCup *Cup) findPlayer(id string) int {
+// Returns the regular picking order of the cup, with the captain order applied
+func (currentCup *Cup) pickSequence() []pickupSlot {
+	numTeams := len(currentCup.Teams)
+	sequence := pickupSequence(numTeams, currentCup.TeamSize, currentCup.CompensationPick)
+	applyCaptainSequence(sequence, currentCup.CaptainSequence, numTeams)
+	return sequence
+}
+
+// Returns the first slot in picking order that hasn't been filled yet, and its position in the
+// regular picking order (-1 if all slots are filled). Passed picks come at the end of their round,
+// skipped picks after all the others, in the order they were passed or skipped; each team's
+// players fill its slots in this order.
+func (currentCup *Cup) currentPickupIndex() (pickupSlot, int) {
+	numTeams := len(currentCup.Teams)
+	teamSizes := make([]int, numTeams)
 	for i := range currentCup.Players {
-		if currentCup.Players[i].ID == id {
-			return i
+		team := currentCup.Players[i].Team
+		if team >= 0 && team < numTeams {
+			teamSizes[team]++
 		}
 	}
-	return -1
-}
 
-// Returns the nth player in the list of active players
-// that hasn't been assigned to a team yet, or -1 if none.
-// Note: subs are not taken into consideration
-func (currentCup *Cup) findAvailablePlayer(nth int) int {
-	numActive := currentCup.activePlayerCount()
-	if nth < 0 || nth > numActive {
-		return -1
-	}
-	for i := 0; i < numActive; i++ {
-		player := &currentCup.Players[i]
-		if player.Team == -1 {
-			if nth == 0 {
-				return i
+	sequence := currentCup.pickSequence()
+
+	order := make([]int, 0, len(sequence))
+	for start := 0; start < len(sequence); start += numTeams {
+		end := start + numTeams
+		if end > len(sequence) {
+			end = len(sequence)
+		}
+		for i := start; i < end; i++ {
+			if !currentCup.isPickSkipped(i) && !currentCup.isPickPassed(i) {
+				order = append(order, i)
+			}
+		}
+		for _, i := range currentCup.PassedPicks {
+			if i >= start && i < end && !currentCup.isPickSkipped(i) {
+				order = append(order, i)
 			}
-			nth--
 		}
 	}
-	return -1
+	for _, i := range currentCup.SkippedPicks {
+		if i >= 0 && i < len(sequence) {
+			order = append(order, i)
+		}
+	}
+
+	remaining := append([]int(nil), teamSizes...)
+	for _, i := range order {
+		team := sequence[i].Team
+		if remaining[team] > 0 {
+			remaining[team]--
+			continue
+		}
+		return pickupSlot{team, teamSizes[team]}, i
+	}
+
+	return pickupAt(currentCup.PickedPlayers, numTeams, currentCup.TeamSize, currentCup.CompensationPick), -1
 }
 
-func (currentCup *Cup) nextAvailablePlayer() int {
-	return currentCup.findAvailablePlayer(0)
+// Returns true if the pick at the given position in the regular picking order was skipped
+func (currentCup *Cup) isPickSkipped(index int) bool {
+	for _, skipped := range currentCup.SkippedPicks {
+		if skipped == index {
+			return true
+		}
+	}
+	return false
 }
 
-func (currentCup *Cup) isManager(id string) bool {
-	return currentCup.Status != CupStatusInactive && currentCup.Manager.ID == id
+// Returns true if the pick at the given position in the regular picking order was passed
+func (currentCup *Cup) isPickPassed(index int) bool {
+	for _, passed := range currentCup.PassedPicks {
+		if passed == index {
+			return true
+		}
+	}
+	return false
 }
 
-func (currentCup *Cup) isSuperUser(id string) bool {
-	// Check cup manager first
-	if currentCup.isManager(id) {
-		return true
+// Moves the pick of the team whose turn it is to the end of the current round (a round being
+// one pick per team), so the next team gets its turn. Each team can pass once per round.
+// Fails if passes are disabled, if the current pick is a captain pick, or if nobody else has a pick left in the round.
+func (currentCup *Cup) passPick() error {
+	if !currentCup.AllowPasses {
+		return errors.New("passing is disabled in this cup")
+	}
+	slot, index := currentCup.currentPickupIndex()
+	if index == -1 {
+		return errors.New("no pick left to pass")
+	}
+	if slot.Player == 0 {
+		return errors.New("captain picks can't be passed")
 	}
 
-	// If not the manager, check for an appropriate role
+	numTeams := len(currentCup.Teams)
+	sequence := currentCup.pickSequence()
+	for _, i := range currentCup.PassedPicks {
+		if i/numTeams == index/numTeams && sequence[i].Team == slot.Team {
+			return errors.New("the team already passed this round")
+		}
+	}
 
-	member, err := Session.GuildMember(currentCup.GuildID, id)
-	if err != nil {
-		fmt.Println("Error retrieving guild member:", err)
-		return false
+	before := currentCup.PassedPicks
+	currentCup.PassedPicks = append(append([]int(nil), before...), index)
+	if next, nextIndex := currentCup.currentPickupIndex(); nextIndex == -1 || next.Team == slot.Team {
+		currentCup.PassedPicks = before
+		return errors.New("no other team has a pick left this round")
 	}
+	return nil
+}
 
-	adminRoles := [...]string{
-		"DraftusAdmin",
-		"Admins",
-		"Admin",
-		"Supervisors",
-		"Supervisor",
-		"DraftCupOrganizer",
+// Postpones the picks of the team whose turn it is until all the other picks are made, so the next team gets its turn.
+// Fails if the current pick is a captain pick, or if no other team has a pick left.
+func (currentCup *Cup) skipPick() error {
+	slot, index := currentCup.currentPickupIndex()
+	if index == -1 {
+		return errors.New("no pick left to skip")
+	}
+	if slot.Player == 0 {
+		return errors.New("captain picks can't be skipped")
 	}
 
-	for _, roleID := range member.Roles {
-		role, err := Session.State.Role(currentCup.GuildID, roleID)
-		if err != nil {
-			fmt.Println("Error retrieving role info:", err)
-			continue
+	before := currentCup.SkippedPicks
+	skipped := append([]int(nil), before...)
+	seen := make(map[int]bool)
+	for next, nextIndex := slot, index; next.Team == slot.Team; next, nextIndex = currentCup.currentPickupIndex() {
+		if nextIndex == -1 || seen[nextIndex] {
+			currentCup.SkippedPicks = before
+			return errors.New("no other team has a pick left")
 		}
-		for _, adminRoleName := range adminRoles {
-			if strings.EqualFold(role.Name, adminRoleName) {
-				return true
+		seen[nextIndex] = true
+		// A pick skipped before moves to the end again
+		kept := skipped[:0]
+		for _, i := range skipped {
+			if i != nextIndex {
+				kept = append(kept, i)
 			}
 		}
+		skipped = append(kept, nextIndex)
+		currentCup.SkippedPicks = skipped
 	}
+	return nil
+}
 
-	return false
+// Returns the full picking order for the given setup, one slot per pick
+func pickupSequence(numTeams int, teamSize int, compensation bool) []pickupSlot {
+	if numTeams <= 0 || teamSize <= 0 {
+		return nil
+	}
+	sequence := make([]pickupSlot, numTeams*teamSize)
+	for pick := range sequence {
+		sequence[pick] = pickupAt(pick, numTeams, teamSize, compensation)
+	}
+	return sequence
 }
 
-func (currentCup *Cup) targetPlayerCount() int {
-	target := len(currentCup.Players)
-	target += currentCup.TeamSize - 1
-	target -= target % currentCup.TeamSize
-	minPlayers := currentCup.minPlayerCount()
-	if target < minPlayers {
-		target = minPlayers
+// Returns the order in which teams get their captains for the given mode
+func captainSequence(mode int, numTeams int) []int {
+	sequence := make([]int, numTeams)
+	for i := range sequence {
+		sequence[i] = i
 	}
-	return target
+	switch mode {
+	case CaptainOrderReverse:
+		for i := range sequence {
+			sequence[i] = numTeams - 1 - i
+		}
+	case CaptainOrderRandom:
+		rand.Shuffle(numTeams, func(i, j int) {
+			sequence[i], sequence[j] = sequence[j], sequence[i]
+		})
+	}
+	return sequence
 }
 
-func (currentCup *Cup) activePlayerCount() int {
-	return len(currentCup.Teams) * currentCup.TeamSize
+// Reorders the captain picks (the first round) of the given picking order.
+// Does nothing if the captain order doesn't match the number of teams.
+func applyCaptainSequence(sequence []pickupSlot, captains []int, numTeams int) {
+	if len(captains) != numTeams || len(sequence) < numTeams {
+		return
+	}
+	for i, team := range captains {
+		sequence[i].Team = team
+	}
 }
 
-func (currentCup *Cup) minPlayerCount() int {
-	return currentCup.TeamSize * MinimumTeams
+func parseCaptainOrder(name string) int {
+	for mode, modeName := range captainOrderNames {
+		if strings.EqualFold(name, modeName) {
+			return mode
+		}
+	}
+	return -1
 }
 
-func (currentCup *Cup) currentPickup() pickupSlot {
-	nthPlayer := currentCup.PickedPlayers / len(currentCup.Teams)
-	nthTeam := currentCup.PickedPlayers % len(currentCup.Teams)
+func (currentCup *Cup) captainOrderDescription() string {
+	switch currentCup.CaptainOrder {
+	case CaptainOrderReverse:
+		return "captains are picked starting with the last team"
+	case CaptainOrderRandom:
+		return "captains are picked for the teams in random order"
+	}
+	return "captains are picked starting with the first team"
+}
+
+// Returns true if the compensation pick changes the picking order for the given setup.
+// With only two teams, the extra pick would always make the last team pick three times in a row.
+func compensationApplies(numTeams int, teamSize int) bool {
+	return numTeams > 2 && teamSize > 3
+}
+
+// Returns the team and player slot filled by the given (0-based) pick
+func pickupAt(pick int, numTeams int, teamSize int, compensation bool) pickupSlot {
+	// With compensation, the team picking last in round 2 gets its 4th player early, right after the next team's
+	// 3rd pick. It already picks twice in a row at the turn-around, so putting the extra pick there would make it
+	// three. The other picks in rounds 3 and 4 shift accordingly.
+	if compensation && compensationApplies(numTeams, teamSize) {
+		turn := 2 * numTeams
+		if pick == turn+2 {
+			return pickupSlot{numTeams - 1, 3}
+		}
+		if pick > turn+2 && pick <= 3*numTeams {
+			return pickupAt(pick-1, numTeams, teamSize, false)
+		}
+	}
+
+	nthPlayer := pick / numTeams
+	nthTeam := pick % numTeams
 
 	// First round is for picking captains, which is done in order.
 	// The second round is for captains making their first pick, which also happens in order.
 	// For rounds 3 and 4, picking order is reversed in order to better balance the teams.
 	if nthPlayer >= 2 && nthPlayer <= 3 {
-		nthTeam = len(currentCup.Teams) - 1 - nthTeam
+		nthTeam = numTeams - 1 - nthTeam
 	}
 
 	return pickupSlot{nthTeam, nthPlayer}
@@ -283,6 +1290,10 @@ func (currentCup *Cup) whoPicks(pickup pickupSlot) *Player {
 	if index < 0 || index >= len(currentCup.Players) {
 		return nil
 	}
+	// Reserved slots can't pick, so the manager picks for them
+	if currentCup.Players[index].isPlaceholder() {
+		return &currentCup.Manager
+	}
 	return &currentCup.Players[index]
 }
 
@@ -291,7 +1302,7 @@ func (currentCup *Cup) updateTeamNameCache() {
 	currentCup.longestTeamDescription = 0
 
 	for i := 0; i < len(currentCup.Teams); i++ {
-		length := len(currentCup.Teams[i].Name)
+		length := utf8.RuneCountInString(currentCup.Teams[i].coloredName())
 		if length > currentCup.longestTeamName {
 			currentCup.longestTeamName = length
 		}
@@ -333,6 +1344,97 @@ func (currentCup *Cup) chooseTeamNames() {
 	currentCup.updateTeamNameCache()
 }
 
+// Gives a team a new random name, sharing neither the attribute nor the noun with the other teams
+func (currentCup *Cup) rerollTeamName(team int) {
+	currentTeam := &currentCup.Teams[team]
+	for retry := 0; retry < 100; retry++ {
+		currentTeam.nameIndex = rand.Intn(TeamNameCombos)
+		attrib, noun := decomposeName(currentTeam.nameIndex)
+		if !currentCup.teamNameClashes(team, Attributes[attrib], Nouns[noun]) {
+			break
+		}
+	}
+	attrib, noun := decomposeName(currentTeam.nameIndex)
+	currentTeam.Name = Attributes[attrib] + " " + Nouns[noun]
+
+	currentCup.updateTeamNameCache()
+}
+
+// Returns true if a generated name would repeat part of another team's name, or the given team's current name
+func (currentCup *Cup) teamNameClashes(team int, attribute string, noun string) bool {
+	for i := range currentCup.Teams {
+		words := strings.Fields(currentCup.Teams[i].Name)
+		if len(words) != 2 {
+			continue
+		}
+		if i == team {
+			if words[0] == attribute && words[1] == noun {
+				return true
+			}
+		} else if words[0] == attribute || words[1] == noun {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the moderation mode with the given name, or -1 if invalid
+func parseModeration(name string) int {
+	switch name {
+	case "off":
+		return ModerationOff
+	case "on":
+		return ModerationAll
+	case "pickup":
+		return ModerationPickup
+	case "others":
+		return ModerationNonPlayers
+	}
+	return -1
+}
+
+func (currentCup *Cup) moderationDescription() string {
+	switch currentCup.Moderation {
+	case ModerationAll:
+		return "any message that is not a bot command will be removed while the cup is active"
+	case ModerationPickup:
+		return "any message that is not a bot command will be removed while players are being picked"
+	case ModerationNonPlayers:
+		return "messages from users that haven't signed up will be removed while the cup is active"
+	}
+	return "this channel is not moderated"
+}
+
+// Returns true if chat messages from the given user should be removed
+func (currentCup *Cup) isModerated(id string) bool {
+	switch currentCup.Moderation {
+	case ModerationAll:
+		return true
+	case ModerationPickup:
+		return currentCup.Status == CupStatusPickup
+	case ModerationNonPlayers:
+		return currentCup.findPlayer(id) == -1 && !currentCup.isManager(id)
+	}
+	return false
+}
+
+func (currentCup *Cup) captainModeDescription() string {
+	if currentCup.AutoCaptains {
+		return "captains are the first players to sign up"
+	}
+	return "captains are picked by the cup manager"
+}
+
+func (currentCup *Cup) chooseTeamColors() {
+	for i := range currentCup.Teams {
+		color := &TeamColors[i%len(TeamColors)]
+		currentCup.Teams[i].Color = color.Value
+		currentCup.Teams[i].Emoji = color.Emoji
+	}
+
+	currentCup.updateTeamNameCache()
+}
+
 // Returns formatted join message or an error
 func (currentCup *Cup) addPlayerToTeam(playerIndex int, teamIndex int) (string, error) {
 	if playerIndex < 0 || playerIndex >= len(currentCup.Players) {
@@ -360,7 +1462,7 @@ func (currentCup *Cup) addPlayerToTeam(playerIndex int, teamIndex int) (string,
 
 	currentCup.PickedPlayers++
 
-	message := mention(player) + " joined team " + strconv.Itoa(teamIndex+1) + ", " + bold(currentCup.Teams[teamIndex].Name)
+	message := mention(player) + " joined team " + strconv.Itoa(teamIndex+1) + ", " + bold(currentCup.Teams[teamIndex].coloredName())
 	if team.First == playerIndex {
 		message += " (as captain)"
 	}
@@ -368,6 +1470,97 @@ func (currentCup *Cup) addPlayerToTeam(playerIndex int, teamIndex int) (string,
 	return message + ".\n", nil
 }
 
+// Returns a picked player to the pool of available players.
+// A captain is replaced by the next player in his team; removing a captain without teammates fails.
+func (currentCup *Cup) removePlayerFromTeam(playerIndex int) error {
+	if playerIndex < 0 || playerIndex >= len(currentCup.Players) {
+		return fmt.Errorf("player index out of range: %d", playerIndex)
+	}
+
+	player := &currentCup.Players[playerIndex]
+	if player.Team < 0 || player.Team >= len(currentCup.Teams) {
+		return fmt.Errorf("not assigned to a team: %d", playerIndex)
+	}
+
+	team := &currentCup.Teams[player.Team]
+	if team.First == playerIndex {
+		if player.Next == -1 {
+			return fmt.Errorf("captain without teammates: %d", playerIndex)
+		}
+		team.First = player.Next
+	} else {
+		previous := team.First
+		for currentCup.Players[previous].Next != playerIndex {
+			previous = currentCup.Players[previous].Next
+			if previous == -1 {
+				return fmt.Errorf("not found in team lineup: %d", playerIndex)
+			}
+		}
+		currentCup.Players[previous].Next = player.Next
+		if team.Last == playerIndex {
+			team.Last = previous
+		}
+	}
+
+	player.resetTeam()
+	currentCup.PickedPlayers--
+
+	return nil
+}
+
+// Makes the given player the captain of a team. The player can be either a member of the team,
+// in which case the previous captain stays on the team, or an available player, who takes the
+// previous captain's place while the previous captain is returned to the pool.
+func (currentCup *Cup) replaceCaptain(teamIndex int, playerIndex int) error {
+	if teamIndex < 0 || teamIndex >= len(currentCup.Teams) {
+		return fmt.Errorf("team index out of range: %d", teamIndex)
+	}
+	if playerIndex < 0 || playerIndex >= currentCup.activePlayerCount() || playerIndex >= len(currentCup.Players) {
+		return fmt.Errorf("player index out of range: %d", playerIndex)
+	}
+
+	team := &currentCup.Teams[teamIndex]
+	oldCaptain := team.First
+	if oldCaptain == -1 {
+		return fmt.Errorf("team has no captain: %d", teamIndex)
+	}
+	if oldCaptain == playerIndex {
+		return fmt.Errorf("already captain: %d", playerIndex)
+	}
+
+	player := &currentCup.Players[playerIndex]
+	switch player.Team {
+	case teamIndex:
+		previous := oldCaptain
+		for currentCup.Players[previous].Next != playerIndex {
+			previous = currentCup.Players[previous].Next
+			if previous == -1 {
+				return fmt.Errorf("not found in team lineup: %d", playerIndex)
+			}
+		}
+		currentCup.Players[previous].Next = player.Next
+		if team.Last == playerIndex {
+			team.Last = previous
+		}
+		player.Next = oldCaptain
+		team.First = playerIndex
+
+	case -1:
+		player.Team = teamIndex
+		player.Next = currentCup.Players[oldCaptain].Next
+		team.First = playerIndex
+		if team.Last == oldCaptain {
+			team.Last = playerIndex
+		}
+		currentCup.Players[oldCaptain].resetTeam()
+
+	default:
+		return fmt.Errorf("already assigned to %d", player.Team)
+	}
+
+	return nil
+}
+
 func (currentCup *Cup) getLineup(index int) (string, error) {
 	if index < 0 || index >= len(currentCup.Teams) {
 		return "", fmt.Errorf("index out of range: %d", index)
@@ -379,45 +1572,170 @@ func (currentCup *Cup) getLineup(index int) (string, error) {
 		if count != 0 {
 			lineup += ", "
 		}
-		lineup += player.Name
+		lineup += currentCup.distinctName(player)
 		playerIndex = player.Next
 	}
 	return lineup, nil
 }
 
+// Checks that the lineup of each team matches the Team fields of the players and rebuilds the
+// lineups if needed. The valid part of a lineup keeps its order (and captain); players missing
+// from their team's lineup are appended in sign-up order. Returns a description of each repair,
+// or an error if a player belongs to a team that doesn't exist.
+func (currentCup *Cup) repairTeams() ([]string, error) {
+	numPlayers := len(currentCup.Players)
+	for i := range currentCup.Players {
+		if team := currentCup.Players[i].Team; team < -1 || team >= len(currentCup.Teams) {
+			return nil, fmt.Errorf("player %d assigned to team %d of %d", i, team, len(currentCup.Teams))
+		}
+	}
+
+	var repairs []string
+	visited := make([]bool, numPlayers)
+	lineups := make([][]int, len(currentCup.Teams))
+	rebuilt := make([]bool, len(currentCup.Teams))
+	for teamIndex := range currentCup.Teams {
+		team := &currentCup.Teams[teamIndex]
+		for playerIndex := team.First; playerIndex != -1; playerIndex = currentCup.Players[playerIndex].Next {
+			if playerIndex < 0 || playerIndex >= numPlayers || visited[playerIndex] || currentCup.Players[playerIndex].Team != teamIndex {
+				repairs = append(repairs, fmt.Sprintf("team %d: lineup broken at player %d", teamIndex+1, playerIndex))
+				rebuilt[teamIndex] = true
+				break
+			}
+			visited[playerIndex] = true
+			lineups[teamIndex] = append(lineups[teamIndex], playerIndex)
+		}
+	}
+
+	for i := range currentCup.Players {
+		player := &currentCup.Players[i]
+		if player.Team == -1 {
+			if player.Next != -1 {
+				repairs = append(repairs, fmt.Sprintf("player %d: not on a team, but linked to player %d", i, player.Next))
+			}
+			continue
+		}
+		if !visited[i] {
+			repairs = append(repairs, fmt.Sprintf("team %d: player %d missing from lineup", player.Team+1, i))
+			lineups[player.Team] = append(lineups[player.Team], i)
+			rebuilt[player.Team] = true
+		}
+	}
+
+	// Relink everything, which leaves consistent lineups unchanged
+	for i := range currentCup.Players {
+		currentCup.Players[i].Next = -1
+	}
+	picked := 0
+	for teamIndex, lineup := range lineups {
+		team := &currentCup.Teams[teamIndex]
+		last := -1
+		if len(lineup) > 0 {
+			last = lineup[len(lineup)-1]
+		}
+		if team.Last != last && !rebuilt[teamIndex] {
+			repairs = append(repairs, fmt.Sprintf("team %d: last player %d, expected %d", teamIndex+1, team.Last, last))
+		}
+		team.First, team.Last = -1, -1
+		for _, playerIndex := range lineup {
+			if team.First == -1 {
+				team.First = playerIndex
+			} else {
+				currentCup.Players[team.Last].Next = playerIndex
+			}
+			team.Last = playerIndex
+		}
+		picked += len(lineup)
+	}
+
+	if currentCup.PickedPlayers != picked {
+		repairs = append(repairs, fmt.Sprintf("picked player count %d, expected %d", currentCup.PickedPlayers, picked))
+		currentCup.PickedPlayers = picked
+	}
+
+	return repairs, nil
+}
+
+// Returns the sum of the ratings of the players in a team, and the number of players
+func (currentCup *Cup) teamRating(index int) (int, int) {
+	total, count := 0, 0
+	for playerIndex := currentCup.Teams[index].First; playerIndex != -1; count++ {
+		player := &currentCup.Players[playerIndex]
+		total += player.effectiveRating()
+		playerIndex = player.Next
+	}
+	return total, count
+}
+
+// Returns the player name as shown in report lists, with placeholders, seeds and substitutes marked as such
+func (currentCup *Cup) listedName(language string, player *Player) string {
+	name := currentCup.distinctName(player)
+	if player.isPlaceholder() {
+		name = player.Name + " " + tr(language, "player.placeholder")
+	}
+	if player.Seed > 0 {
+		name += " " + tr(language, "player.seed", player.Seed)
+	}
+	if player.SubOnly && currentCup.Status == CupStatusSignup {
+		name += " " + tr(language, "player.sub")
+	}
+	return name
+}
+
 func (currentCup *Cup) report(selector int) string {
 	message := ""
 
+	language := guildLanguage(currentCup.GuildID)
 	playerDigits := digits10(len(currentCup.Players))
 
 	switch currentCup.Status {
 	case CupStatusSignup:
+		if (selector&CupReportDescription) != 0 && len(currentCup.Description) > 0 {
+			message += currentCup.shortDescription() + "\n\n"
+		}
 		if (selector & CupReportPlayers) != 0 {
 			if len(currentCup.Players) == 0 {
-				message += "No players signed up for the cup so far.\n"
+				message += tr(language, "signup.none")
 			} else {
-				message += numbered(len(currentCup.Players), "player") + " signed up so far:\n```"
+				message += tr(language, "signup.count", trNumbered(language, len(currentCup.Players), "player")) + "```\n"
 				for i := range currentCup.Players {
-					message += rightpad(strconv.Itoa(i+1)+". ", playerDigits+2) + currentCup.Players[i].Name + "\n"
+					message += rightpad(strconv.Itoa(i+1)+". ", playerDigits+2) + currentCup.listedName(language, &currentCup.Players[i]) + "\n"
 				}
 				message += "```\n"
 			}
 		}
 		if (selector & CupReportNextAction) != 0 {
-			message += "Sign up now by typing " + bold(commandAdd.syntax()) + "\n"
+			if currentCup.AutoCaptains {
+				numTeams := currentCup.targetPlayerCount() / currentCup.TeamSize
+				message += tr(language, "signup.captains", trNumbered(language, numTeams, "player"))
+			} else if currentCup.CaptainOrder == CaptainOrderReverse {
+				message += tr(language, "signup.reverse")
+			} else if currentCup.CaptainOrder == CaptainOrderRandom {
+				message += tr(language, "signup.random")
+			}
+			if currentCup.Paused {
+				message += tr(language, "signup.paused")
+			}
+			if currentCup.Locked && currentCup.LockedStrict {
+				message += tr(language, "signup.locked.strict")
+			} else if currentCup.Locked {
+				message += tr(language, "signup.locked")
+			} else if !currentCup.Paused {
+				message += tr(language, "signup.prompt", bold(commandAdd.syntaxNoArgs()))
+			}
 		}
 
-	case CupStatusPickup:
+	case CupStatusPickup, CupStatusReady:
 		active := currentCup.activePlayerCount()
-		if (selector & CupReportTeams) != 0 {
+		if (selector&CupReportTeams) != 0 && len(currentCup.Teams) > 0 {
 			if currentCup.PickedPlayers != active && currentCup.PickedPlayers != 0 {
-				message += fmt.Sprintf("%d teams, with %s picked out of %d:\n```\n", len(currentCup.Teams), numbered(currentCup.PickedPlayers, "player"), active)
+				message += trPlural(language, len(currentCup.Teams), "teams.picking", trNumbered(language, currentCup.PickedPlayers, "player"), active) + "```\n"
 			} else {
-				message += fmt.Sprintf("%d competing teams:\n```\n", len(currentCup.Teams))
+				message += trPlural(language, len(currentCup.Teams), "teams.competing") + "```\n"
 			}
 			for i := range currentCup.Teams {
 				lineup, _ := currentCup.getLineup(i)
-				teamDescription := strconv.Itoa(i+1) + ". " + currentCup.Teams[i].Name
+				teamDescription := strconv.Itoa(i+1) + ". " + currentCup.Teams[i].coloredName()
 				// omit colons if all teams are empty
 				if currentCup.PickedPlayers > 0 {
 					message += fmt.Sprintf("%*s : %s\n", -currentCup.longestTeamDescription, teamDescription, lineup)
@@ -431,27 +1749,37 @@ func (currentCup *Cup) report(selector int) string {
 		if (selector & CupReportPlayers) != 0 {
 			unpicked := active - currentCup.PickedPlayers
 			if unpicked > 0 {
-				message += strconv.Itoa(unpicked) + " available players:\n```\n"
+				message += tr(language, "players.available", trNumbered(language, unpicked, "player")) + "```\n"
 				for i := 0; i < active; i++ {
 					player := &currentCup.Players[i]
 					if player.Team != -1 {
 						continue
 					}
-					message += rightpad(strconv.Itoa(i+1)+". ", playerDigits+2) + player.Name + "\n"
+					message += rightpad(strconv.Itoa(i+1)+". ", playerDigits+2) + currentCup.listedName(language, player) + "\n"
 				}
-				message += "\n```\n"
+				message += "```\n"
 			}
 		}
 
 		if (selector & CupReportSubs) != 0 {
 			subs := len(currentCup.Players) - active
 			if subs > 0 {
-				message += numbered(subs, " substitute player") + ":\n```\n"
+				message += numbered(subs, "substitute player")
+				if currentCup.LimitSubs {
+					message += " (out of " + strconv.Itoa(currentCup.MaxSubs) + ")"
+				}
+				message += ":\n```\n"
+				labelWidth := 0
+				for i := active; i < len(currentCup.Players); i++ {
+					if width := len(currentCup.Players[i].subLabel(i)) + 2; width > labelWidth {
+						labelWidth = width
+					}
+				}
 				for i := active; i < len(currentCup.Players); i++ {
 					player := &currentCup.Players[i]
-					message += strconv.Itoa(i+1) + ". " + player.Name + "\n"
+					message += rightpad(player.subLabel(i)+". ", labelWidth) + currentCup.listedName(language, player) + "\n"
 				}
-				message += "\n```\n"
+				message += "```\n"
 			}
 		}
 
@@ -460,16 +1788,19 @@ func (currentCup *Cup) report(selector int) string {
 			who := currentCup.whoPicks(pickup)
 
 			if who != nil {
-				teamName := currentCup.Teams[pickup.Team].Name
-				teamDescription := "team " + strconv.Itoa(pickup.Team+1) + ", " + bold(teamName)
+				teamName := currentCup.Teams[pickup.Team].coloredName()
+				teamDescription := tr(language, "team.description", pickup.Team+1, bold(teamName))
 
 				if pickup.Player == 0 {
-					message += mention(who) + ", pick a captain for " + teamDescription + ", by typing " + bold(commandPick.syntax()) + "\n"
+					message += tr(language, "pick.captain", mention(who), teamDescription, bold(commandPick.syntax()))
 				} else {
-					message += mention(who) + ", pick the " + nth(pickup.Player+1) + " player for " + teamDescription + ", by typing " + bold(commandPick.syntax()) + "\n"
+					message += tr(language, "pick.player", mention(who), trNth(language, pickup.Player+1), teamDescription, bold(commandPick.syntax()))
 				}
 			} else {
-				message += "Good luck and have fun!\n"
+				message += tr(language, "pick.done")
+			}
+			if len(currentCup.SeriesScore) > 0 {
+				message += "Series score: " + currentCup.seriesDescription() + "\n"
 			}
 		}
 	}
@@ -477,47 +1808,557 @@ func (currentCup *Cup) report(selector int) string {
 	return message
 }
 
-func (currentCup *Cup) removeLastReply(s *discordgo.Session) {
+// Ends sign-up and starts picking teams, keeping the given number of players (the rest become subs)
+func (currentCup *Cup) closeSignup(s DiscordSession, signedUp int, message string) {
+	numTeams := signedUp / currentCup.TeamSize
+	currentCup.moveSubOnlyLast()
+
+	currentCup.Status = CupStatusPickup
+	currentCup.Paused = false
+	currentCup.Locked = false
+	currentCup.LockedStrict = false
+	currentCup.PickedPlayers = 0
+	currentCup.Teams = make([]Team, numTeams)
+	for i := 0; i < numTeams; i++ {
+		currentTeam := &currentCup.Teams[i]
+		currentTeam.resetTeam()
+	}
+	currentCup.chooseTeamNames()
+	currentCup.chooseTeamColors()
+	currentCup.CaptainSequence = captainSequence(currentCup.CaptainOrder, numTeams)
+	currentCup.SkippedPicks = nil
+	currentCup.PassedPicks = nil
+	currentCup.notifyWebhook(WebhookEventClose)
+
+	if currentCup.CaptainOrder != CaptainOrderSequential && !currentCup.AutoCaptains {
+		message += "Note: " + currentCup.captainOrderDescription() + ".\n\n"
+	}
+	if currentCup.CompensationPick && !compensationApplies(numTeams, currentCup.TeamSize) {
+		message += "Note: the compensation pick needs at least 3 teams of 4 or more players, so it doesn't apply to this cup.\n\n"
+	}
+
+	// Optionally, the first players to sign up become captains
+	if currentCup.AutoCaptains {
+		for i := 0; i < numTeams; i++ {
+			join, _ := currentCup.addPlayerToTeam(i, i)
+			message += join
+		}
+		message += "\n"
+
+		if currentCup.teamsReady() {
+			currentCup.removeLastReply(s)
+			currentCup.completeTeams(s, message)
+			return
+		}
+	}
+
+	currentCup.reply(s, message, CupReportAll)
+}
+
+// Undoes all picks, keeping the teams (with their names and colors) and the roster
+func (currentCup *Cup) clearPicks() {
+	for i := range currentCup.Teams {
+		currentCup.Teams[i].First = -1
+		currentCup.Teams[i].Last = -1
+	}
+	for i := range currentCup.Players {
+		currentCup.Players[i].resetTeam()
+	}
+	currentCup.PickedPlayers = 0
+	currentCup.SkippedPicks = nil
+	currentCup.PassedPicks = nil
+}
+
+// Returns true if the picks made so far complete the teams: either every slot is filled,
+// or only one is left and the last player is assigned to it automatically.
+func (currentCup *Cup) teamsReady() bool {
+	remaining := currentCup.activePlayerCount() - currentCup.PickedPlayers
+	if currentCup.ManualLastPick {
+		return remaining <= 0
+	}
+	return remaining <= 1
+}
+
+// Assigns the last available player (if any) to the remaining slot,
+// announces the final teams and finishes the cup.
+func (currentCup *Cup) completeTeams(s DiscordSession, text string) {
+	// With a manual last pick, every slot is filled already
+	lastPlayer := currentCup.nextAvailablePlayer()
+	if lastPlayer != -1 {
+		lastSlot := currentCup.currentPickup()
+		lastJoin, _ := currentCup.addPlayerToTeam(lastPlayer, lastSlot.Team)
+		text += lastJoin
+	}
+
+	// We send the last join messages (two, or just the final pick if it was manual) separately, instead of
+	// merging them with the final report. This way, the last players to get picked aren't highlighted
+	// at the end if the report mentions everyone.
+	_, _ = sendMessage(s, currentCup.ChannelID, text)
+
+	currentCup.unpinAll(s)
+
+	text = "Teams are now complete and the games can begin!\n" +
+		display(&currentCup.Manager) + " will take things from here, setting up matches and tracking scores.\n\n" +
+		currentCup.report(CupReportTeams|CupReportSubs) +
+		announceFarewell(currentCup.GuildID)
+
+	lastMessage, err := sendMessage(s, currentCup.ChannelID, text)
+	if err == nil {
+		pinMessage(s, lastMessage.ChannelID, lastMessage.ID)
+	}
+
+	currentCup.notifyWebhook(WebhookEventComplete)
+	currentCup.postResults(s)
+	currentCup.notifySpectators(s)
+	currentCup.createVoiceChannels(s)
+	if err := currentCup.recordAttendance(); err != nil {
+		logError(logGuild(currentCup.GuildID), "Error saving player statistics:", err)
+	}
+	finishCup(s, currentCup.ChannelID)
+}
+
+// Records the result of a cup decided by forfeit. Team indices are 0-based;
+// the forfeiting team may be -1 if unknown (e.g. when the manager declares the winner).
+func (currentCup *Cup) recordForfeit(forfeited int, winner int) {
+	currentCup.Winner = winner + 1
+	currentCup.ForfeitedBy = forfeited + 1
+	currentCup.ResultTime = time.Now()
+}
+
+// Returns the maximum number of games played between the teams
+func (currentCup *Cup) seriesLength() int {
+	if currentCup.BestOf < 1 {
+		return 1
+	}
+	return currentCup.BestOf
+}
+
+// Records a game won by the given (0-based) team. If that gives the team a majority
+// of the series, it is also recorded as the winner of the cup and true is returned.
+func (currentCup *Cup) recordGame(winner int) bool {
+	if len(currentCup.SeriesScore) != len(currentCup.Teams) {
+		currentCup.SeriesScore = make([]int, len(currentCup.Teams))
+	}
+	currentCup.SeriesScore[winner]++
+	if currentCup.SeriesScore[winner] > currentCup.seriesLength()/2 {
+		currentCup.recordForfeit(-1, winner)
+		return true
+	}
+	return false
+}
+
+// Returns the highest number of games won by any team
+func (currentCup *Cup) seriesLead() int {
+	lead := 0
+	for _, wins := range currentCup.SeriesScore {
+		if wins > lead {
+			lead = wins
+		}
+	}
+	return lead
+}
+
+// Returns the running score of the series, e.g. "**Red Foxes** 2, **Blue Jays** 1 (best of 5)"
+func (currentCup *Cup) seriesDescription() string {
+	parts := make([]string, len(currentCup.Teams))
+	for i := range currentCup.Teams {
+		wins := 0
+		if i < len(currentCup.SeriesScore) {
+			wins = currentCup.SeriesScore[i]
+		}
+		parts[i] = bold(currentCup.Teams[i].coloredName()) + " " + strconv.Itoa(wins)
+	}
+	return strings.Join(parts, ", ") + " (best of " + strconv.Itoa(currentCup.seriesLength()) + ")"
+}
+
+// Returns a description of the given (0-based) team, e.g. "team 1, **Red Foxes**"
+func (currentCup *Cup) teamDescription(index int) string {
+	return "team " + strconv.Itoa(index+1) + ", " + bold(currentCup.Teams[index].coloredName())
+}
+
+// Starts the promotion cooldowns, using the intervals configured for the cup's guild
+func (currentCup *Cup) resetPromoteTimes(now time.Time) {
+	config := getGuildConfig(currentCup.GuildID)
+	currentCup.NextPromoteTime = now.Add(config.promoteInterval())
+	currentCup.NextPromoteTimeManager = now.Add(config.promoteIntervalManager())
+}
+
+// Reminds everyone that registration is open
+func (currentCup *Cup) promote(s DiscordSession) {
+	currentCup.resetPromoteTimes(time.Now())
+
+	text := announceGreeting(currentCup.GuildID) + "Don't forget that registration is now open for a new draft cup, managed by " + display(&currentCup.Manager) + ".\n"
+	if len(currentCup.Description) > 0 {
+		text += "\n" + currentCup.shortDescription()
+	}
+	_, _ = sendMessage(s, currentCup.ChannelID, text)
+	currentCup.reply(s, "", CupReportAll)
+}
+
+// Returns the time the given user can next promote the cup
+func (currentCup *Cup) nextPromoteTime(s DiscordSession, id string) *time.Time {
+	if currentCup.isSuperUser(s, id) {
+		return &currentCup.NextPromoteTimeManager
+	}
+	return &currentCup.NextPromoteTime
+}
+
+// Returns an invitation to sign up for the cup, suitable for posting in other channels
+func (currentCup *Cup) inviteText(everyone bool) string {
+	text := ""
+	if everyone {
+		text += announceGreeting(currentCup.GuildID)
+	}
+	text += "Registration is open for a draft cup in " + mentionChannel(currentCup.ChannelID) + ", managed by " + display(&currentCup.Manager) + ".\n"
+	if len(currentCup.Description) > 0 {
+		text += "\n" + currentCup.shortDescription() + "\n"
+	}
+	text += "\n" + numbered(len(currentCup.Players), "player") + " signed up so far. "
+	text += "To join, head over to " + mentionChannel(currentCup.ChannelID) + " and type " + bold(commandAdd.syntaxNoArgs())
+	return text
+}
+
+// Returns a plain recap of the final teams, without mentions or formatting, meant to be copied elsewhere.
+// The description is included as stored, i.e. already escaped.
+func (currentCup *Cup) summary() string {
+	text := "Draft cup summary\n"
+	if len(currentCup.Description) > 0 {
+		text += currentCup.Description + "\n"
+	}
+	text += "Manager: " + escape(currentCup.Manager.Name) + "\n"
+	if !currentCup.StartTime.IsZero() {
+		text += "Started: " + currentCup.StartTime.UTC().Format("2006-01-02 15:04") + " UTC\n"
+	}
+	text += "\n"
+	for i := range currentCup.Teams {
+		lineup, _ := currentCup.getLineup(i)
+		text += "Team " + strconv.Itoa(i+1) + " (" + currentCup.Teams[i].Name + "): " + escape(lineup) + "\n"
+	}
+	if currentCup.Winner > 0 && currentCup.Winner <= len(currentCup.Teams) {
+		text += "\nWinner: team " + strconv.Itoa(currentCup.Winner) + " (" + currentCup.Teams[currentCup.Winner-1].Name + ")"
+		if currentCup.ForfeitedBy > 0 {
+			text += ", by forfeit"
+		}
+		text += "\n"
+		if !currentCup.ResultTime.IsZero() {
+			text += "Result recorded: " + currentCup.ResultTime.UTC().Format("2006-01-02 15:04") + " UTC\n"
+		}
+	}
+	return defuseUserMentions(defuseMentions(text))
+}
+
+// Sets up a timer for the cup's pending reminder, if any
+func (currentCup *Cup) scheduleReminder(s DiscordSession) {
+	if currentCup.ReminderTime.IsZero() {
+		return
+	}
+	channelID := currentCup.ChannelID
+	when := currentCup.ReminderTime
+	time.AfterFunc(time.Until(when), func() {
+		sendReminder(s, channelID, when)
+	})
+}
+
+// Called when a reminder is due
+func sendReminder(s DiscordSession, channelID string, when time.Time) {
+	lockCups.Lock()
+	currentCup := activeCups[channelID]
+	if currentCup == nil || !currentCup.ReminderTime.Equal(when) {
+		lockCups.Unlock()
+		return // cancelled or rescheduled
+	}
+
+	due := false
+	switch {
+	case currentCup.Status != CupStatusSignup:
+		currentCup.ReminderTime = time.Time{}
+	case time.Until(currentCup.NextPromoteTimeManager) > 0:
+		// Respect promotion cooldown, postponing the reminder if needed
+		currentCup.ReminderTime = currentCup.NextPromoteTimeManager
+		currentCup.scheduleReminder(s)
+	default:
+		currentCup.ReminderTime = time.Time{}
+		due = true
+	}
+	lockCups.Unlock()
+
+	if due {
+		currentCup.promote(s)
+	}
+}
+
+// How often to check for stale cups
+const (
+	StaleCupCheckInterval = 5 * time.Minute
+)
+
+// Periodically aborts cups that are open for sign-up, but haven't seen any activity in a while
+func sweepStaleCups(s DiscordSession) {
+	if cupOptions.staleTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(StaleCupCheckInterval)
+	for range ticker.C {
+		abortStaleCups(s)
+	}
+}
+
+// Records a sign-up or withdrawal, which starts the countdown to aborting the cup over
+func (currentCup *Cup) noteActivity() {
+	currentCup.LastActivity = time.Now()
+	currentCup.AbortExtension = 0
+}
+
+// Returns the time at which the cup will be aborted if there's no sign-up activity
+func (currentCup *Cup) abortTime() time.Time {
+	return currentCup.LastActivity.Add(cupOptions.staleTimeout + currentCup.AbortExtension)
+}
+
+func abortStaleCups(s DiscordSession) {
+	var stale []*Cup
+	now := time.Now()
+
+	lockCups.Lock()
+	for _, currentCup := range activeCups {
+		if currentCup.isStale(now) {
+			stale = append(stale, currentCup)
+		}
+	}
+	lockCups.Unlock()
+
+	for _, currentCup := range stale {
+		// Someone may have signed up, or started a new cup, since the check above
+		lockCups.Lock()
+		stillStale := activeCups[currentCup.ChannelID] == currentCup && currentCup.isStale(now)
+		if stillStale {
+			delete(activeCups, currentCup.ChannelID)
+		}
+		lockCups.Unlock()
+		if !stillStale {
+			continue
+		}
+
+		logInfo(logChannel(currentCup.ChannelID), "Aborting stale cup")
+		_, _ = sendMessage(s, currentCup.ChannelID, "Cup aborted automatically, since nobody signed up or left in the last "+humanize(now.Sub(currentCup.LastActivity))+".\n"+
+			"You can start a new one with "+bold(commandStart.syntax()))
+		currentCup.unpinAll(s)
+		currentCup.deleteVoiceChannels(s)
+		scheduleBotStatusUpdate(s)
+	}
+}
+
+// Returns true if the cup is open for sign-up, but has seen no activity for too long
+func (currentCup *Cup) isStale(now time.Time) bool {
+	return currentCup.Status == CupStatusSignup && !now.Before(currentCup.abortTime())
+}
+
+// Sets up timers for the reminders of all active cups (e.g. after loading them from disk)
+func scheduleReminders(s DiscordSession) {
+	lockCups.Lock()
+	defer lockCups.Unlock()
+	for _, currentCup := range activeCups {
+		currentCup.scheduleReminder(s)
+	}
+}
+
+// Clears the last reply ID of every active cup whose last reply no longer exists
+// (e.g. deleted while the bot was offline), so cleanup doesn't rely on stale IDs.
+func verifyLastReplies(s DiscordSession) {
+	lockCups.Lock()
+	defer lockCups.Unlock()
+	for _, currentCup := range activeCups {
+		if len(currentCup.LastReplyID) == 0 {
+			continue
+		}
+		_, err := s.ChannelMessage(currentCup.ChannelID, currentCup.LastReplyID)
+		if restErr, ok := err.(*discordgo.RESTError); ok && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeUnknownMessage {
+			logInfo(logChannel(currentCup.ChannelID), "Last reply", currentCup.LastReplyID, "not found:", err)
+			currentCup.LastReplyID = ""
+		}
+	}
+}
+
+func (currentCup *Cup) removeLastReply(s DiscordSession) {
 	if len(currentCup.LastReplyID) > 0 {
-		s.ChannelMessageDelete(currentCup.ChannelID, currentCup.LastReplyID)
+		deleteMessage(s, currentCup.ChannelID, currentCup.LastReplyID)
 		currentCup.LastReplyID = ""
 	}
 }
 
-func (currentCup *Cup) reply(s *discordgo.Session, text string, report int) {
+// Commands run concurrently, so replacing the report in a channel is serialized
+// to keep the latest report from being deleted or posted out of order.
+var (
+	lockReplies sync.Mutex
+	replyLocks  = make(map[string]*sync.Mutex)
+)
+
+// Returns the lock serializing replies in the given channel
+func replyLock(channelID string) *sync.Mutex {
+	lockReplies.Lock()
+	defer lockReplies.Unlock()
+	lock := replyLocks[channelID]
+	if lock == nil {
+		lock = &sync.Mutex{}
+		replyLocks[channelID] = lock
+	}
+	return lock
+}
+
+func (currentCup *Cup) reply(s DiscordSession, text string, report int) {
+	lock := replyLock(currentCup.ChannelID)
+	lock.Lock()
+	defer lock.Unlock()
+	currentCup.replaceReply(s, text, report)
+}
+
+// Replaces the last reply with a new one; the channel's reply lock must be held
+func (currentCup *Cup) replaceReply(s DiscordSession, text string, report int) {
 	currentCup.removeLastReply(s)
+	reportText := ""
 	if report != 0 {
-		text += currentCup.report(report)
+		reportText = currentCup.report(report)
 	}
-	message, err := s.ChannelMessageSend(currentCup.ChannelID, text)
+	message, err := sendMessage(s, currentCup.ChannelID, text+reportText)
 	if err == nil {
 		currentCup.LastReplyID = message.ID
+		currentCup.lastReplyTime = time.Now()
+		currentCup.lastReplyText = text
+		currentCup.lastReplyReport = reportText
 	}
 }
 
-func (currentCup *Cup) deleteAndReply(s *discordgo.Session, m *discordgo.MessageCreate, text string, report int) {
-	currentCup.removeLastReply(s)
-	s.ChannelMessageDelete(m.ChannelID, m.ID)
-	currentCup.reply(s, text, report)
+// Like deleteAndReply without text, but avoids re-posting a report posted moments ago:
+// if nothing changed since then, the request is ignored, otherwise the previous reply is updated in place.
+func (currentCup *Cup) refreshReply(s DiscordSession, m *discordgo.MessageCreate, report int) {
+	recent := len(currentCup.LastReplyID) > 0 && time.Since(currentCup.lastReplyTime) < ReportRefreshInterval
+	if !recent || !currentCup.updateReply(s, report) {
+		currentCup.deleteAndReply(s, m, "", report)
+		return
+	}
+	deleteCommand(s, m)
+}
+
+// Updates the report in the last reply in place, keeping the text before it.
+// Returns false if that isn't possible (e.g. the reply was split into several messages).
+func (currentCup *Cup) updateReply(s DiscordSession, report int) bool {
+	lock := replyLock(currentCup.ChannelID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(currentCup.LastReplyID) == 0 || len(currentCup.lastReplyText+currentCup.lastReplyReport) > MaxMessageLength {
+		return false
+	}
+
+	reportText := currentCup.report(report)
+	if reportText == currentCup.lastReplyReport {
+		return true
+	}
+
+	text := currentCup.lastReplyText + reportText
+	if len(text) > MaxMessageLength {
+		return false
+	}
+
+	_, err := s.ChannelMessageEdit(currentCup.ChannelID, currentCup.LastReplyID, text)
+	if err != nil {
+		logWarn(logChannel(currentCup.ChannelID), "Error updating last reply:", err)
+		return false
+	}
+	currentCup.lastReplyReport = reportText
+	return true
+}
+
+// Reactions used instead of text replies, if enabled for the guild
+const (
+	ReactionSuccess = "\u2705"
+	ReactionFailure = "\u274c"
+)
+
+// In reaction mode, acknowledges a successful command with a reaction, updating the report in place.
+// Returns false in full-text mode, in which case the caller is expected to reply as usual.
+func (currentCup *Cup) acknowledge(s DiscordSession, m *discordgo.MessageCreate, report int) bool {
+	if !getGuildConfig(currentCup.GuildID).Reactions {
+		return false
+	}
+	addReaction(s, m.ChannelID, m.ID, ReactionSuccess)
+	if !currentCup.updateReply(s, report) {
+		currentCup.reply(s, "", report)
+	}
+	return true
+}
+
+// In reaction mode, marks a rejected command with a reaction.
+// Returns false in full-text mode, in which case the caller is expected to explain the problem.
+func (currentCup *Cup) rejectWithReaction(s DiscordSession, m *discordgo.MessageCreate) bool {
+	if !getGuildConfig(currentCup.GuildID).Reactions {
+		return false
+	}
+	addReaction(s, m.ChannelID, m.ID, ReactionFailure)
+	return true
+}
+
+// Deletes the last reply along with the command message, then replies
+func (currentCup *Cup) deleteAndReply(s DiscordSession, m *discordgo.MessageCreate, text string, report int) {
+	lock := replyLock(currentCup.ChannelID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var messageIDs []string
+	if !keepCommands(s, m.ChannelID) {
+		messageIDs = append(messageIDs, m.ID)
+	}
+	if len(currentCup.LastReplyID) > 0 && m.ChannelID == currentCup.ChannelID {
+		messageIDs = append(messageIDs, currentCup.LastReplyID)
+		currentCup.LastReplyID = ""
+	} else {
+		currentCup.removeLastReply(s)
+	}
+	deleteMessages(s, m.ChannelID, messageIDs)
+	currentCup.replaceReply(s, text, report)
+}
+
+// Returns true if the given message is a report snapshot pinned by freeze
+func (currentCup *Cup) isFrozenMessage(messageID string) bool {
+	for _, frozenID := range currentCup.FrozenMessageIDs {
+		if frozenID == messageID {
+			return true
+		}
+	}
+	return false
 }
 
-func (currentCup *Cup) unpinAll(s *discordgo.Session) {
+// Unpins the bot's own messages in the cup channel, leaving messages pinned by others
+// and report snapshots alone
+func (currentCup *Cup) unpinAll(s DiscordSession) {
 	allPinned, err := s.ChannelMessagesPinned(currentCup.ChannelID)
 	if err == nil {
 		for _, pinnedMessage := range allPinned {
-			if pinnedMessage.Author.ID == BotID {
+			if pinnedMessage.Author != nil && pinnedMessage.Author.ID == BotID && !currentCup.isFrozenMessage(pinnedMessage.ID) {
 				s.ChannelMessageUnpin(pinnedMessage.ChannelID, pinnedMessage.ID)
 			}
 		}
 	}
 }
 
+// Saves the cup into the set-aside folder instead of the usual one
+func (currentCup *Cup) setAside(reason string) error {
+	dir := filepath.Join(ChannelDataDir, SetAsideCupsDir)
+	if err := currentCup.saveTo(dir); err != nil {
+		return err
+	}
+	return setAsideCupFile(filepath.Join(dir, currentCup.ChannelID), currentCup.ChannelID, reason)
+}
+
 func (currentCup *Cup) save() error {
-	if len(ChannelDataDir) <= 0 {
+	return currentCup.saveTo(ChannelDataDir)
+}
+
+func (currentCup *Cup) saveTo(dir string) error {
+	if len(dir) <= 0 {
 		return os.ErrInvalid
 	}
 
-	err := os.MkdirAll(ChannelDataDir, 0777)
+	err := os.MkdirAll(dir, 0777)
 	if err != nil {
 		return err
 	}
@@ -527,18 +2368,41 @@ func (currentCup *Cup) save() error {
 		return err
 	}
 
-	path := filepath.Join(ChannelDataDir, currentCup.ChannelID)
-	err = ioutil.WriteFile(path, contents, SaveFilePermission)
+	return writeFileAtomic(dir, currentCup.ChannelID, contents)
+}
+
+// Writes a file to a temporary location first and renames it into place,
+// so a crash mid-write never leaves a partial file behind
+func writeFileAtomic(dir string, name string, contents []byte) error {
+	file, err := ioutil.TempFile(dir, "."+name+".tmp")
 	if err != nil {
 		return err
 	}
+	tempPath := file.Name()
+	defer os.Remove(tempPath) // no-op once renamed
 
-	return nil
+	_, err = file.Write(contents)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tempPath, SaveFilePermission)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, filepath.Join(dir, name))
 }
 
 ////////////////////////////////////////////////////////////////
 
-func lastPinned(s *discordgo.Session, ChannelID string) (*discordgo.Message, error) {
+func lastPinned(s DiscordSession, ChannelID string) (*discordgo.Message, error) {
 	allPinned, err := s.ChannelMessagesPinned(ChannelID)
 	if err != nil {
 		return nil, err
@@ -552,7 +2416,7 @@ func lastPinned(s *discordgo.Session, ChannelID string) (*discordgo.Message, err
 	return nil, nil
 }
 
-func getActiveGuildChannels(s *discordgo.Session, GuildID string) ([]*discordgo.Channel, error) {
+func getActiveGuildChannels(s DiscordSession, GuildID string) ([]*discordgo.Channel, error) {
 	channels, err := s.GuildChannels(GuildID)
 	if err != nil {
 		return nil, err
@@ -568,7 +2432,7 @@ func getActiveGuildChannels(s *discordgo.Session, GuildID string) ([]*discordgo.
 	return channels[:count], nil
 }
 
-func getAlternativeChannels(s *discordgo.Session, ChannelID string) ([]*discordgo.Channel, error) {
+func getAlternativeChannels(s DiscordSession, ChannelID string) ([]*discordgo.Channel, error) {
 	channel, err := s.Channel(ChannelID)
 	if err != nil {
 		return nil, err
@@ -576,7 +2440,7 @@ func getAlternativeChannels(s *discordgo.Session, ChannelID string) ([]*discordg
 	return getActiveGuildChannels(s, channel.GuildID)
 }
 
-func mentionChannelAlternatives(s *discordgo.Session, ChannelID string) (message string, err error) {
+func mentionChannelAlternatives(s DiscordSession, ChannelID string) (message string, err error) {
 	others, err := getAlternativeChannels(s, ChannelID)
 	if err != nil {
 		return
@@ -596,7 +2460,7 @@ func mentionChannelAlternatives(s *discordgo.Session, ChannelID string) (message
 	return
 }
 
-func noCupHereMessage(s *discordgo.Session, m *discordgo.MessageCreate) string {
+func noCupHereMessage(s DiscordSession, m *discordgo.MessageCreate) string {
 	// If there are active cups in other channels, we let the user know.
 	alternatives, _ := mentionChannelAlternatives(s, m.ChannelID)
 	if len(alternatives) <= 0 {
@@ -627,13 +2491,75 @@ var (
 	ChannelDataDir = defaultChannelDataDir()
 )
 
+// Make sure the given folder exists and is writable
+func checkDataDir(dir string) error {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(dir, ".writetest")
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	return os.Remove(file.Name())
+}
+
+// Folder where finished cups are saved, relative to ChannelDataDir
+const (
+	FinishedCupsDir = "finished"
+)
+
+// Folder where unusable cup files are moved, relative to ChannelDataDir. The reason and a timestamp
+// are appended to their names (e.g. 1234.corrupt.20240131-235959). These aren't loaded on startup;
+// moving a file back to ChannelDataDir under its original name restores the cup.
+const (
+	SetAsideCupsDir = "setaside"
+)
+
+// Reasons for setting cup files aside
+const (
+	SetAsideOrphaned = "orphaned" // the bot lost access to the channel
+	SetAsideInvalid  = "invalid"  // the cup failed validation on load
+	SetAsideCorrupt  = "corrupt"  // the file couldn't be parsed
+)
+
+// Moves a cup file out of the way, into the set-aside folder
+func setAsideCupFile(path, name, reason string) error {
+	dir := filepath.Join(ChannelDataDir, SetAsideCupsDir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return os.Rename(path, filepath.Join(dir, setAsideName(name, reason)))
+}
+
+// Returns the name a file is set aside under, tagged with the reason and the current time
+func setAsideName(name, reason string) string {
+	return name + "." + reason + "." + time.Now().UTC().Format("20060102-150405")
+}
+
 // Load all cups from disk (and remove the corresponding files)
 func resumeState() error {
 	if len(ChannelDataDir) <= 0 {
 		return os.ErrNotExist
 	}
 
-	fileList, err := ioutil.ReadDir(ChannelDataDir)
+	err := loadCups(ChannelDataDir, activeCups)
+	if err != nil {
+		return err
+	}
+
+	// Finished cups are optional
+	loadCups(filepath.Join(ChannelDataDir, FinishedCupsDir), finishedCups)
+
+	return nil
+}
+
+// Load all cups from the given folder into the given map (and remove the corresponding files)
+func loadCups(dir string, cups map[string]*Cup) error {
+	fileList, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return err
 	}
@@ -643,34 +2569,64 @@ func resumeState() error {
 			continue
 		}
 		name := file.Name()
-		path := filepath.Join(ChannelDataDir, name)
+		// Skip temporary files left behind by an interrupted save
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
 		contents, err := ioutil.ReadFile(path)
 		if err != nil {
-			fmt.Println("Error reading cup", name, ":", err)
+			logError(logChannel(name), "Error reading cup:", err)
 			continue
 		}
 
 		currentCup := new(Cup)
 		err = json.Unmarshal(contents, currentCup)
 		if err != nil {
-			fmt.Println("Error parsing cup", name, ":", err)
+			logError(logChannel(name), "Error parsing cup, setting it aside:", err)
+			if err := setAsideCupFile(path, name, SetAsideCorrupt); err != nil {
+				logError(logChannel(name), "Error moving corrupt cup:", err)
+			}
 			continue
 		}
 
 		if currentCup.ChannelID != name {
-			fmt.Printf("File name/channel ID mismatch: '%s' vs '%s', ignoring...\n", name, currentCup.ChannelID)
+			logWarn(fmt.Sprintf("File name/channel ID mismatch: '%s' vs '%s', ignoring...", name, currentCup.ChannelID))
 			continue
 		}
 
+		// Cups saved before team sizes were configurable always used the default
 		if currentCup.TeamSize == 0 {
 			currentCup.TeamSize = DefaultTeamSize
 		}
+		if currentCup.LastActivity.IsZero() {
+			currentCup.LastActivity = time.Now()
+		}
+		if currentCup.Moderated {
+			currentCup.Moderated = false
+			currentCup.Moderation = ModerationAll
+		}
+		if currentCup.MinimumTeams == 0 {
+			currentCup.MinimumTeams = cupOptions.minimumTeams
+		}
+
+		repairs, err := currentCup.repairTeams()
+		if err != nil {
+			logError(logChannel(name), "Invalid teams, setting cup aside:", err)
+			if err := setAsideCupFile(path, name, SetAsideInvalid); err != nil {
+				logError(logChannel(name), "Error setting cup aside:", err)
+			}
+			continue
+		}
+		for _, repair := range repairs {
+			logWarn(logChannel(name), "Repaired teams:", repair)
+		}
 
 		currentCup.updateTeamNameCache()
-		activeCups[currentCup.ChannelID] = currentCup
+		cups[currentCup.ChannelID] = currentCup
 
 		os.Remove(path)
-		fmt.Println("Loaded cup", name)
+		logInfo(logChannel(name), "Loaded cup")
 	}
 
 	return nil
@@ -681,10 +2637,20 @@ func suspendState() error {
 	for index, cup := range activeCups {
 		err := cup.save()
 		if err != nil {
-			fmt.Println("Error serializing cup", index, ":", err)
+			logError(logChannel(index), "Error serializing cup:", err)
+			continue
+		}
+		logInfo(logChannel(index), "Saved cup")
+	}
+
+	finishedDir := filepath.Join(ChannelDataDir, FinishedCupsDir)
+	for index, cup := range finishedCups {
+		err := cup.saveTo(finishedDir)
+		if err != nil {
+			logError(logChannel(index), "Error serializing finished cup:", err)
 			continue
 		}
-		fmt.Println("Saved cup", index)
+		logInfo(logChannel(index), "Saved finished cup")
 	}
 
 	return nil
@@ -0,0 +1,868 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPickupOrder(t *testing.T) {
+	expected := []pickupSlot{
+		{0, 0}, {1, 0}, {2, 0},
+		{0, 1}, {1, 1}, {2, 1},
+		{2, 2}, {1, 2}, {0, 2},
+		{2, 3}, {1, 3}, {0, 3},
+		{0, 4}, {1, 4}, {2, 4},
+	}
+	sequence := pickupSequence(3, 5, false)
+	for i := range expected {
+		if sequence[i] != expected[i] {
+			t.Errorf("pick %d: got %v, expected %v", i, sequence[i], expected[i])
+		}
+	}
+}
+
+func TestPickupOrderTwoTeams(t *testing.T) {
+	expected := map[int][]pickupSlot{
+		4: {
+			{0, 0}, {1, 0},
+			{0, 1}, {1, 1},
+			{1, 2}, {0, 2},
+			{1, 3}, {0, 3},
+		},
+		5: {
+			{0, 0}, {1, 0},
+			{0, 1}, {1, 1},
+			{1, 2}, {0, 2},
+			{1, 3}, {0, 3},
+			{0, 4}, {1, 4},
+		},
+	}
+	for teamSize, slots := range expected {
+		sequence := pickupSequence(2, teamSize, false)
+		if !reflect.DeepEqual(sequence, slots) {
+			t.Errorf("2 teams of %d: got %v, expected %v", teamSize, sequence, slots)
+		}
+	}
+}
+
+func TestPickupOrderCompensation(t *testing.T) {
+	expected := []pickupSlot{
+		{0, 0}, {1, 0}, {2, 0},
+		{0, 1}, {1, 1}, {2, 1},
+		{2, 2}, {1, 2}, {2, 3}, {0, 2},
+		{1, 3}, {0, 3},
+	}
+	sequence := pickupSequence(3, 4, true)
+	if !reflect.DeepEqual(sequence, expected) {
+		t.Errorf("got %v, expected %v", sequence, expected)
+	}
+
+	// Without a third team or a fourth player, there's no room for the extra pick
+	for _, setup := range [][2]int{{2, 4}, {2, 5}, {3, 3}, {4, 2}} {
+		numTeams, teamSize := setup[0], setup[1]
+		if sequence := pickupSequence(numTeams, teamSize, true); !reflect.DeepEqual(sequence, pickupSequence(numTeams, teamSize, false)) {
+			t.Errorf("%d teams of %d: compensation changed the order to %v", numTeams, teamSize, sequence)
+		}
+	}
+
+	// Nobody ever picks more than twice in a row
+	for numTeams := 3; numTeams <= 6; numTeams++ {
+		for teamSize := 4; teamSize <= 8; teamSize++ {
+			sequence := pickupSequence(numTeams, teamSize, true)
+			for i := numTeams + 2; i < len(sequence); i++ {
+				if sequence[i].Team == sequence[i-1].Team && sequence[i].Team == sequence[i-2].Team {
+					t.Errorf("%d teams of %d: team %d picks three times in a row, ending with pick %d", numTeams, teamSize, sequence[i].Team+1, i)
+				}
+			}
+		}
+	}
+}
+
+func TestPickupOrderFillsEverySlot(t *testing.T) {
+	for _, compensation := range []bool{false, true} {
+		for numTeams := 1; numTeams <= 6; numTeams++ {
+			for teamSize := 1; teamSize <= 8; teamSize++ {
+				filled := make(map[pickupSlot]bool)
+				for i, slot := range pickupSequence(numTeams, teamSize, compensation) {
+					if slot.Team < 0 || slot.Team >= numTeams || slot.Player < 0 || slot.Player >= teamSize {
+						t.Fatalf("%d teams of %d (compensation %v), pick %d: invalid slot %v", numTeams, teamSize, compensation, i, slot)
+					}
+					if filled[slot] {
+						t.Fatalf("%d teams of %d (compensation %v), pick %d: slot %v filled twice", numTeams, teamSize, compensation, i, slot)
+					}
+					filled[slot] = true
+				}
+			}
+		}
+	}
+}
+
+func TestCurrentPickupFollowsSequence(t *testing.T) {
+	for _, compensation := range []bool{false, true} {
+		currentCup := makeTestCup(3, 12)
+		currentCup.TeamSize = 4
+		currentCup.CompensationPick = compensation
+
+		for pick, expected := range pickupSequence(3, 4, compensation) {
+			slot := currentCup.currentPickup()
+			if slot != expected {
+				t.Fatalf("compensation %v, pick %d: got %v, expected %v", compensation, pick, slot, expected)
+			}
+
+			who := currentCup.whoPicks(slot)
+			if slot.Player == 0 && who != &currentCup.Manager {
+				t.Errorf("compensation %v, pick %d: captains should be picked by the manager", compensation, pick)
+			}
+			if slot.Player > 0 && who != &currentCup.Players[currentCup.Teams[slot.Team].First] {
+				t.Errorf("compensation %v, pick %d: players should be picked by the team captain", compensation, pick)
+			}
+
+			if _, err := currentCup.addPlayerToTeam(currentCup.nextAvailablePlayer(), slot.Team); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestCaptainOrder(t *testing.T) {
+	expected := map[int][]pickupSlot{
+		CaptainOrderSequential: {{0, 0}, {1, 0}, {2, 0}, {3, 0}},
+		CaptainOrderReverse:    {{3, 0}, {2, 0}, {1, 0}, {0, 0}},
+	}
+	for mode, slots := range expected {
+		currentCup := makeTestCup(4, 12)
+		currentCup.TeamSize = 3
+		currentCup.CaptainOrder = mode
+		currentCup.CaptainSequence = captainSequence(mode, 4)
+
+		for pick, slot := range slots {
+			if got := currentCup.currentPickup(); got != slot {
+				t.Fatalf("%s, pick %d: got %v, expected %v", captainOrderNames[mode], pick, got, slot)
+			}
+			if _, err := currentCup.addPlayerToTeam(currentCup.nextAvailablePlayer(), slot.Team); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := currentCup.currentPickup(); got != (pickupSlot{0, 1}) {
+			t.Errorf("%s: got %v after captains, expected the first team to pick", captainOrderNames[mode], got)
+		}
+	}
+}
+
+func TestCaptainOrderRandom(t *testing.T) {
+	for numTeams := 1; numTeams <= 6; numTeams++ {
+		sequence := captainSequence(CaptainOrderRandom, numTeams)
+		sorted := append([]int(nil), sequence...)
+		sort.Ints(sorted)
+		for i := range sorted {
+			if sorted[i] != i {
+				t.Fatalf("%d teams: %v is not a permutation of the teams", numTeams, sequence)
+			}
+		}
+
+		slots := pickupSequence(numTeams, 3, false)
+		applyCaptainSequence(slots, sequence, numTeams)
+		for i := 0; i < numTeams; i++ {
+			if slots[i] != (pickupSlot{sequence[i], 0}) {
+				t.Errorf("%d teams, pick %d: got %v, expected captain for team %d", numTeams, i, slots[i], sequence[i])
+			}
+		}
+	}
+}
+
+func TestRecordGame(t *testing.T) {
+	currentCup := makeTestCup(2, 4)
+	currentCup.pickTestPlayers(4)
+	currentCup.BestOf = 5
+
+	for i, winner := range []int{0, 1, 1, 0} {
+		if currentCup.recordGame(winner) {
+			t.Fatalf("game %d: series decided early at %v", i+1, currentCup.SeriesScore)
+		}
+	}
+	if currentCup.Winner != 0 {
+		t.Errorf("winner recorded before the end of the series: %d", currentCup.Winner)
+	}
+	if !currentCup.recordGame(1) {
+		t.Fatalf("series not decided at %v", currentCup.SeriesScore)
+	}
+	if currentCup.Winner != 2 || currentCup.ForfeitedBy != 0 {
+		t.Errorf("got winner %d, forfeited by %d; expected winner 2, no forfeit", currentCup.Winner, currentCup.ForfeitedBy)
+	}
+
+	single := makeTestCup(2, 4)
+	single.pickTestPlayers(4)
+	if !single.recordGame(0) || single.Winner != 1 {
+		t.Errorf("a single game should decide the cup, got winner %d", single.Winner)
+	}
+}
+
+func TestShufflePlayers(t *testing.T) {
+	currentCup := makeTestCup(2, 7)
+	subs := append([]Player(nil), currentCup.Players[4:]...)
+
+	currentCup.shufflePlayers()
+
+	seen := make(map[string]bool)
+	for _, player := range currentCup.Players[:4] {
+		seen[player.ID] = true
+	}
+	for _, id := range []string{"1", "2", "3", "4"} {
+		if !seen[id] {
+			t.Errorf("player %s lost while shuffling: %v", id, currentCup.Players[:4])
+		}
+	}
+	if !reflect.DeepEqual(currentCup.Players[4:], subs) {
+		t.Errorf("substitutes changed: got %v, expected %v", currentCup.Players[4:], subs)
+	}
+}
+
+func TestPlayingCupFinishedByPicking(t *testing.T) {
+	currentCup := makeTestCup(2, 4)
+	currentCup.pickTestPlayers(4)
+	currentCup.ChannelID = "playing"
+
+	// Cups completed by picking are finished without changing their status
+	lockCups.Lock()
+	finishedCups["playing"] = currentCup
+	lockCups.Unlock()
+	defer func() {
+		lockCups.Lock()
+		delete(finishedCups, "playing")
+		lockCups.Unlock()
+	}()
+
+	if getPlayingCup("playing") != currentCup {
+		t.Errorf("finished cup with status %d not available for game results", currentCup.Status)
+	}
+}
+
+// Returns a copy of the given cup as it would be after a save/load round trip
+func roundTrip(t *testing.T, currentCup *Cup) *Cup {
+	dir := t.TempDir()
+	if err := currentCup.saveTo(dir); err != nil {
+		t.Fatal(err)
+	}
+	cups := make(map[string]*Cup)
+	if err := loadCups(dir, cups); err != nil {
+		t.Fatal(err)
+	}
+	loaded := cups[currentCup.ChannelID]
+	if loaded == nil {
+		t.Fatalf("cup %s not loaded", currentCup.ChannelID)
+	}
+	return loaded
+}
+
+func TestSaveReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	currentCup := makeTestCup(0, 3)
+	currentCup.Status = CupStatusSignup
+	for i := 0; i < 2; i++ {
+		if err := currentCup.saveTo(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A partial file left behind by an interrupted save is ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, "."+currentCup.ChannelID+".tmp123"), []byte("{"), SaveFilePermission); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, currentCup.ChannelID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != SaveFilePermission {
+		t.Errorf("saved with permissions %v, expected %v", info.Mode().Perm(), SaveFilePermission)
+	}
+
+	cups := make(map[string]*Cup)
+	if err := loadCups(dir, cups); err != nil {
+		t.Fatal(err)
+	}
+	if len(cups) != 1 || cups[currentCup.ChannelID] == nil {
+		t.Errorf("loaded %d cups, expected only %s", len(cups), currentCup.ChannelID)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	when := time.Date(2020, 5, 1, 18, 30, 0, 0, time.UTC)
+
+	signup := makeTestCup(0, 3)
+	signup.Status = CupStatusSignup
+	signup.Teams = nil
+	signup.Spectators = []Player{{Name: "Watcher", ID: "98", Team: -1, Next: -1}}
+	signup.updateTeamNameCache()
+
+	midPick := makeTestCup(2, 6)
+	midPick.LimitSubs = true
+	midPick.MaxSubs = 4
+	midPick.CompensationPick = true
+	midPick.CaptainOrder = CaptainOrderReverse
+	midPick.CaptainSequence = []int{1, 0}
+	midPick.Banned = []Player{{Name: "Kicked", ID: "99", Team: -1, Next: -1}}
+	midPick.Players[4].Seed = 2
+	midPick.pickTestPlayers(3)
+
+	complete := makeTestCup(2, 5)
+	complete.Teams[0].Emoji = TeamColors[0].Emoji
+	complete.Teams[0].Color = TeamColors[0].Value
+	complete.updateTeamNameCache()
+	complete.pickTestPlayers(4)
+	complete.BestOf = 3
+	complete.SeriesScore = []int{1, 2}
+	complete.Winner = 2
+	complete.ForfeitedBy = 1
+	complete.ResultTime = when
+
+	for name, currentCup := range map[string]*Cup{"signup": signup, "pickup": midPick, "complete": complete} {
+		currentCup.ChannelID = name
+		currentCup.GuildID = "guild"
+		currentCup.MinimumTeams = DefaultMinimumTeams
+		currentCup.StartTime = when
+		currentCup.LastActivity = when
+		currentCup.Log = []LogEntry{{Time: when, UserID: "100", UserName: "Manager", Command: "?draft start"}}
+
+		// Only used while choosing team names, not saved
+		for i := range currentCup.Teams {
+			currentCup.Teams[i].nameIndex = 0
+		}
+
+		loaded := roundTrip(t, currentCup)
+		if !reflect.DeepEqual(loaded, currentCup) {
+			t.Errorf("%s: cup changed after save/load\ngot:      %+v\nexpected: %+v", name, loaded, currentCup)
+		}
+		if loaded.longestTeamName != currentCup.longestTeamName || loaded.longestTeamDescription != currentCup.longestTeamDescription {
+			t.Errorf("%s: team name cache not rebuilt", name)
+		}
+	}
+}
+
+func TestLoadLegacyCup(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"Status":1,"Moderated":true,"Players":[{"Name":"Player1","ID":"1","Team":-1,"Next":-1}],"ChannelID":"legacy"}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "legacy"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cups := make(map[string]*Cup)
+	if err := loadCups(dir, cups); err != nil {
+		t.Fatal(err)
+	}
+	loaded := cups["legacy"]
+	if loaded == nil {
+		t.Fatal("legacy cup not loaded")
+	}
+	if loaded.TeamSize != DefaultTeamSize {
+		t.Errorf("team size: got %d, expected %d", loaded.TeamSize, DefaultTeamSize)
+	}
+	if loaded.Moderated || loaded.Moderation != ModerationAll {
+		t.Errorf("moderation not converted: Moderated %v, Moderation %d", loaded.Moderated, loaded.Moderation)
+	}
+	if loaded.MinimumTeams == 0 || loaded.LastActivity.IsZero() {
+		t.Errorf("defaults not filled in: MinimumTeams %d, LastActivity %v", loaded.MinimumTeams, loaded.LastActivity)
+	}
+}
+
+func TestDistinctName(t *testing.T) {
+	currentCup := makeTestCup(2, 4)
+	currentCup.Players[0].Name = "Twin"
+	currentCup.Players[0].ID = "111111"
+	currentCup.Players[2].Name = "Twin"
+	currentCup.Players[2].ID = "222222"
+	currentCup.pickTestPlayers(4)
+
+	if name := currentCup.distinctName(&currentCup.Players[0]); name != "Twin #1111" {
+		t.Errorf("got %q, expected %q", name, "Twin #1111")
+	}
+	if name := currentCup.distinctName(&currentCup.Players[1]); name != "Player2" {
+		t.Errorf("got %q for a unique name", name)
+	}
+
+	lineup, _ := currentCup.getLineup(0)
+	if expected := "Twin #1111, Twin #2222"; lineup != expected {
+		t.Errorf("got lineup %q, expected %q", lineup, expected)
+	}
+}
+
+func TestSeedRating(t *testing.T) {
+	rated := Player{Rating: 1500, Seed: MaxSeed}
+	if rating := rated.effectiveRating(); rating != 1500 {
+		t.Errorf("seed should not override a known rating, got %d", rating)
+	}
+
+	previous := 0
+	for seed := MaxSeed; seed >= 1; seed-- {
+		player := Player{Seed: seed}
+		rating := player.effectiveRating()
+		if seed < MaxSeed && rating <= previous {
+			t.Errorf("seed %d: rating %d is not higher than %d for seed %d", seed, rating, previous, seed+1)
+		}
+		previous = rating
+	}
+	middle := Player{Seed: (MaxSeed + 1) / 2}
+	if rating := middle.effectiveRating(); rating != DefaultRating {
+		t.Errorf("middle seed: got rating %d, expected %d", rating, DefaultRating)
+	}
+}
+
+func TestDropCupAfterLostAccess(t *testing.T) {
+	savedDir := ChannelDataDir
+	defer func() { ChannelDataDir = savedDir }()
+	ChannelDataDir = t.TempDir()
+
+	s := newFakeSession("guild")
+	currentCup := makeTestCup(2, 4)
+	currentCup.ChannelID = "lost"
+	lockCups.Lock()
+	activeCups[currentCup.ChannelID] = currentCup
+	lockCups.Unlock()
+	defer deleteCup(s, currentCup.ChannelID)
+
+	lost := &discordgo.RESTError{Message: &discordgo.APIErrorMessage{Code: discordgo.ErrCodeMissingAccess}}
+	for i := 1; i < MaxSendFailures; i++ {
+		noteSendResult(s, currentCup.ChannelID, lost)
+	}
+	noteSendResult(s, currentCup.ChannelID, nil)
+	for i := 1; i < MaxSendFailures; i++ {
+		noteSendResult(s, currentCup.ChannelID, lost)
+	}
+	if getCup(currentCup.ChannelID) != currentCup {
+		t.Fatal("cup dropped before reaching the limit of consecutive failures")
+	}
+
+	noteSendResult(s, currentCup.ChannelID, lost)
+	if getCup(currentCup.ChannelID) != nil {
+		t.Fatal("cup not dropped after repeated failures")
+	}
+	saved, err := filepath.Glob(filepath.Join(ChannelDataDir, SetAsideCupsDir, currentCup.ChannelID+"."+SetAsideOrphaned+".*"))
+	if err != nil || len(saved) != 1 {
+		t.Errorf("dropped cup not saved: %v, %v", saved, err)
+	}
+}
+
+func TestAbortStaleCups(t *testing.T) {
+	s := newFakeSession("guild")
+	stale := startFakeCup(t, s, "stale")
+	fresh := startFakeCup(t, s, "fresh")
+	stale.LastActivity = time.Now().Add(-2 * cupOptions.staleTimeout)
+
+	abortStaleCups(s)
+	if getCup("stale") != nil {
+		t.Error("stale cup not aborted")
+	}
+	if getCup("fresh") != fresh {
+		t.Error("active cup aborted")
+	}
+	if len(s.sent) == 0 || !strings.Contains(s.sent[len(s.sent)-1].Content, "aborted automatically") {
+		t.Error("abort not announced")
+	}
+}
+
+func TestCorruptCupSetAside(t *testing.T) {
+	savedDir := ChannelDataDir
+	defer func() { ChannelDataDir = savedDir }()
+	ChannelDataDir = t.TempDir()
+
+	currentCup := makeTestCup(0, 3)
+	currentCup.Status = CupStatusSignup
+	if err := currentCup.saveTo(ChannelDataDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(ChannelDataDir, "broken"), []byte(`{"Status":`), SaveFilePermission); err != nil {
+		t.Fatal(err)
+	}
+
+	cups := make(map[string]*Cup)
+	if err := loadCups(ChannelDataDir, cups); err != nil {
+		t.Fatal(err)
+	}
+	if len(cups) != 1 || cups[currentCup.ChannelID] == nil {
+		t.Errorf("loaded %d cups, expected only %s", len(cups), currentCup.ChannelID)
+	}
+	if _, err := os.Stat(filepath.Join(ChannelDataDir, "broken")); !os.IsNotExist(err) {
+		t.Error("corrupt cup left in place")
+	}
+	moved, err := filepath.Glob(filepath.Join(ChannelDataDir, SetAsideCupsDir, "broken."+SetAsideCorrupt+".*"))
+	if err != nil || len(moved) != 1 {
+		t.Errorf("corrupt cup not moved: %v, %v", moved, err)
+	}
+}
+
+func TestTeamsReady(t *testing.T) {
+	for _, manual := range []bool{false, true} {
+		currentCup := makeTestCup(2, 4)
+		currentCup.ManualLastPick = manual
+
+		currentCup.pickTestPlayers(3)
+		if ready := currentCup.teamsReady(); ready == manual {
+			t.Errorf("manual %v, one slot left: got ready %v", manual, ready)
+		}
+		currentCup.pickTestPlayers(1)
+		if !currentCup.teamsReady() {
+			t.Errorf("manual %v: teams not ready with every slot filled", manual)
+		}
+	}
+}
+
+func TestClearPicks(t *testing.T) {
+	currentCup := makeTestCup(2, 5)
+	currentCup.Teams[0].Color = 3
+	currentCup.pickTestPlayers(3)
+	currentCup.clearPicks()
+
+	if currentCup.PickedPlayers != 0 {
+		t.Errorf("%d picked players left", currentCup.PickedPlayers)
+	}
+	if len(currentCup.Teams) != 2 || len(currentCup.Players) != 5 {
+		t.Fatalf("got %d teams and %d players, expected 2 and 5", len(currentCup.Teams), len(currentCup.Players))
+	}
+	for i, team := range currentCup.Teams {
+		if team.First != -1 || team.Last != -1 {
+			t.Errorf("team %d still has players: first %d, last %d", i, team.First, team.Last)
+		}
+		if team.Name != "Team"+strconv.Itoa(i+1) {
+			t.Errorf("team %d renamed to %q", i, team.Name)
+		}
+	}
+	if currentCup.Teams[0].Color != 3 {
+		t.Errorf("team color lost")
+	}
+	for i, player := range currentCup.Players {
+		if player.Team != -1 || player.Next != -1 {
+			t.Errorf("player %d still picked: team %d, next %d", i, player.Team, player.Next)
+		}
+	}
+
+	// Picking works again from the start
+	currentCup.pickTestPlayers(4)
+	if !currentCup.teamsReady() {
+		t.Errorf("teams not ready after picking again")
+	}
+}
+
+func TestRepairTeams(t *testing.T) {
+	currentCup := makeTestCup(2, 6)
+	currentCup.pickTestPlayers(4)
+	if repairs, err := currentCup.repairTeams(); err != nil || len(repairs) != 0 {
+		t.Fatalf("consistent cup repaired: %v, %v", repairs, err)
+	}
+	expected := []string{}
+	for i := range currentCup.Teams {
+		lineup, _ := currentCup.getLineup(i)
+		expected = append(expected, lineup)
+	}
+
+	// A cycle in the first lineup, and the last player of the second one unlinked
+	first := currentCup.Teams[0].First
+	currentCup.Players[currentCup.Teams[0].Last].Next = first
+	second := &currentCup.Teams[1]
+	currentCup.Players[second.First].Next = -1
+	second.Last = second.First
+	currentCup.PickedPlayers = 7
+
+	repairs, err := currentCup.repairTeams()
+	if err != nil || len(repairs) != 3 {
+		t.Fatalf("got repairs %q, error %v, expected 3 repairs", repairs, err)
+	}
+	for i := range currentCup.Teams {
+		if lineup, _ := currentCup.getLineup(i); lineup != expected[i] {
+			t.Errorf("team %d: lineup %q after repair, expected %q", i+1, lineup, expected[i])
+		}
+	}
+	if currentCup.PickedPlayers != 4 {
+		t.Errorf("%d picked players after repair, expected 4", currentCup.PickedPlayers)
+	}
+	if repairs, _ := currentCup.repairTeams(); len(repairs) != 0 {
+		t.Errorf("repaired cup still inconsistent: %q", repairs)
+	}
+
+	currentCup.Players[5].Team = 2
+	if _, err := currentCup.repairTeams(); err == nil {
+		t.Error("player on a missing team not rejected")
+	}
+}
+
+func TestLongDescription(t *testing.T) {
+	currentCup := makeTestCup(0, 12)
+	currentCup.Status = CupStatusSignup
+	currentCup.Description = strings.Repeat("long ", 500)
+
+	messages := map[string]string{
+		"announcement": currentCup.announcement(""),
+		"invite":       currentCup.inviteText(true),
+		"report":       currentCup.report(CupReportAll),
+	}
+	for name, text := range messages {
+		if length := utf8.RuneCountInString(text); length > MaxMessageLength {
+			t.Errorf("%s with a %d character description is %d characters long", name, len(currentCup.Description), length)
+		}
+		if !strings.Contains(text, currentCup.shortDescription()) {
+			t.Errorf("%s doesn't include the description", name)
+		}
+	}
+	if length := utf8.RuneCountInString(currentCup.shortDescription()); length != MaxDescriptionLength {
+		t.Errorf("description shortened to %d characters, expected %d", length, MaxDescriptionLength)
+	}
+}
+
+func TestParseDescription(t *testing.T) {
+	if description, err := parseDescription("  *Friday* cup_1  "); err != nil || description != "\\*Friday\\* cup\\_1" {
+		t.Errorf("got %q (%v), expected escaped and trimmed text", description, err)
+	}
+
+	// The limit applies to the escaped text, as stored and shown
+	if _, err := parseDescription(strings.Repeat("*", MaxDescriptionLength/2+1)); err == nil {
+		t.Errorf("description over the limit once escaped accepted")
+	}
+}
+
+func TestHeadcount(t *testing.T) {
+	signup := makeTestCup(0, 10)
+	signup.Status = CupStatusSignup
+	signup.TeamSize = 4
+	signup.MinimumTeams = 2
+	if text := signup.headcount(); text != "**10** signed up: 8 active players, 2 substitutes, target 12." {
+		t.Errorf("sign-up headcount: %q", text)
+	}
+
+	pickup := makeTestCup(2, 5)
+	pickup.pickTestPlayers(3)
+	if text := pickup.headcount(); text != "**5** signed up: 4 active players, 1 substitute, 3 picked." {
+		t.Errorf("pickup headcount: %q", text)
+	}
+}
+
+func TestSubOnlyPlayers(t *testing.T) {
+	currentCup := makeTestCup(0, 5)
+	currentCup.Status = CupStatusSignup
+	currentCup.MinimumTeams = 2
+	currentCup.Players[1].SubOnly = true
+
+	if count := currentCup.playingCount(); count != 4 {
+		t.Errorf("%d players can play, expected 4", count)
+	}
+	if target := currentCup.targetPlayerCount(); target != 4 {
+		t.Errorf("target %d, expected 4", target)
+	}
+
+	currentCup.moveSubOnlyLast()
+	names := []string{}
+	for _, player := range currentCup.Players {
+		names = append(names, player.Name)
+	}
+	if expected := []string{"Player1", "Player3", "Player4", "Player5", "Player2"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("got order %v, expected %v", names, expected)
+	}
+}
+
+func TestTeamSizeChangeSummary(t *testing.T) {
+	currentCup := makeTestCup(0, 9)
+	currentCup.Status = CupStatusSignup
+	currentCup.MinimumTeams = 2
+	currentCup.TeamSize = 3
+
+	activeBefore := currentCup.signupActiveCount()
+	currentCup.TeamSize = 4
+	expected := "If sign-up closed now, that would make 2 teams (8 active players) and 1 substitute, instead of 9 active players and 0 substitutes."
+	if summary := currentCup.teamSizeChangeSummary(activeBefore); summary != expected {
+		t.Errorf("got %q, expected %q", summary, expected)
+	}
+
+	currentCup.TeamSize = 5
+	expected = "There aren't enough players for 2 teams of 5 yet (9 players signed up, 10 needed)."
+	if summary := currentCup.teamSizeChangeSummary(8); summary != expected {
+		t.Errorf("got %q, expected %q", summary, expected)
+	}
+}
+
+func TestTeamSizeHistory(t *testing.T) {
+	currentCup := makeTestCup(0, 6)
+	currentCup.Status = CupStatusSignup
+	currentCup.TeamSize = 4
+
+	user := &discordgo.User{ID: "100", Username: "Manager"}
+	currentCup.recordTeamSizeChange(user, 3)
+	currentCup.recordTeamSizeChange(user, 2)
+	if currentCup.TeamSize != 2 {
+		t.Errorf("team size is %d, expected 2", currentCup.TeamSize)
+	}
+	currentCup.logCommand(user, "?draft close")
+	if len(currentCup.Log) != 3 || currentCup.Log[0].Command != "team size changed from 4 to 3" {
+		t.Errorf("team size changes not in the cup log: %+v", currentCup.Log)
+	}
+
+	history := strings.Split(strings.TrimSpace(currentCup.teamSizeHistory()), "\n")
+	if len(history) != 2 {
+		t.Fatalf("got %d history lines, expected 2", len(history))
+	}
+	for i, suffix := range []string{"Manager: 4 -> 3", "Manager: 3 -> 2"} {
+		if !strings.HasSuffix(history[i], suffix) {
+			t.Errorf("line %d is %q, expected it to end with %q", i+1, history[i], suffix)
+		}
+	}
+}
+
+func TestRerollTeamName(t *testing.T) {
+	currentCup := makeTestCup(3, 6)
+	currentCup.chooseTeamNames()
+	others := []string{currentCup.Teams[0].Name, currentCup.Teams[2].Name}
+	for i := 0; i < 50; i++ {
+		before := currentCup.Teams[1].Name
+		currentCup.rerollTeamName(1)
+		if currentCup.Teams[1].Name == before {
+			t.Fatalf("name %q kept", before)
+		}
+		if currentCup.Teams[0].Name != others[0] || currentCup.Teams[2].Name != others[1] {
+			t.Fatalf("other team names changed: %v", currentCup.Teams)
+		}
+		words := strings.Fields(currentCup.Teams[1].Name)
+		for _, other := range []int{0, 2} {
+			otherWords := strings.Fields(currentCup.Teams[other].Name)
+			if words[0] == otherWords[0] || words[1] == otherWords[1] {
+				t.Fatalf("%q shares a word with %q", currentCup.Teams[1].Name, currentCup.Teams[other].Name)
+			}
+		}
+	}
+}
+
+func TestStableSubNumbers(t *testing.T) {
+	currentCup := makeTestCup(2, 0)
+	for i := 1; i <= 7; i++ {
+		id := strconv.Itoa(i)
+		currentCup.addPlayer(Player{Name: "Player" + id, ID: id, Team: -1, Next: -1})
+	}
+	// Players 5 to 7 are substitutes; the first of them leaves, then an active player, replaced by player 6
+	s := newFakeSession("guild")
+	m := fakeMessageCreate("channel", "100", "?draft remove")
+	if !currentCup.removePlayer(s, m, 4, "has left") || !currentCup.removePlayer(s, m, 0, "has left") {
+		t.Fatal("players not removed")
+	}
+
+	if report := currentCup.report(CupReportSubs); !strings.Contains(report, "#7. Player7") {
+		t.Errorf("substitute not listed with his sign-up number:\n%s", report)
+	}
+	for token, expected := range map[string]int{"#7": 4, "5": 4, "#6": 0} {
+		index, err := currentCup.parsePlayerNumber(token)
+		if err != nil || index != expected {
+			t.Errorf("%s: got %d, %v; expected %d", token, index, err, expected)
+		}
+	}
+	for _, token := range []string{"#1", "#5", "#x", "0", "6", "abc"} {
+		if _, err := currentCup.parsePlayerNumber(token); err == nil {
+			t.Errorf("%s: expected an error", token)
+		}
+	}
+}
+
+func TestPassPick(t *testing.T) {
+	currentCup := makeTestCup(3, 9)
+	currentCup.TeamSize = 3
+	currentCup.pickTestPlayers(3)
+
+	first := currentCup.currentPickup().Team
+	if err := currentCup.passPick(); err == nil {
+		t.Fatal("pick passed with passes disabled")
+	}
+	currentCup.AllowPasses = true
+
+	// The team picking first in the second round passes, and picks last in that round instead
+	if err := currentCup.passPick(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		pickup := currentCup.currentPickup()
+		if last := i == 2; (pickup.Team == first) != last {
+			t.Fatalf("pick %d of the round made by team %d", i+1, pickup.Team+1)
+		}
+		if i == 2 {
+			if err := currentCup.passPick(); err == nil {
+				t.Error("team passed twice in one round")
+			}
+		}
+		currentCup.addPlayerToTeam(currentCup.nextAvailablePlayer(), pickup.Team)
+	}
+
+	// The team can pass again in the next round
+	if err := currentCup.passPick(); err != nil {
+		t.Error(err)
+	}
+	for !currentCup.teamsReady() {
+		currentCup.addPlayerToTeam(currentCup.nextAvailablePlayer(), currentCup.currentPickup().Team)
+	}
+
+	currentCup.clearPicks()
+	if len(currentCup.PassedPicks) != 0 {
+		t.Error("passed picks kept after resetting the picks")
+	}
+}
+
+func TestSingleTeamPickupOrder(t *testing.T) {
+	for _, compensation := range []bool{false, true} {
+		sequence := pickupSequence(1, 5, compensation)
+		for pick, slot := range sequence {
+			if slot != (pickupSlot{0, pick}) {
+				t.Errorf("compensation %v, pick %d: got %v", compensation, pick, slot)
+			}
+		}
+	}
+
+	currentCup := makeTestCup(1, 4)
+	currentCup.TeamSize = 3
+	currentCup.pickTestPlayers(3)
+	if !currentCup.teamsReady() {
+		t.Error("single team not complete")
+	}
+	if err := currentCup.skipPick(); err == nil {
+		t.Error("pick skipped with a single team")
+	}
+}
+
+func TestSkipPick(t *testing.T) {
+	currentCup := makeTestCup(2, 6)
+	currentCup.TeamSize = 3
+
+	if err := currentCup.skipPick(); err == nil {
+		t.Error("captain pick skipped")
+	}
+	currentCup.pickTestPlayers(2)
+
+	// Team 1 is away, so team 2 makes both of its picks first
+	if err := currentCup.skipPick(); err != nil {
+		t.Fatal(err)
+	}
+	for _, team := range []int{1, 1, 0, 0} {
+		pickup := currentCup.currentPickup()
+		if pickup.Team != team {
+			t.Fatalf("team %d picking, expected team %d", pickup.Team+1, team+1)
+		}
+		if _, players := currentCup.teamRating(team); pickup.Player != players {
+			t.Errorf("team %d: picking player %d, but the team has %d", team+1, pickup.Player+1, players)
+		}
+		if team == 0 {
+			if err := currentCup.skipPick(); err == nil {
+				t.Error("pick skipped with no other team left to pick")
+			}
+		}
+		currentCup.addPlayerToTeam(currentCup.nextAvailablePlayer(), pickup.Team)
+	}
+	if !currentCup.teamsReady() {
+		t.Error("teams not complete after skipping a pick")
+	}
+
+	currentCup.clearPicks()
+	if len(currentCup.SkippedPicks) != 0 {
+		t.Error("skipped picks kept after resetting the picks")
+	}
+}
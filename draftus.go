@@ -2,11 +2,11 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"math/rand"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -15,18 +15,195 @@ import (
 
 ////////////////////////////////////////////////////////////////
 
-// Update bot status, giving users a starting point.
-func updateBotStatus(s *discordgo.Session) error {
-	err := s.UpdateStatus(0, "type "+draftCommands.prefix)
+// Maximum length of a Discord message
+const (
+	MaxMessageLength = 2000
+)
+
+// Returns true if the request failed because the bot can no longer see the channel
+func isAccessLost(err error) bool {
+	restErr, ok := err.(*discordgo.RESTError)
+	if !ok || restErr.Message == nil {
+		return false
+	}
+	return restErr.Message.Code == discordgo.ErrCodeMissingAccess || restErr.Message.Code == discordgo.ErrCodeUnknownChannel
+}
+
+// Send a message, splitting it up at line breaks if it's too long.
+// Errors are logged here, so callers are free to ignore them.
+// Returns the last message sent.
+func sendMessage(s DiscordSession, channelID string, text string) (*discordgo.Message, error) {
+	var last *discordgo.Message
+	for _, chunk := range splitMessage(text, MaxMessageLength) {
+		message, err := s.ChannelMessageSend(channelID, chunk)
+		if err != nil {
+			logError(logChannel(channelID), "Error sending message:", err)
+			noteSendResult(s, channelID, err)
+			return last, err
+		}
+		last = message
+	}
+	noteSendResult(s, channelID, nil)
+	return last, nil
+}
+
+// Channels in which users have already been warned about missing permissions
+var (
+	lockPermissionWarnings sync.Mutex
+	permissionWarnings     = make(map[string]bool)
+)
+
+// Let users know (once per channel) if the bot can't manage messages.
+func checkPermissionError(s DiscordSession, channelID string, err error) {
+	restErr, ok := err.(*discordgo.RESTError)
+	if !ok || restErr.Message == nil || restErr.Message.Code != discordgo.ErrCodeMissingPermissions {
+		return
+	}
+
+	lockPermissionWarnings.Lock()
+	warned := permissionWarnings[channelID]
+	permissionWarnings[channelID] = true
+	lockPermissionWarnings.Unlock()
+	if warned {
+		return
+	}
+
+	text := "Heads up: I don't have the " + bold("Manage messages") + " permission in this channel, so I can't delete or pin messages.\n" +
+		"Everything else still works, but the channel will get a bit more cluttered."
+	currentCup := getCup(channelID)
+	if currentCup != nil {
+		text = mention(&currentCup.Manager) + ", " + text
+	}
+	_, _ = sendMessage(s, channelID, text)
+}
+
+// Delete a message, warning about missing permissions on failure
+func deleteMessage(s DiscordSession, channelID string, messageID string) error {
+	err := s.ChannelMessageDelete(channelID, messageID)
 	if err != nil {
-		fmt.Println("error updating bot status,", err)
+		logWarn(logChannel(channelID), "Error deleting message:", err)
+		checkPermissionError(s, channelID, err)
 	}
 	return err
 }
 
+// Returns true if command messages are left alone in the given channel, as configured for its guild
+func keepCommands(s DiscordSession, channelID string) bool {
+	return getGuildConfig(channelGuildID(s, channelID)).KeepCommands
+}
+
+// Delete the message a command was issued with, unless the guild prefers to keep commands visible
+func deleteCommand(s DiscordSession, m *discordgo.MessageCreate) {
+	if keepCommands(s, m.ChannelID) {
+		return
+	}
+	deleteMessage(s, m.ChannelID, m.ID)
+}
+
+// Delete several messages with a single request if possible, one by one otherwise
+func deleteMessages(s DiscordSession, channelID string, messageIDs []string) {
+	if len(messageIDs) < 2 {
+		for _, messageID := range messageIDs {
+			deleteMessage(s, channelID, messageID)
+		}
+		return
+	}
+
+	err := s.ChannelMessagesBulkDelete(channelID, messageIDs)
+	if err != nil {
+		// Bulk deletion fails for old messages, among others
+		logDebug(logChannel(channelID), "Bulk delete failed, deleting messages one by one:", err)
+		for _, messageID := range messageIDs {
+			deleteMessage(s, channelID, messageID)
+		}
+	}
+}
+
+// Pin a message, warning about missing permissions on failure
+func pinMessage(s DiscordSession, channelID string, messageID string) error {
+	err := s.ChannelMessagePin(channelID, messageID)
+	if err != nil {
+		logWarn(logChannel(channelID), "Error pinning message:", err)
+		checkPermissionError(s, channelID, err)
+	}
+	return err
+}
+
+func addReaction(s DiscordSession, channelID string, messageID string, emoji string) error {
+	err := s.MessageReactionAdd(channelID, messageID, emoji)
+	if err != nil {
+		logWarn(logChannel(channelID), "Error adding reaction:", err)
+		checkPermissionError(s, channelID, err)
+	}
+	return err
+}
+
+// How long to wait before updating the bot status after a cup starts or ends,
+// so that bursts of changes result in a single update
+const (
+	BotStatusUpdateDelay = 10 * time.Second
+)
+
+var (
+	lockBotStatus  sync.Mutex
+	botStatusTimer *time.Timer
+)
+
+// Update bot status, showing the number of active cups or giving users a starting point.
+func updateBotStatus(s DiscordSession) error {
+	status := "type " + draftCommands.prefix
+	if count := activeCupCount(); count > 0 {
+		status = numbered(count, "cup") + " running"
+	}
+
+	err := s.UpdateStatus(0, status)
+	if err != nil {
+		logWarn("Error updating bot status:", err)
+	}
+	return err
+}
+
+// Schedules a bot status update, unless one is already pending
+func scheduleBotStatusUpdate(s DiscordSession) {
+	lockBotStatus.Lock()
+	defer lockBotStatus.Unlock()
+
+	if botStatusTimer != nil {
+		return
+	}
+	botStatusTimer = time.AfterFunc(BotStatusUpdateDelay, func() {
+		lockBotStatus.Lock()
+		botStatusTimer = nil
+		lockBotStatus.Unlock()
+
+		updateBotStatus(s)
+	})
+}
+
 // This function will be called every time a new message is created
 // on any channel that the autenticated bot has access to.
-func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+func onMessageCreate(session *discordgo.Session, m *discordgo.MessageCreate) {
+	handleMessage(liveSession{session}, m)
+}
+
+// Returns true if the given draft command may be used in the message's channel
+func isCommandAllowed(s DiscordSession, cmd *command, m *discordgo.MessageCreate) bool {
+	// Settings and help stay available everywhere, so a bad channel list can be fixed
+	if cmd == &commandConfig || cmd == &commandHelp || len(m.GuildID) == 0 || isChannelAllowed(s, m.GuildID, m.ChannelID) {
+		return true
+	}
+
+	// Cups already running in a channel that's no longer allowed can still be played out,
+	// but no new ones can be started there
+	if getCup(m.ChannelID) != nil {
+		return true
+	}
+	startsCup := cmd == &commandStart || cmd == &commandCopy || cmd == &commandClone || cmd == &commandRematch
+	return getFinishedCup(m.ChannelID) != nil && !startsCup
+}
+
+// Dispatches a message to the command it invokes, if any
+func handleMessage(s DiscordSession, m *discordgo.MessageCreate) {
 	// Ignore all messages created by the bot itself
 	if m.Author.ID == BotID {
 		return
@@ -56,13 +233,28 @@ func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		token = strings.ToLower(token)
 
 		for _, cmd := range group.commands {
-			if cmd.name == token {
+			if cmd.hasName(token) {
+				if group == &draftCommands && !isCommandAllowed(s, cmd, m) {
+					_, _ = sendMessage(s, m.ChannelID, bold(escape(m.Author.Username))+", "+allowedChannelsHint(m.GuildID))
+					return
+				}
+
+				cupBefore := getCup(m.ChannelID)
 				cmd.execute(command, s, m)
+
+				// Log the command in the cup it affected (the previous one, if it was aborted or finished)
+				currentCup := getCup(m.ChannelID)
+				if currentCup == nil {
+					currentCup = cupBefore
+				}
+				if currentCup != nil && group == &draftCommands {
+					currentCup.logCommand(m.Author, cmd.syntaxNoArgs()+" "+command)
+				}
 				return
 			}
 		}
 
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Unknown command, '"+token+"'.\n")
+		_, _ = sendMessage(s, m.ChannelID, "Unknown command, '"+token+"'.\n")
 		commandHelp.execute("", s, m)
 		return
 
@@ -72,11 +264,16 @@ func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 }
 
 func onReady(s *discordgo.Session, m *discordgo.Ready) {
-	updateBotStatus(s)
+	updateBotStatus(liveSession{s})
 }
 
 func onResumed(s *discordgo.Session, m *discordgo.Resumed) {
-	updateBotStatus(s)
+	updateBotStatus(liveSession{s})
+}
+
+// discordgo waits out rate limits on its own, so they're only logged
+func onRateLimit(s *discordgo.Session, r *discordgo.RateLimit) {
+	logDebug("Rate limited on", r.URL+", retrying after", r.RetryAfter)
 }
 
 ////////////////////////////////////////////////////////////////
@@ -88,8 +285,28 @@ var (
 
 // Variables used for command line parameters
 var (
-	Token string
-	BotID string
+	Token   string
+	BotID   string
+	OwnerID string
+
+	// Cup settings
+	cupOptions struct {
+		minimumTeams    int
+		allowSingleTeam bool
+
+		moderationExemptBots   bool
+		moderationExemptAdmins bool
+		moderationNotice       string
+
+		staleTimeout time.Duration
+
+		webhookURL string
+
+		announceMention string
+	}
+
+	logLevelName string
+	scriptPath   string // if set, the commands in this file are run against a fake session instead of connecting
 
 	// Developer hacks, for easier testing
 	devHacks struct {
@@ -102,36 +319,103 @@ var (
 // Application initialization
 func init() {
 	flag.StringVar(&Token, "t", "", "Bot Token")
+	flag.StringVar(&OwnerID, "owner", "", "User ID of the bot owner, allowed to use admin commands")
+	flag.StringVar(&ChannelDataDir, "data", ChannelDataDir, "Folder where cups are saved")
+	flag.IntVar(&cupOptions.minimumTeams, "minteams", DefaultMinimumTeams, "Default minimum number of teams in a cup")
+	flag.BoolVar(&cupOptions.allowSingleTeam, "allow-single-team", false, "Allow cups with a single team")
+	flag.BoolVar(&cupOptions.moderationExemptBots, "moderation-exempt-bots", true, "Don't remove messages from other bots in moderated channels")
+	flag.BoolVar(&cupOptions.moderationExemptAdmins, "moderation-exempt-admins", true, "Don't remove messages from cup managers and admins in moderated channels")
+	flag.StringVar(&cupOptions.moderationNotice, "moderation-notice", ModerationNoticeOff, "How to tell users their message was removed by moderation (off, dm or channel)")
+	flag.DurationVar(&cupOptions.staleTimeout, "stale-timeout", 24*time.Hour, "Abort cups without sign-up activity for this long (0 to disable)")
+	flag.StringVar(&cupOptions.webhookURL, "webhook", "", "URL to POST cup start, close and completion events to (optional)")
+	flag.StringVar(&cupOptions.announceMention, "announce-mention", AnnounceEveryone, "Default mention for announcements (everyone, here, none or a role ID)")
+	flag.StringVar(&logLevelName, "loglevel", "info", "Minimum level of log messages to show (debug, info, warn or error)")
+	flag.StringVar(&scriptPath, "script", "", "Run the commands in the given file without connecting to Discord, printing the replies (dry run)")
 	flag.BoolVar(&devHacks.allowDuplicates, "dev-allowdup", false, "Allow multiple sign up")
 	flag.BoolVar(&devHacks.saveOnWho, "dev-saveonwho", false, "Save cup on who command")
 	flag.IntVar(&devHacks.fillUpOnClose, "dev-autofill", 0, "Number of slots to fill up on close")
-	flag.Parse()
 
 	rand.Seed(time.Now().UTC().UnixNano())
 
 	// Commands are initialized here to avoid an initialization loop.
 	setupCommands()
+}
+
+// Parse command line and restore saved state.
+// Note: this is not done in init, so that tests can register their own flags.
+func startup() bool {
+	flag.Parse()
+
+	level, valid := parseLogLevel(logLevelName)
+	if !valid {
+		logWarn("Invalid log level,", logLevelName, "- using info")
+	}
+	logLevel = level
+
+	if cupOptions.minimumTeams < lowestMinimumTeams() {
+		logWarn("Invalid minimum number of teams,", cupOptions.minimumTeams, "- using", DefaultMinimumTeams)
+		cupOptions.minimumTeams = DefaultMinimumTeams
+	}
+
+	switch cupOptions.moderationNotice {
+	case ModerationNoticeOff, ModerationNoticeDM, ModerationNoticeChannel:
+	default:
+		logWarn("Invalid moderation notice option,", cupOptions.moderationNotice, "- using", ModerationNoticeOff)
+		cupOptions.moderationNotice = ModerationNoticeOff
+	}
+
+	if !isValidAnnounceMention(cupOptions.announceMention) {
+		logWarn("Invalid announcement mention option,", cupOptions.announceMention, "- using", AnnounceEveryone)
+		cupOptions.announceMention = AnnounceEveryone
+	}
+
+	if len(scriptPath) > 0 {
+		logInfo("Running script", scriptPath, "- cups are neither loaded nor saved, and no webhook events are sent")
+		ChannelDataDir = ""
+		cupOptions.webhookURL = ""
+	}
 
 	if len(ChannelDataDir) > 0 {
-		fmt.Println("Data folder: ", ChannelDataDir)
+		logInfo("Data folder:", ChannelDataDir)
+		err := checkDataDir(ChannelDataDir)
+		if err != nil {
+			logError("Data folder is not writable, cups can't be saved:", err)
+			return false
+		}
+		logInfo("Data folder is writable.")
+		loadGuildConfigs()
 		resumeState()
 	}
+
+	return true
 }
 
 // Application main function
 func main() {
+	if !startup() {
+		os.Exit(1)
+	}
+
+	if len(scriptPath) > 0 {
+		if err := runScript(scriptPath, os.Stdout); err != nil {
+			logError("Error running script:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Create a new Discord session using the provided bot token.
 	var err error
 	Session, err = discordgo.New("Bot " + Token)
 	if err != nil {
-		fmt.Println("error creating Discord session,", err)
+		logError("Error creating Discord session:", err)
 		return
 	}
 
 	// Get the account information.
 	u, err := Session.User("@me")
 	if err != nil {
-		fmt.Println("error obtaining account details,", err)
+		logError("Error obtaining account details:", err)
 		return
 	}
 
@@ -142,16 +426,23 @@ func main() {
 	Session.AddHandler(onMessageCreate)
 	Session.AddHandler(onReady)
 	Session.AddHandler(onResumed)
+	Session.AddHandler(onRateLimit)
 
 	// Open the websocket and begin listening.
 	err = Session.Open()
 	if err != nil {
-		fmt.Println("error opening connection,", err)
+		logError("Error opening connection:", err)
 		return
 	}
 	defer Session.Close()
 
-	fmt.Println("Bot is now running. Press CTRL-C to exit.")
+	// Cups loaded from disk can only be checked against Discord after connecting.
+	verifyLastReplies(liveSession{Session})
+	scheduleReminders(liveSession{Session})
+	scheduleVoiceChannelCleanups(liveSession{Session})
+	go sweepStaleCups(liveSession{Session})
+
+	logInfo("Bot is now running. Press CTRL-C to exit.")
 
 	// Intercept signals in order to shut down gracefully.
 	sigs := make(chan os.Signal, 1)
@@ -159,13 +450,13 @@ func main() {
 
 	go func() {
 		sig := <-sigs
-		fmt.Println("Caught signal", sig)
+		logInfo("Caught signal", sig)
 		done <- true
 	}()
 
 	<-done
 
-	fmt.Println("Bot stopped.")
+	logInfo("Bot stopped.")
 
 	suspendState()
 
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Message sent through a fakeSession
+type fakeMessage struct {
+	ChannelID string
+	Content   string
+}
+
+// fakeSession records the calls made to the Discord API, pretending every call succeeds.
+// All channels belong to the same guild, nobody has a nickname, and roles are named after their IDs.
+// Used by the tests and by script mode, which echoes the messages to an output.
+type fakeSession struct {
+	guildID  string
+	echo     io.Writer // if set, sent and edited messages are written here
+	sent     []fakeMessage
+	edited   []fakeMessage
+	deleted  []string
+	pinned   []string
+	unpinned []string
+	messages int                 // number of message IDs handed out
+	roles    map[string][]string // role IDs of each user, by user ID
+}
+
+var errFakeNotFound = errors.New("not found")
+
+func newFakeSession(guildID string) *fakeSession {
+	return &fakeSession{guildID: guildID}
+}
+
+func (f *fakeSession) newMessage(channelID string, content string) *discordgo.Message {
+	f.messages++
+	return &discordgo.Message{ID: "message" + strconv.Itoa(f.messages), ChannelID: channelID, Content: content}
+}
+
+func (f *fakeSession) Channel(channelID string) (*discordgo.Channel, error) {
+	return f.StateChannel(channelID)
+}
+
+func (f *fakeSession) ChannelDelete(channelID string) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: channelID, GuildID: f.guildID}, nil
+}
+
+func (f *fakeSession) ChannelMessage(channelID string, messageID string) (*discordgo.Message, error) {
+	return nil, errFakeNotFound
+}
+
+func (f *fakeSession) ChannelMessageDelete(channelID string, messageID string) error {
+	f.deleted = append(f.deleted, messageID)
+	return nil
+}
+
+func (f *fakeSession) ChannelMessageEdit(channelID string, messageID string, content string) (*discordgo.Message, error) {
+	f.edited = append(f.edited, fakeMessage{channelID, content})
+	if f.echo != nil {
+		fmt.Fprintf(f.echo, "[#%s, edited]\n%s\n\n", channelID, content)
+	}
+	return &discordgo.Message{ID: messageID, ChannelID: channelID, Content: content}, nil
+}
+
+func (f *fakeSession) ChannelMessagePin(channelID string, messageID string) error {
+	f.pinned = append(f.pinned, messageID)
+	return nil
+}
+
+func (f *fakeSession) ChannelMessageSend(channelID string, content string) (*discordgo.Message, error) {
+	f.sent = append(f.sent, fakeMessage{channelID, content})
+	if f.echo != nil {
+		fmt.Fprintf(f.echo, "[#%s]\n%s\n\n", channelID, content)
+	}
+	return f.newMessage(channelID, content), nil
+}
+
+func (f *fakeSession) ChannelMessageUnpin(channelID string, messageID string) error {
+	f.unpinned = append(f.unpinned, messageID)
+	return nil
+}
+
+func (f *fakeSession) ChannelMessagesBulkDelete(channelID string, messages []string) error {
+	f.deleted = append(f.deleted, messages...)
+	return nil
+}
+
+func (f *fakeSession) ChannelMessagesPinned(channelID string) ([]*discordgo.Message, error) {
+	var pinned []*discordgo.Message
+	for _, messageID := range f.pinned {
+		if !f.wasUnpinned(messageID) {
+			pinned = append(pinned, &discordgo.Message{ID: messageID, ChannelID: channelID, Author: &discordgo.User{ID: BotID}})
+		}
+	}
+	return pinned, nil
+}
+
+func (f *fakeSession) wasUnpinned(messageID string) bool {
+	for _, unpinned := range f.unpinned {
+		if unpinned == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeSession) GuildChannelCreateComplex(guildID string, data discordgo.GuildChannelCreateData) (*discordgo.Channel, error) {
+	f.messages++
+	return &discordgo.Channel{ID: "channel" + strconv.Itoa(f.messages), GuildID: guildID, Name: data.Name, Type: data.Type}, nil
+}
+
+func (f *fakeSession) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	return nil, nil
+}
+
+func (f *fakeSession) GuildMember(guildID string, userID string) (*discordgo.Member, error) {
+	return &discordgo.Member{GuildID: guildID, User: &discordgo.User{ID: userID}, Roles: f.roles[userID]}, nil
+}
+
+func (f *fakeSession) GuildMemberMove(guildID string, userID string, channelID *string) error {
+	return nil
+}
+
+func (f *fakeSession) MessageReactionAdd(channelID string, messageID string, emojiID string) error {
+	return nil
+}
+
+func (f *fakeSession) UpdateStatus(idle int, game string) error {
+	return nil
+}
+
+func (f *fakeSession) UserChannelCreate(recipientID string) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: "dm" + recipientID}, nil
+}
+
+func (f *fakeSession) UserChannelPermissions(userID string, channelID string) (int, error) {
+	return discordgo.PermissionAll, nil
+}
+
+func (f *fakeSession) StateChannel(channelID string) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: channelID, GuildID: f.guildID}, nil
+}
+
+func (f *fakeSession) StateGuild(guildID string) (*discordgo.Guild, error) {
+	return &discordgo.Guild{ID: guildID, Name: "Guild " + guildID}, nil
+}
+
+func (f *fakeSession) StateGuilds() []*discordgo.Guild {
+	guild, _ := f.StateGuild(f.guildID)
+	return []*discordgo.Guild{guild}
+}
+
+func (f *fakeSession) StateMember(guildID string, userID string) (*discordgo.Member, error) {
+	return nil, errFakeNotFound
+}
+
+func (f *fakeSession) StateMemberAdd(member *discordgo.Member) error {
+	return nil
+}
+
+func (f *fakeSession) StateRole(guildID string, roleID string) (*discordgo.Role, error) {
+	return &discordgo.Role{ID: roleID, Name: roleID}, nil
+}
+
+// Returns a message from the given user, as received from Discord.
+// User mentions in the content (e.g. <@123>) are filled in as well.
+func fakeMessageCreate(channelID string, userID string, content string) *discordgo.MessageCreate {
+	var mentions []*discordgo.User
+	for _, match := range fakeMentionPattern.FindAllStringSubmatch(content, -1) {
+		mentions = append(mentions, &discordgo.User{ID: match[1], Username: "User" + match[1]})
+	}
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "command" + userID + ":" + content,
+		ChannelID: channelID,
+		Content:   content,
+		Author:    &discordgo.User{ID: userID, Username: "User" + userID},
+		Mentions:  mentions,
+	}}
+}
+
+var fakeMentionPattern = regexp.MustCompile(`<@!?(\d+)>`)
@@ -0,0 +1,838 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////
+// Per-guild settings
+////////////////////////////////////////////////////////////////
+
+// GuildConfig holds settings that apply to all cups in a guild
+type GuildConfig struct {
+	GuildID          string
+	Language         string
+	InviteChannelID  string   `json:",omitempty"` // where cup invites are cross-posted
+	ResultsChannelID string   `json:",omitempty"` // where the final teams are cross-posted
+	AnnounceMention  string   `json:",omitempty"` // who gets pinged by announcements (empty for the default)
+	AllowedChannels  []string `json:",omitempty"` // IDs of the channels or categories cups can be run in (empty for all)
+	Reactions        bool     `json:",omitempty"` // acknowledge simple commands with reactions instead of text
+	KeepCommands     bool     `json:",omitempty"` // leave command messages in the channel instead of deleting them
+	VoiceChannels    bool     `json:",omitempty"` // create a voice channel for each team when teams are complete
+	MoveToVoice      bool     `json:",omitempty"` // move players already in voice to their team's channel
+	Subscribers      []string `json:",omitempty"` // IDs of users notified when a cup starts
+
+	// Defaults for new cups (zero values mean the global defaults apply)
+	TeamSize               int           `json:",omitempty"`
+	MinimumTeams           int           `json:",omitempty"`
+	AdminRoles             []string      `json:",omitempty"` // in addition to the built-in admin role names
+	PromoteInterval        time.Duration `json:",omitempty"`
+	PromoteIntervalManager time.Duration `json:",omitempty"`
+}
+
+// Announcement mention settings; any other value is a role ID
+const (
+	AnnounceEveryone = "everyone"
+	AnnounceHere     = "here"
+	AnnounceNone     = "none"
+)
+
+// Folder where guild settings are saved, relative to ChannelDataDir
+const (
+	GuildDataDir = "guilds"
+)
+
+var (
+	lockGuilds   sync.Mutex
+	guildConfigs = make(map[string]*GuildConfig)
+)
+
+// Returns a copy of the settings for the given guild
+func getGuildConfig(guildID string) GuildConfig {
+	lockGuilds.Lock()
+	defer lockGuilds.Unlock()
+	config := guildConfigs[guildID]
+	if config == nil {
+		return GuildConfig{GuildID: guildID}
+	}
+	return *config
+}
+
+// Changes the settings for the given guild and saves them.
+// If update returns an error, the settings are left as they were and the error is passed on.
+func updateGuildConfig(guildID string, update func(*GuildConfig) error) error {
+	lockGuilds.Lock()
+	defer lockGuilds.Unlock()
+
+	config := GuildConfig{GuildID: guildID}
+	if current := guildConfigs[guildID]; current != nil {
+		config = *current
+	}
+	if err := update(&config); err != nil {
+		return err
+	}
+	guildConfigs[guildID] = &config
+
+	// Saved with the lock held, so concurrent changes reach the disk in order
+	return config.save()
+}
+
+func (config *GuildConfig) save() error {
+	if len(ChannelDataDir) <= 0 {
+		return os.ErrInvalid
+	}
+
+	dir := filepath.Join(ChannelDataDir, GuildDataDir)
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(dir, config.GuildID, contents)
+}
+
+// Load all guild settings from disk
+func loadGuildConfigs() error {
+	configs, _, err := readGuildConfigs()
+	if err != nil {
+		return err
+	}
+
+	lockGuilds.Lock()
+	defer lockGuilds.Unlock()
+
+	for guildID, config := range configs {
+		guildConfigs[guildID] = config
+	}
+
+	return nil
+}
+
+// Replaces the guild settings in memory with the ones on disk, all at once.
+// Guilds whose files can't be read keep their current settings.
+// Returns the names of the changed settings for each guild whose settings differ.
+func reloadGuildConfigs() (map[string][]string, error) {
+	configs, skipped, err := readGuildConfigs()
+	if os.IsNotExist(err) && len(ChannelDataDir) > 0 {
+		// No guild has changed its settings yet
+		configs, err = make(map[string]*GuildConfig), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lockGuilds.Lock()
+	defer lockGuilds.Unlock()
+
+	// Dropping these would reset the guild to the defaults, and the next change would overwrite the file
+	for _, guildID := range skipped {
+		if previous := guildConfigs[guildID]; previous != nil {
+			configs[guildID] = previous
+		}
+	}
+
+	changed := make(map[string][]string)
+	for guildID, config := range configs {
+		if names := changedSettings(guildConfigs[guildID], config); len(names) > 0 {
+			changed[guildID] = names
+		}
+	}
+	for guildID, previous := range guildConfigs {
+		if configs[guildID] == nil {
+			if names := changedSettings(previous, nil); len(names) > 0 {
+				changed[guildID] = names
+			}
+		}
+	}
+
+	guildConfigs = configs
+	return changed, nil
+}
+
+// Returns the names of the settings that differ between the two configs (either of which may be nil)
+func changedSettings(before *GuildConfig, after *GuildConfig) []string {
+	if before == nil {
+		before = &GuildConfig{}
+	}
+	if after == nil {
+		after = &GuildConfig{}
+	}
+
+	var names []string
+	for i := range configSettings {
+		setting := &configSettings[i]
+		if setting.get(before) != setting.get(after) {
+			names = append(names, setting.name)
+		}
+	}
+	if !reflect.DeepEqual(before.Subscribers, after.Subscribers) {
+		names = append(names, "subscribers")
+	}
+	return names
+}
+
+// Reads all guild settings from disk, without touching the ones in memory.
+// Also returns the names of the files that couldn't be read.
+func readGuildConfigs() (map[string]*GuildConfig, []string, error) {
+	if len(ChannelDataDir) <= 0 {
+		return nil, nil, os.ErrNotExist
+	}
+
+	dir := filepath.Join(ChannelDataDir, GuildDataDir)
+	fileList, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configs := make(map[string]*GuildConfig)
+	var skipped []string
+	for _, file := range fileList {
+		if file.IsDir() {
+			continue
+		}
+		name := file.Name()
+		contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			logError(logGuild(name), "Error reading guild settings:", err)
+			skipped = append(skipped, name)
+			continue
+		}
+
+		config := new(GuildConfig)
+		err = json.Unmarshal(contents, config)
+		if err != nil {
+			logError(logGuild(name), "Error parsing guild settings:", err)
+			skipped = append(skipped, name)
+			continue
+		}
+
+		if config.GuildID != name {
+			logWarn(fmt.Sprintf("File name/guild ID mismatch: '%s' vs '%s', ignoring...", name, config.GuildID))
+			skipped = append(skipped, name)
+			continue
+		}
+
+		configs[config.GuildID] = config
+	}
+
+	return configs, skipped, nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// Returns the ID of the guild the given channel belongs to, or an empty string on error
+func channelGuildID(s DiscordSession, channelID string) string {
+	channel, err := s.StateChannel(channelID)
+	if err != nil {
+		channel, err = s.Channel(channelID)
+	}
+	if err != nil {
+		logWarn(logChannel(channelID), "Could not retrieve channel info:", err)
+		return ""
+	}
+	return channel.GuildID
+}
+
+// Returns true if draft commands may be used in the given channel
+func isChannelAllowed(s DiscordSession, guildID string, channelID string) bool {
+	config := getGuildConfig(guildID)
+	if len(config.AllowedChannels) == 0 {
+		return true
+	}
+
+	parentID := ""
+	if channel, err := s.StateChannel(channelID); err == nil && channel != nil {
+		parentID = channel.ParentID
+	}
+	for _, allowed := range config.AllowedChannels {
+		if allowed == channelID || (len(parentID) > 0 && allowed == parentID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a hint listing the channels draft commands may be used in
+func allowedChannelsHint(guildID string) string {
+	config := getGuildConfig(guildID)
+	return "cups can only be run in " + strings.Join(mentionChannels(config.AllowedChannels), ", ") + " on this server."
+}
+
+// Names of the roles that grant admin rights for cups (case-insensitive)
+var (
+	adminRoleNames = [...]string{
+		"DraftusAdmin",
+		"Admins",
+		"Admin",
+		"Supervisors",
+		"Supervisor",
+		"DraftCupOrganizer",
+	}
+)
+
+// Returns the names of the roles the given user has in the given guild
+func memberRoleNames(s DiscordSession, guildID string, id string) ([]string, error) {
+	// This runs for every message in moderated channels, so try the state cache first
+	member, err := s.StateMember(guildID, id)
+	if err != nil {
+		member, err = s.GuildMember(guildID, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.StateMemberAdd(member); err != nil {
+			logDebug(logGuild(guildID), "Could not cache guild member:", err)
+		}
+	}
+
+	var names []string
+	for _, roleID := range member.Roles {
+		role, err := s.StateRole(guildID, roleID)
+		if err != nil {
+			logWarn(logGuild(guildID), "Error retrieving role info:", err)
+			continue
+		}
+		names = append(names, role.Name)
+	}
+	return names, nil
+}
+
+// Returns the names of the roles that grant admin rights in the given guild
+func guildAdminRoles(guildID string) []string {
+	return append(adminRoleNames[:], getGuildConfig(guildID).AdminRoles...)
+}
+
+// Returns the first role name that grants admin rights in the given guild, or an empty string if none does
+func matchAdminRole(guildID string, roleNames []string) string {
+	adminRoles := guildAdminRoles(guildID)
+	for _, name := range roleNames {
+		for _, adminRoleName := range adminRoles {
+			if strings.EqualFold(name, adminRoleName) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Checks whether the given user has one of the admin roles in the given guild
+func isAdmin(s DiscordSession, guildID string, id string) bool {
+	roleNames, err := memberRoleNames(s, guildID, id)
+	if err != nil {
+		logWarn(logGuild(guildID), "Error retrieving guild member:", err)
+		return false
+	}
+	return len(matchAdminRole(guildID, roleNames)) > 0
+}
+
+// Time between direct messages sent to subscribers, to avoid hitting rate limits
+const (
+	SubscriberNotificationInterval = time.Second
+)
+
+// Returns true if the given user is notified when a cup starts in the given guild
+func (config *GuildConfig) isSubscribed(userID string) bool {
+	for _, id := range config.Subscribers {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds or removes a user from the subscriber list of the given guild.
+// Returns false if nothing changed.
+func setSubscribed(guildID string, userID string, subscribed bool) (bool, error) {
+	changed := false
+	err := updateGuildConfig(guildID, func(config *GuildConfig) error {
+		if config.isSubscribed(userID) == subscribed {
+			return nil
+		}
+		changed = true
+		if subscribed {
+			config.Subscribers = append(config.Subscribers, userID)
+			return nil
+		}
+		// Build a new list, since copies of the old one may still be in use
+		var remaining []string
+		for _, id := range config.Subscribers {
+			if id != userID {
+				remaining = append(remaining, id)
+			}
+		}
+		config.Subscribers = remaining
+		return nil
+	})
+	return changed, err
+}
+
+// Sends a direct message about a new cup to every subscriber in the cup's guild (except its manager).
+// Messages are sent in the background, spaced out to go easy on the API.
+func (currentCup *Cup) notifySubscribers(s DiscordSession) {
+	subscribers := getGuildConfig(currentCup.GuildID).Subscribers
+	if len(subscribers) == 0 {
+		return
+	}
+
+	text := "A new draft cup was started in " + mentionChannel(currentCup.ChannelID) + " by " + display(&currentCup.Manager) + ".\n"
+	if len(currentCup.Description) > 0 {
+		text += "\n" + currentCup.shortDescription() + "\n"
+	}
+	text += "\nTo sign up, type " + bold(commandAdd.syntaxNoArgs()) + " in that channel. " +
+		"To stop getting these messages, type " + bold(commandUnsubscribe.syntax()) + " on the server."
+
+	managerID := currentCup.Manager.ID
+	channelID := currentCup.ChannelID
+	go func() {
+		for _, userID := range subscribers {
+			if userID == managerID {
+				continue
+			}
+			channel, err := s.UserChannelCreate(userID)
+			if err == nil {
+				// Users may have DMs turned off, so failures are only logged
+				_, err = s.ChannelMessageSend(channel.ID, text)
+			}
+			if err != nil {
+				logDebug(logChannel(channelID), "Could not notify subscriber", userID+":", err)
+			}
+			time.Sleep(SubscriberNotificationInterval)
+		}
+	}()
+}
+
+// Returns true if the given announcement mention setting is valid
+func isValidAnnounceMention(setting string) bool {
+	switch setting {
+	case AnnounceEveryone, AnnounceHere, AnnounceNone:
+		return true
+	}
+	if len(setting) == 0 {
+		return false
+	}
+	for _, c := range setting {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the announcement mention setting for the given guild
+func announceSetting(guildID string) string {
+	setting := getGuildConfig(guildID).AnnounceMention
+	if len(setting) == 0 {
+		return cupOptions.announceMention
+	}
+	return setting
+}
+
+// Returns a description of the given announcement mention setting, without pinging anyone
+func describeAnnounceSetting(setting string) string {
+	switch setting {
+	case AnnounceEveryone:
+		return "everyone"
+	case AnnounceHere:
+		return "online members"
+	case AnnounceNone:
+		return "nobody"
+	}
+	return "the role with ID " + setting
+}
+
+// Returns the mention used in announcements in the given guild, or an empty string if nobody is pinged
+func announceMention(guildID string) string {
+	setting := announceSetting(guildID)
+	switch setting {
+	case AnnounceEveryone:
+		return "@everyone"
+	case AnnounceHere:
+		return "@here"
+	case AnnounceNone:
+		return ""
+	}
+	return "<@&" + setting + ">"
+}
+
+// Returns a greeting for announcements, mentioning the configured audience (if any)
+func announceGreeting(guildID string) string {
+	mention := announceMention(guildID)
+	if len(mention) == 0 {
+		return "Hey!\n\n"
+	}
+	return "Hey, " + mention + "!\n\n"
+}
+
+// Returns a farewell for announcements, mentioning the configured audience (if any)
+func announceFarewell(guildID string) string {
+	mention := announceMention(guildID)
+	if len(mention) == 0 {
+		return "Good luck and have fun!"
+	}
+	return "Good luck and have fun, " + mention + "!"
+}
+
+////////////////////////////////////////////////////////////////
+// Configurable settings
+////////////////////////////////////////////////////////////////
+
+// Resets a setting to its default value
+const (
+	ConfigDefaultValue = "default"
+)
+
+type configSetting struct {
+	name        string
+	description string
+	get         func(config *GuildConfig) string
+	set         func(config *GuildConfig, value string) error // validates the value first
+	reset       func(config *GuildConfig)
+}
+
+var (
+	configSettings = [...]configSetting{
+		{
+			name:        "language",
+			description: "Language used for cup reports",
+			get: func(config *GuildConfig) string {
+				if !isLanguageSupported(config.Language) {
+					return DefaultLanguage
+				}
+				return config.Language
+			},
+			set: func(config *GuildConfig, value string) error {
+				value = strings.ToLower(value)
+				if !isLanguageSupported(value) {
+					return fmt.Errorf("'%s' is not a supported language. Supported languages: %s", value, supportedLanguages())
+				}
+				config.Language = value
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.Language = ""
+			},
+		},
+		{
+			name:        "mention",
+			description: "Who gets mentioned in announcements (everyone, here, none or a role ID)",
+			get: func(config *GuildConfig) string {
+				if len(config.AnnounceMention) == 0 {
+					return cupOptions.announceMention
+				}
+				return config.AnnounceMention
+			},
+			set: func(config *GuildConfig, value string) error {
+				value = strings.ToLower(value)
+				if strings.HasPrefix(value, "<@&") && strings.HasSuffix(value, ">") {
+					value = value[3 : len(value)-1]
+				}
+				if !isValidAnnounceMention(value) {
+					return fmt.Errorf("'%s' is not valid, use everyone, here, none or a role", value)
+				}
+				config.AnnounceMention = value
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.AnnounceMention = ""
+			},
+		},
+		{
+			name:        "invitechannel",
+			description: "Channel cup invites are cross-posted to",
+			get: func(config *GuildConfig) string {
+				if len(config.InviteChannelID) == 0 {
+					return "none"
+				}
+				return mentionChannel(config.InviteChannelID)
+			},
+			set: func(config *GuildConfig, value string) error {
+				channelID := parseChannelMention(value)
+				if strings.EqualFold(value, "none") {
+					channelID = ""
+				} else if len(channelID) == 0 {
+					return fmt.Errorf("'%s' is not a channel mention", value)
+				}
+				config.InviteChannelID = channelID
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.InviteChannelID = ""
+			},
+		},
+		{
+			name:        "resultschannel",
+			description: "Channel the final teams of each cup are cross-posted to",
+			get: func(config *GuildConfig) string {
+				if len(config.ResultsChannelID) == 0 {
+					return "none"
+				}
+				return mentionChannel(config.ResultsChannelID)
+			},
+			set: func(config *GuildConfig, value string) error {
+				channelID := parseChannelMention(value)
+				if strings.EqualFold(value, "none") {
+					channelID = ""
+				} else if len(channelID) == 0 {
+					return fmt.Errorf("'%s' is not a channel mention", value)
+				}
+				config.ResultsChannelID = channelID
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.ResultsChannelID = ""
+			},
+		},
+		{
+			name:        "channels",
+			description: "Channels or categories cups can be run in (space-separated mentions or IDs)",
+			get: func(config *GuildConfig) string {
+				if len(config.AllowedChannels) == 0 {
+					return "all"
+				}
+				return strings.Join(mentionChannels(config.AllowedChannels), " ")
+			},
+			set: func(config *GuildConfig, value string) error {
+				var channels []string
+				if !strings.EqualFold(value, "all") {
+					for _, token := range strings.Fields(strings.ReplaceAll(value, ",", " ")) {
+						channelID := parseChannelMention(token)
+						if len(channelID) == 0 {
+							if _, err := strconv.ParseUint(token, 10, 64); err != nil {
+								return fmt.Errorf("'%s' is not a channel mention or ID", token)
+							}
+							channelID = token
+						}
+						channels = append(channels, channelID)
+					}
+				}
+				config.AllowedChannels = channels
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.AllowedChannels = nil
+			},
+		},
+		{
+			name:        "reactions",
+			description: "React to sign-ups and withdrawals instead of replying with text (on or off)",
+			get: func(config *GuildConfig) string {
+				if config.Reactions {
+					return "on"
+				}
+				return "off"
+			},
+			set: func(config *GuildConfig, value string) error {
+				switch strings.ToLower(value) {
+				case "on":
+					config.Reactions = true
+				case "off":
+					config.Reactions = false
+				default:
+					return fmt.Errorf("'%s' is not a valid option, use on or off", value)
+				}
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.Reactions = false
+			},
+		},
+		{
+			name:        "keepcommands",
+			description: "Leave command messages in the channel instead of deleting them (on or off)",
+			get: func(config *GuildConfig) string {
+				if config.KeepCommands {
+					return "on"
+				}
+				return "off"
+			},
+			set: func(config *GuildConfig, value string) error {
+				switch strings.ToLower(value) {
+				case "on":
+					config.KeepCommands = true
+				case "off":
+					config.KeepCommands = false
+				default:
+					return fmt.Errorf("'%s' is not a valid option, use on or off", value)
+				}
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.KeepCommands = false
+			},
+		},
+		{
+			name:        "voicechannels",
+			description: "Create a voice channel for each team when teams are complete, optionally moving players in (off, on or move)",
+			get: func(config *GuildConfig) string {
+				switch {
+				case config.VoiceChannels && config.MoveToVoice:
+					return "move"
+				case config.VoiceChannels:
+					return "on"
+				}
+				return "off"
+			},
+			set: func(config *GuildConfig, value string) error {
+				switch strings.ToLower(value) {
+				case "off":
+					config.VoiceChannels, config.MoveToVoice = false, false
+				case "on":
+					config.VoiceChannels, config.MoveToVoice = true, false
+				case "move":
+					config.VoiceChannels, config.MoveToVoice = true, true
+				default:
+					return fmt.Errorf("'%s' is not a valid option, use off, on or move", value)
+				}
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.VoiceChannels, config.MoveToVoice = false, false
+			},
+		},
+		{
+			name:        "adminroles",
+			description: "Extra roles that grant cup admin rights (comma-separated names)",
+			get: func(config *GuildConfig) string {
+				if len(config.AdminRoles) == 0 {
+					return "none"
+				}
+				return strings.Join(config.AdminRoles, ", ")
+			},
+			set: func(config *GuildConfig, value string) error {
+				var roles []string
+				if !strings.EqualFold(value, "none") {
+					for _, role := range strings.Split(value, ",") {
+						role = strings.TrimSpace(role)
+						if len(role) > 0 {
+							roles = append(roles, role)
+						}
+					}
+				}
+				config.AdminRoles = roles
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.AdminRoles = nil
+			},
+		},
+		{
+			name:        "teamsize",
+			description: "Number of players per team for new cups",
+			get: func(config *GuildConfig) string {
+				return strconv.Itoa(config.teamSize())
+			},
+			set: func(config *GuildConfig, value string) error {
+				size, err := strconv.Atoi(value)
+				if err != nil || size <= 0 {
+					return fmt.Errorf("'%s' is not a valid team size", value)
+				}
+				config.TeamSize = size
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.TeamSize = 0
+			},
+		},
+		{
+			name:        "minteams",
+			description: "Minimum number of teams for new cups",
+			get: func(config *GuildConfig) string {
+				if config.MinimumTeams == 0 {
+					return strconv.Itoa(cupOptions.minimumTeams)
+				}
+				return strconv.Itoa(config.MinimumTeams)
+			},
+			set: func(config *GuildConfig, value string) error {
+				count, err := strconv.Atoi(value)
+				if err != nil || count < lowestMinimumTeams() {
+					return fmt.Errorf("'%s' is not valid, the minimum number of teams must be at least %d", value, lowestMinimumTeams())
+				}
+				config.MinimumTeams = count
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.MinimumTeams = 0
+			},
+		},
+		{
+			name:        "promote",
+			description: "Time between promotions for regular users",
+			get: func(config *GuildConfig) string {
+				return humanize(config.promoteInterval())
+			},
+			set: func(config *GuildConfig, value string) error {
+				interval, err := parseDuration(value)
+				if err != nil {
+					return err
+				}
+				config.PromoteInterval = interval
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.PromoteInterval = 0
+			},
+		},
+		{
+			name:        "promotemanager",
+			description: "Time between promotions for cup managers and admins",
+			get: func(config *GuildConfig) string {
+				return humanize(config.promoteIntervalManager())
+			},
+			set: func(config *GuildConfig, value string) error {
+				interval, err := parseDuration(value)
+				if err != nil {
+					return err
+				}
+				config.PromoteIntervalManager = interval
+				return nil
+			},
+			reset: func(config *GuildConfig) {
+				config.PromoteIntervalManager = 0
+			},
+		},
+	}
+)
+
+// Returns the setting with the given name (case-insensitive), or nil if there's no such setting
+func findConfigSetting(name string) *configSetting {
+	for i := range configSettings {
+		if strings.EqualFold(configSettings[i].name, name) {
+			return &configSettings[i]
+		}
+	}
+	return nil
+}
+
+func (config *GuildConfig) teamSize() int {
+	if config.TeamSize == 0 {
+		return DefaultTeamSize
+	}
+	return config.TeamSize
+}
+
+func (config *GuildConfig) promoteInterval() time.Duration {
+	if config.PromoteInterval == 0 {
+		return MinimumPromotionInterval
+	}
+	return config.PromoteInterval
+}
+
+func (config *GuildConfig) promoteIntervalManager() time.Duration {
+	if config.PromoteIntervalManager == 0 {
+		return MinimumPromotionIntervalManager
+	}
+	return config.PromoteIntervalManager
+}
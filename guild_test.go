@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestReloadGuildConfigs(t *testing.T) {
+	savedDir, savedConfigs := ChannelDataDir, guildConfigs
+	defer func() {
+		ChannelDataDir, guildConfigs = savedDir, savedConfigs
+	}()
+	ChannelDataDir = t.TempDir()
+	guildConfigs = make(map[string]*GuildConfig)
+
+	changed, err := reloadGuildConfigs()
+	if err != nil || len(changed) != 0 {
+		t.Fatalf("empty data folder: got %v, %v; expected no changes", changed, err)
+	}
+
+	if err := updateGuildConfig("1", func(config *GuildConfig) error { config.TeamSize = 3; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateGuildConfig("2", func(config *GuildConfig) error { config.Language = "es"; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit the settings on disk behind the bot's back
+	edited := &GuildConfig{GuildID: "1", TeamSize: 5, MinimumTeams: 3}
+	if err := edited.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err = reloadGuildConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"1": {"teamsize", "minteams"}}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("got changes %v, expected %v", changed, expected)
+	}
+	if config := getGuildConfig("1"); config.TeamSize != 5 || config.MinimumTeams != 3 {
+		t.Errorf("settings not reloaded: %+v", config)
+	}
+	if config := getGuildConfig("2"); config.Language != "es" {
+		t.Errorf("unchanged settings lost: %+v", config)
+	}
+}
+
+func TestReloadCorruptGuildConfig(t *testing.T) {
+	savedDir, savedConfigs := ChannelDataDir, guildConfigs
+	defer func() {
+		ChannelDataDir, guildConfigs = savedDir, savedConfigs
+	}()
+	ChannelDataDir = t.TempDir()
+	guildConfigs = make(map[string]*GuildConfig)
+
+	if err := updateGuildConfig("1", func(config *GuildConfig) error { config.TeamSize = 3; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// A half-written or hand-mangled file shouldn't reset the guild to the defaults
+	path := filepath.Join(ChannelDataDir, GuildDataDir, "1")
+	if err := ioutil.WriteFile(path, []byte("{\"GuildID\": \"1\", \"TeamSi"), SaveFilePermission); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := reloadGuildConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("got changes %v, expected none", changed)
+	}
+	if config := getGuildConfig("1"); config.TeamSize != 3 {
+		t.Errorf("settings lost after reloading a corrupt file: %+v", config)
+	}
+}
+
+func TestUpdateGuildConfig(t *testing.T) {
+	savedDir, savedConfigs := ChannelDataDir, guildConfigs
+	defer func() {
+		ChannelDataDir, guildConfigs = savedDir, savedConfigs
+	}()
+	ChannelDataDir = t.TempDir()
+	guildConfigs = make(map[string]*GuildConfig)
+
+	// Concurrent changes must reach the disk in the order they were made
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			updateGuildConfig("1", func(config *GuildConfig) error {
+				config.TeamSize++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	readSaved := func() GuildConfig {
+		var saved GuildConfig
+		contents, err := ioutil.ReadFile(filepath.Join(ChannelDataDir, GuildDataDir, "1"))
+		if err == nil {
+			err = json.Unmarshal(contents, &saved)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return saved
+	}
+	if saved := readSaved(); saved.TeamSize != 20 || getGuildConfig("1").TeamSize != 20 {
+		t.Errorf("got team size %d on disk and %d in memory, expected 20", saved.TeamSize, getGuildConfig("1").TeamSize)
+	}
+
+	// A failed change is neither applied nor saved
+	invalid := errors.New("invalid")
+	err := updateGuildConfig("1", func(config *GuildConfig) error {
+		config.TeamSize = 0
+		return invalid
+	})
+	if err != invalid {
+		t.Errorf("got error %v, expected %v", err, invalid)
+	}
+	if saved := readSaved(); saved.TeamSize != 20 || getGuildConfig("1").TeamSize != 20 {
+		t.Errorf("failed change applied: team size %d on disk and %d in memory", saved.TeamSize, getGuildConfig("1").TeamSize)
+	}
+}
+
+func TestChannelsSetting(t *testing.T) {
+	setting := findConfigSetting("channels")
+	if setting == nil {
+		t.Fatal("channels setting not found")
+	}
+
+	var config GuildConfig
+	if err := setting.set(&config, "<#123>, 456 <#789>"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"123", "456", "789"}; !reflect.DeepEqual(config.AllowedChannels, expected) {
+		t.Errorf("got %v, expected %v", config.AllowedChannels, expected)
+	}
+	if value := setting.get(&config); value != "<#123> <#456> <#789>" {
+		t.Errorf("got %q", value)
+	}
+
+	if err := setting.set(&config, "#general"); err == nil {
+		t.Error("expected an error for a channel name")
+	}
+	if err := setting.set(&config, "all"); err != nil || len(config.AllowedChannels) != 0 {
+		t.Errorf("all: got %v, %v; expected no restriction", config.AllowedChannels, err)
+	}
+}
+
+func TestVoiceChannelsSetting(t *testing.T) {
+	setting := findConfigSetting("voicechannels")
+	if setting == nil {
+		t.Fatal("voicechannels setting not found")
+	}
+
+	var config GuildConfig
+	for _, value := range []string{"on", "move", "off"} {
+		if err := setting.set(&config, value); err != nil {
+			t.Fatal(err)
+		}
+		if got := setting.get(&config); got != value {
+			t.Errorf("set to %s, got %s", value, got)
+		}
+	}
+	if err := setting.set(&config, "maybe"); err == nil {
+		t.Error("expected an error for an invalid value")
+	}
+
+	setting.set(&config, "move")
+	setting.reset(&config)
+	if config.VoiceChannels || config.MoveToVoice {
+		t.Error("voice channels still enabled after reset")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////
+// Message localization
+////////////////////////////////////////////////////////////////
+
+// Language used when a guild hasn't picked one, or a message isn't translated
+const (
+	DefaultLanguage = "en"
+)
+
+// Messages, by language and key.
+// Countable nouns have a ".one" and an ".other" variant, used by trNumbered.
+var (
+	Messages = map[string]map[string]string{
+		"en": {
+			"language":              "English",
+			"player.one":            "player",
+			"player.other":          "players",
+			"player.placeholder":    "(reserved)",
+			"player.seed":           "(seed %d)",
+			"player.sub":            "(sub)",
+			"signup.none":           "No players signed up for the cup so far.\n",
+			"signup.count":          "%s signed up so far:\n",
+			"signup.prompt":         "Sign up now by typing %s\n",
+			"signup.paused":         "Sign-up is paused for now.\n",
+			"signup.locked":         "The list of players is locked for now, but players can still leave.\n",
+			"signup.locked.strict":  "The list of players is locked for now: nobody can join or leave.\n",
+			"signup.captains":       "The first %s to sign up will be team captains.\n",
+			"signup.reverse":        "Captains will be picked starting with the last team.\n",
+			"signup.random":         "Captains will be picked for the teams in random order.\n",
+			"pick.captain":          "%s, pick a captain for %s, by typing %s\n",
+			"pick.player":           "%s, pick the %s player for %s, by typing %s\n",
+			"pick.done":             "Good luck and have fun!\n",
+			"team.description":      "team %d, %s",
+			"teams.picking.one":     "%d team, with %s picked out of %d:\n",
+			"teams.picking.other":   "%d teams, with %s picked out of %d:\n",
+			"teams.competing.one":   "%d competing team:\n",
+			"teams.competing.other": "%d competing teams:\n",
+			"players.available":     "%s available:\n",
+		},
+		"es": {
+			"language":              "Español",
+			"player.one":            "jugador",
+			"player.other":          "jugadores",
+			"player.placeholder":    "(reservado)",
+			"player.seed":           "(cabeza de serie %d)",
+			"player.sub":            "(suplente)",
+			"signup.none":           "Nadie se ha inscrito en la copa todavía.\n",
+			"signup.count":          "%s inscritos hasta ahora:\n",
+			"signup.prompt":         "Inscríbete ahora escribiendo %s\n",
+			"signup.paused":         "La inscripción está en pausa por ahora.\n",
+			"signup.locked":         "La lista de jugadores está bloqueada por ahora, pero los jugadores aún pueden retirarse.\n",
+			"signup.locked.strict":  "La lista de jugadores está bloqueada por ahora: nadie puede inscribirse ni retirarse.\n",
+			"signup.captains":       "Los primeros %s en inscribirse serán los capitanes.\n",
+			"signup.reverse":        "Los capitanes se elegirán empezando por el último equipo.\n",
+			"signup.random":         "Los capitanes se elegirán para los equipos en orden aleatorio.\n",
+			"pick.captain":          "%s, elige un capitán para %s, escribiendo %s\n",
+			"pick.player":           "%s, elige el %s jugador para %s, escribiendo %s\n",
+			"pick.done":             "¡Buena suerte y que os divirtáis!\n",
+			"team.description":      "el equipo %d, %s",
+			"teams.picking.one":     "%d equipo, con %s elegidos de %d:\n",
+			"teams.picking.other":   "%d equipos, con %s elegidos de %d:\n",
+			"teams.competing.one":   "%d equipo en competición:\n",
+			"teams.competing.other": "%d equipos en competición:\n",
+			"players.available":     "%s disponibles:\n",
+		},
+	}
+)
+
+// Returns true if messages are available in the given language
+func isLanguageSupported(language string) bool {
+	_, found := Messages[language]
+	return found
+}
+
+// Returns a comma-separated list of supported language codes
+func supportedLanguages() string {
+	languages := make([]string, 0, len(Messages))
+	for language := range Messages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return strings.Join(languages, ", ")
+}
+
+// Returns the language used in the given guild
+func guildLanguage(guildID string) string {
+	language := getGuildConfig(guildID).Language
+	if !isLanguageSupported(language) {
+		return DefaultLanguage
+	}
+	return language
+}
+
+// Returns the message with the given key in the given language (falling back to English),
+// formatted with the given arguments
+func tr(language string, key string, args ...interface{}) string {
+	format, found := Messages[language][key]
+	if !found {
+		format, found = Messages[DefaultLanguage][key]
+		if !found {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Localized version of numbered, using the ".one"/".other" variants of the given key
+func trNumbered(language string, count int, key string) string {
+	if count == 1 {
+		return strconv.Itoa(count) + " " + tr(language, key+".one")
+	}
+	return strconv.Itoa(count) + " " + tr(language, key+".other")
+}
+
+// Like tr, using the ".one"/".other" variant of the given key; the count is the first formatting argument
+func trPlural(language string, count int, key string, args ...interface{}) string {
+	if count == 1 {
+		return tr(language, key+".one", append([]interface{}{count}, args...)...)
+	}
+	return tr(language, key+".other", append([]interface{}{count}, args...)...)
+}
+
+// Localized version of nth
+func trNth(language string, index int) string {
+	switch language {
+	case "es":
+		return strconv.Itoa(index) + "º"
+	}
+	return nth(index)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////
+// Leveled logging
+////////////////////////////////////////////////////////////////
+
+// Log levels, in increasing order of severity
+const (
+	LogLevelDebug = iota
+	LogLevelInfo  = iota
+	LogLevelWarn  = iota
+	LogLevelError = iota
+)
+
+var (
+	logLevelNames = [...]string{"debug", "info", "warn", "error"}
+
+	logLevel  = LogLevelInfo
+	logOutput = log.New(os.Stderr, "", log.LstdFlags)
+)
+
+// Returns the log level with the given name (case-insensitive)
+func parseLogLevel(name string) (int, bool) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, true
+		}
+	}
+	return LogLevelInfo, false
+}
+
+// Writes a log entry if the given level is enabled.
+// Arguments are formatted like fmt.Println.
+func logAt(level int, args ...interface{}) {
+	if level < logLevel {
+		return
+	}
+	text := fmt.Sprintln(args...)
+	logOutput.Print(strings.ToUpper(logLevelNames[level]) + " " + text)
+}
+
+func logDebug(args ...interface{}) {
+	logAt(LogLevelDebug, args...)
+}
+
+func logInfo(args ...interface{}) {
+	logAt(LogLevelInfo, args...)
+}
+
+func logWarn(args ...interface{}) {
+	logAt(LogLevelWarn, args...)
+}
+
+func logError(args ...interface{}) {
+	logAt(LogLevelError, args...)
+}
+
+// Context prefixes for log entries
+func logChannel(channelID string) string {
+	return "[channel " + channelID + "]"
+}
+
+func logGuild(guildID string) string {
+	return "[guild " + guildID + "]"
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// Returns a cup in the pickup phase, with the given number of teams and players
+func makeTestCup(numTeams int, numPlayers int) *Cup {
+	currentCup := &Cup{
+		Status:    CupStatusPickup,
+		ChannelID: "channel",
+		TeamSize:  2,
+		Manager:   Player{Name: "Manager", ID: "100", Team: -1, Next: -1},
+	}
+	for i := 0; i < numPlayers; i++ {
+		id := strconv.Itoa(i + 1)
+		currentCup.Players = append(currentCup.Players, Player{Name: "Player" + id, ID: id, Team: -1, Next: -1})
+	}
+	currentCup.Teams = make([]Team, numTeams)
+	for i := range currentCup.Teams {
+		currentCup.Teams[i].resetTeam()
+		currentCup.Teams[i].Name = "Team" + strconv.Itoa(i+1)
+	}
+	currentCup.updateTeamNameCache()
+	return currentCup
+}
+
+// Picks the given number of players, in order, following the regular pick sequence
+func (currentCup *Cup) pickTestPlayers(count int) {
+	for i := 0; i < count; i++ {
+		pickup := currentCup.currentPickup()
+		_, _ = currentCup.addPlayerToTeam(currentCup.nextAvailablePlayer(), pickup.Team)
+	}
+}
+
+func checkGolden(t *testing.T, name string, actual string) {
+	path := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != string(expected) {
+		t.Errorf("%s: report mismatch\ngot:\n%s\nexpected:\n%s", name, actual, expected)
+	}
+}
+
+func TestReportSignup(t *testing.T) {
+	currentCup := makeTestCup(0, 3)
+	currentCup.Status = CupStatusSignup
+	checkGolden(t, "report_signup", currentCup.report(CupReportAll))
+
+	currentCup.Players = nil
+	checkGolden(t, "report_signup_empty", currentCup.report(CupReportAll))
+}
+
+func TestReportZeroPicks(t *testing.T) {
+	currentCup := makeTestCup(2, 4)
+	checkGolden(t, "report_zero_picks", currentCup.report(CupReportAll))
+}
+
+func TestReportMidPick(t *testing.T) {
+	currentCup := makeTestCup(2, 5)
+	currentCup.pickTestPlayers(3)
+	checkGolden(t, "report_mid_pick", currentCup.report(CupReportAll))
+}
+
+func TestReportComplete(t *testing.T) {
+	currentCup := makeTestCup(2, 4)
+	currentCup.pickTestPlayers(4)
+	checkGolden(t, "report_complete", currentCup.report(CupReportTeams|CupReportSubs))
+}
+
+func TestReportNumberPadding(t *testing.T) {
+	for _, count := range []int{0, 9, 10, 99, 100} {
+		signup := makeTestCup(0, count)
+		signup.Status = CupStatusSignup
+		cups := map[string]*Cup{"signup": signup}
+		// Two teams of two, everyone else is a substitute
+		if count >= 4 {
+			cups["pickup"] = makeTestCup(2, count)
+		}
+
+		width := digits10(count) + 2
+		for name, currentCup := range cups {
+			listed := 0
+			for _, line := range strings.Split(currentCup.report(CupReportAll), "\n") {
+				if len(line) == 0 || line[0] < '0' || line[0] > '9' || !strings.Contains(line, "Player") {
+					continue
+				}
+				listed++
+				if column := strings.Index(line, "Player"); column != width {
+					t.Errorf("%s with %d players: name in column %d, expected %d: %q", name, count, column, width, line)
+				}
+			}
+			if listed != count {
+				t.Errorf("%s with %d players: %d players listed", name, count, listed)
+			}
+		}
+	}
+}
+
+func TestReportCodeFences(t *testing.T) {
+	reports := map[string]string{}
+	for picks := 0; picks <= 4; picks++ {
+		currentCup := makeTestCup(2, 6)
+		currentCup.LimitSubs = true
+		currentCup.MaxSubs = 3
+		currentCup.pickTestPlayers(picks)
+		reports["pickup with "+strconv.Itoa(picks)+" picks"] = currentCup.report(CupReportAll)
+	}
+	signup := makeTestCup(0, 3)
+	signup.Status = CupStatusSignup
+	reports["signup"] = signup.report(CupReportAll)
+
+	for name, report := range reports {
+		if strings.Count(report, CodeFence)%2 != 0 {
+			t.Errorf("%s: unbalanced code fences:\n%s", name, report)
+		}
+		if strings.Contains(report, "\n\n"+CodeFence) {
+			t.Errorf("%s: code block ends with a blank line:\n%s", name, report)
+		}
+		if strings.Contains(report, CodeFence+CodeFence) || strings.Contains(report, CodeFence+"\n"+CodeFence) {
+			t.Errorf("%s: empty code block:\n%s", name, report)
+		}
+	}
+}
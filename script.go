@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Channel and guild the commands of a script are issued in, unless a line names another channel
+const (
+	ScriptChannelID = "script"
+	ScriptGuildID   = "script"
+)
+
+// Runs the commands in the given script file against a fake Discord session, writing the bot's messages to out.
+// Each line holds a user ID followed by the message that user sends, optionally preceded by a #channel, e.g.:
+//
+//	100 ?draft start Friday cup
+//	1 ?draft add
+//	#lobby 2 ?draft add <#script>
+//
+// Empty lines and lines starting with // are skipped.
+func runScript(path string, out io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s := newFakeSession(ScriptGuildID)
+	s.echo = out
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		channelID := ScriptChannelID
+		var token string
+		token, line = parseToken(line)
+		if strings.HasPrefix(token, "#") {
+			channelID = token[1:]
+			token, line = parseToken(line)
+		}
+		if len(token) == 0 || len(line) == 0 {
+			return fmt.Errorf("%s:%d: expected a user ID followed by a message", path, lineNumber)
+		}
+
+		fmt.Fprintf(out, "> [#%s] %s: %s\n\n", channelID, token, line)
+		handleMessage(s, fakeMessageCreate(channelID, token, line))
+	}
+	return scanner.Err()
+}
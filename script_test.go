@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunScript(t *testing.T) {
+	defer func() {
+		deleteCup(newFakeSession(ScriptGuildID), ScriptChannelID)
+		lockCups.Lock()
+		delete(finishedCups, ScriptChannelID)
+		lockCups.Unlock()
+	}()
+
+	var out bytes.Buffer
+	if err := runScript(filepath.Join("testdata", "full_cup.script"), &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"> [#script] 100: ?draft start Scripted cup",
+		"<@4> signed up from <#lobby>",
+		"Teams are now complete",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output doesn't contain %q:\n%s", expected, out.String())
+		}
+	}
+	if currentCup := getFinishedCup(ScriptChannelID); currentCup == nil || currentCup.Winner != 1 {
+		t.Errorf("cup not finished with team 1 as the winner")
+	}
+}
+
+func TestRunScriptErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.script")
+	if err := ioutil.WriteFile(path, []byte("100\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runScript(path, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("got %v, expected an error for line 1", err)
+	}
+	if err := runScript(filepath.Join(t.TempDir(), "missing.script"), &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+////////////////////////////////////////////////////////////////
+
+// DiscordSession is the part of the Discord API used by the bot.
+// At runtime it is a liveSession; tests use a fake that records the calls instead.
+type DiscordSession interface {
+	Channel(channelID string) (*discordgo.Channel, error)
+	ChannelDelete(channelID string) (*discordgo.Channel, error)
+	ChannelMessage(channelID string, messageID string) (*discordgo.Message, error)
+	ChannelMessageDelete(channelID string, messageID string) error
+	ChannelMessageEdit(channelID string, messageID string, content string) (*discordgo.Message, error)
+	ChannelMessagePin(channelID string, messageID string) error
+	ChannelMessageSend(channelID string, content string) (*discordgo.Message, error)
+	ChannelMessageUnpin(channelID string, messageID string) error
+	ChannelMessagesBulkDelete(channelID string, messages []string) error
+	ChannelMessagesPinned(channelID string) ([]*discordgo.Message, error)
+	GuildChannelCreateComplex(guildID string, data discordgo.GuildChannelCreateData) (*discordgo.Channel, error)
+	GuildChannels(guildID string) ([]*discordgo.Channel, error)
+	GuildMember(guildID string, userID string) (*discordgo.Member, error)
+	GuildMemberMove(guildID string, userID string, channelID *string) error
+	MessageReactionAdd(channelID string, messageID string, emojiID string) error
+	UpdateStatus(idle int, game string) error
+	UserChannelCreate(recipientID string) (*discordgo.Channel, error)
+	UserChannelPermissions(userID string, channelID string) (int, error)
+
+	// Lookups in the state cache, which don't hit the API
+	StateChannel(channelID string) (*discordgo.Channel, error)
+	StateGuild(guildID string) (*discordgo.Guild, error)
+	StateGuilds() []*discordgo.Guild
+	StateMember(guildID string, userID string) (*discordgo.Member, error)
+	StateMemberAdd(member *discordgo.Member) error
+	StateRole(guildID string, roleID string) (*discordgo.Role, error)
+}
+
+// liveSession talks to Discord through a discordgo session
+type liveSession struct {
+	*discordgo.Session
+}
+
+func (s liveSession) StateChannel(channelID string) (*discordgo.Channel, error) {
+	return s.State.Channel(channelID)
+}
+
+func (s liveSession) StateGuild(guildID string) (*discordgo.Guild, error) {
+	return s.State.Guild(guildID)
+}
+
+// Returns a copy of the list of guilds the bot is in
+func (s liveSession) StateGuilds() []*discordgo.Guild {
+	s.State.RLock()
+	defer s.State.RUnlock()
+	return append([]*discordgo.Guild(nil), s.State.Guilds...)
+}
+
+func (s liveSession) StateMember(guildID string, userID string) (*discordgo.Member, error) {
+	return s.State.Member(guildID, userID)
+}
+
+func (s liveSession) StateMemberAdd(member *discordgo.Member) error {
+	return s.State.MemberAdd(member)
+}
+
+func (s liveSession) StateRole(guildID string, roleID string) (*discordgo.Role, error) {
+	return s.State.Role(guildID, roleID)
+}
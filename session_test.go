@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+)
+
+// Returns the text of all messages sent to the given channel, in order
+func (f *fakeSession) sentTo(channelID string) []string {
+	var texts []string
+	for _, message := range f.sent {
+		if message.ChannelID == channelID {
+			texts = append(texts, message.Content)
+		}
+	}
+	return texts
+}
+
+// Returns true if any message sent to the given channel contains the given text
+func (f *fakeSession) saw(channelID string, text string) bool {
+	for _, content := range f.sentTo(channelID) {
+		if strings.Contains(content, text) {
+			return true
+		}
+	}
+	return false
+}
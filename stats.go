@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////
+// Per-guild player statistics
+////////////////////////////////////////////////////////////////
+
+// PlayerStats holds the results of a player across all cups in a guild
+type PlayerStats struct {
+	ID     string
+	Name   string // as of the last cup played
+	Played int
+	Wins   int
+	Rating int `json:",omitempty"` // last known rating, or the one implied by the seed; 0 if unknown
+
+	Departures int `json:",omitempty"` // number of cups left after signing up
+	Penalty    int `json:",omitempty"` // reliability penalty for leaving cups, 0 to MaxPenalty
+}
+
+// GuildStats holds the statistics of all players in a guild
+type GuildStats struct {
+	GuildID string
+	Players map[string]*PlayerStats
+
+	loadFailed bool // the file on disk couldn't be read, so it must not be overwritten
+}
+
+// Reliability penalties: leaving a cup after signing up adds LeavePenalty (up to MaxPenalty),
+// and each cup a player stays in until the teams are complete takes off a fraction of it
+const (
+	LeavePenalty        = 25
+	MaxPenalty          = 100
+	PenaltyDecayDivisor = 4
+)
+
+// Folder where statistics are saved, relative to ChannelDataDir
+const (
+	StatsDataDir = "stats"
+)
+
+var (
+	lockStats  sync.Mutex
+	guildStats = make(map[string]*GuildStats)
+
+	errStatsNotLoaded = errors.New("statistics on disk could not be loaded, not overwriting them")
+)
+
+// Returns the statistics for the given guild, loading them from disk if needed.
+// Must be called with lockStats held.
+func loadGuildStats(guildID string) *GuildStats {
+	stats := guildStats[guildID]
+	if stats != nil {
+		return stats
+	}
+
+	stats = &GuildStats{GuildID: guildID}
+	if len(ChannelDataDir) > 0 {
+		path := filepath.Join(ChannelDataDir, StatsDataDir, guildID)
+		contents, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(contents, stats)
+			if err != nil {
+				// Start over, but keep the unreadable file around instead of overwriting it
+				logError(logGuild(guildID), "Error parsing player statistics, setting them aside:", err)
+				stats = &GuildStats{GuildID: guildID}
+				err = os.Rename(path, filepath.Join(filepath.Dir(path), setAsideName(guildID, SetAsideCorrupt)))
+			}
+		}
+		if err != nil && !os.IsNotExist(err) {
+			logError(logGuild(guildID), "Error loading player statistics:", err)
+			stats.loadFailed = true
+		}
+	}
+	if stats.Players == nil {
+		stats.Players = make(map[string]*PlayerStats)
+	}
+	guildStats[guildID] = stats
+	return stats
+}
+
+func (stats *GuildStats) save() error {
+	if len(ChannelDataDir) <= 0 {
+		return os.ErrInvalid
+	}
+	if stats.loadFailed {
+		return errStatsNotLoaded
+	}
+
+	dir := filepath.Join(ChannelDataDir, StatsDataDir)
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(dir, stats.GuildID, contents)
+}
+
+// Returns the statistics entry for a player, creating it if needed.
+// Must be called with lockStats held.
+func (stats *GuildStats) entry(player *Player) *PlayerStats {
+	entry := stats.Players[player.ID]
+	if entry == nil {
+		entry = &PlayerStats{ID: player.ID}
+		stats.Players[player.ID] = entry
+	}
+	entry.Name = player.Name
+	if len(player.RealName) > 0 {
+		entry.Name = player.RealName // names set by the manager only apply to one cup
+	}
+	return entry
+}
+
+// Returns how reliable a player is, as a percentage
+func (entry *PlayerStats) reliability() int {
+	return MaxPenalty - entry.Penalty
+}
+
+// Adds the result of a cup to the statistics of its guild: everyone on a team played,
+// and the players on the winning team won. Placeholders are skipped.
+func (currentCup *Cup) recordStats() error {
+	if currentCup.Winner == 0 || len(currentCup.GuildID) == 0 {
+		return nil
+	}
+
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	stats := loadGuildStats(currentCup.GuildID)
+	for i := range currentCup.Players {
+		player := &currentCup.Players[i]
+		if player.Team < 0 || player.isPlaceholder() {
+			continue
+		}
+		entry := stats.entry(player)
+		entry.Played++
+		if player.Team == currentCup.Winner-1 {
+			entry.Wins++
+		}
+		// Seeded players are ranked by the rating their seed stands for
+		if player.Rating != 0 || player.Seed > 0 {
+			entry.Rating = player.effectiveRating()
+		}
+	}
+
+	// Without a data folder, statistics are only kept until the bot restarts
+	if len(ChannelDataDir) == 0 {
+		return nil
+	}
+	return stats.save()
+}
+
+// Leaderboard orderings
+const (
+	LeaderboardByWins   = "wins"
+	LeaderboardByRating = "rating"
+)
+
+// Returns the value players are ranked by in the given leaderboard
+func leaderboardValue(entry *PlayerStats, order string) int {
+	if order == LeaderboardByRating {
+		return entry.Rating
+	}
+	return entry.Wins
+}
+
+// Returns the players of a guild sorted for the given leaderboard, best first.
+// Players without a rating are left out of the rating leaderboard.
+func topPlayers(guildID string, order string) []PlayerStats {
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	stats := loadGuildStats(guildID)
+	players := make([]PlayerStats, 0, len(stats.Players))
+	for _, entry := range stats.Players {
+		if order == LeaderboardByRating && entry.Rating == 0 {
+			continue
+		}
+		players = append(players, *entry)
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		a, b := leaderboardValue(&players[i], order), leaderboardValue(&players[j], order)
+		if a != b {
+			return a > b
+		}
+		// Among tied players, those who needed fewer cups come first
+		if players[i].Played != players[j].Played {
+			return players[i].Played < players[j].Played
+		}
+		return players[i].Name < players[j].Name
+	})
+	return players
+}
+
+// Penalizes a player for leaving a cup in the given guild after signing up
+func recordDeparture(guildID string, player *Player) error {
+	if len(guildID) == 0 || player.isPlaceholder() {
+		return nil
+	}
+
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	entry := loadGuildStats(guildID).entry(player)
+	entry.Departures++
+	entry.Penalty += LeavePenalty
+	if entry.Penalty > MaxPenalty {
+		entry.Penalty = MaxPenalty
+	}
+	// Without a data folder, penalties are only kept until the bot restarts
+	if len(ChannelDataDir) == 0 {
+		return nil
+	}
+	return guildStats[guildID].save()
+}
+
+// Reduces the penalties of everyone who stayed in the cup until the teams were complete
+func (currentCup *Cup) recordAttendance() error {
+	if len(currentCup.GuildID) == 0 {
+		return nil
+	}
+
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	stats := loadGuildStats(currentCup.GuildID)
+	changed := false
+	for i := range currentCup.Players {
+		entry := stats.Players[currentCup.Players[i].ID]
+		if entry == nil || entry.Penalty == 0 || currentCup.Players[i].isPlaceholder() {
+			continue
+		}
+		// Round up, so penalties eventually go away
+		entry.Penalty -= (entry.Penalty + PenaltyDecayDivisor - 1) / PenaltyDecayDivisor
+		changed = true
+	}
+	if !changed || len(ChannelDataDir) == 0 {
+		return nil
+	}
+	return stats.save()
+}
+
+// Returns how reliable a player is in the given guild, as a percentage (100 for unknown players)
+func playerReliability(guildID string, playerID string) int {
+	if len(guildID) == 0 {
+		return MaxPenalty
+	}
+
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	entry := loadGuildStats(guildID).Players[playerID]
+	if entry == nil {
+		return MaxPenalty
+	}
+	return entry.reliability()
+}
+
+// Returns the players of a guild with a reliability penalty, least reliable first
+func unreliablePlayers(guildID string) []PlayerStats {
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	var players []PlayerStats
+	for _, entry := range loadGuildStats(guildID).Players {
+		if entry.Penalty > 0 {
+			players = append(players, *entry)
+		}
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].Penalty != players[j].Penalty {
+			return players[i].Penalty > players[j].Penalty
+		}
+		return players[i].Name < players[j].Name
+	})
+	return players
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordStats(t *testing.T) {
+	savedDir, savedStats := ChannelDataDir, guildStats
+	defer func() {
+		ChannelDataDir, guildStats = savedDir, savedStats
+	}()
+	ChannelDataDir = t.TempDir()
+	guildStats = make(map[string]*GuildStats)
+
+	for _, winner := range []int{1, 2, 1} {
+		currentCup := makeTestCup(2, 4)
+		currentCup.GuildID = "guild"
+		currentCup.Players[0].Seed = 1
+		currentCup.Players[1].Seed = MaxSeed
+		currentCup.pickTestPlayers(4)
+		currentCup.recordForfeit(-1, winner-1)
+		if err := currentCup.recordStats(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Players 1 and 3 form the first team, 2 and 4 the second one
+	players := topPlayers("guild", LeaderboardByWins)
+	if len(players) != 4 {
+		t.Fatalf("got %d players, expected 4", len(players))
+	}
+	expected := []struct {
+		name   string
+		wins   int
+		played int
+	}{
+		{"Player1", 2, 3}, {"Player3", 2, 3}, {"Player2", 1, 3}, {"Player4", 1, 3},
+	}
+	for i, entry := range expected {
+		if players[i].Name != entry.name || players[i].Wins != entry.wins || players[i].Played != entry.played {
+			t.Errorf("rank %d: got %+v, expected %+v", i+1, players[i], entry)
+		}
+	}
+
+	// Statistics survive a restart
+	guildStats = make(map[string]*GuildStats)
+	rated := topPlayers("guild", LeaderboardByRating)
+	if len(rated) != 2 || rated[0].ID != "1" || rated[1].ID != "2" || rated[0].Rating <= rated[1].Rating {
+		t.Errorf("rating leaderboard: got %+v, expected the seeded Player1 and Player2", rated)
+	}
+
+	if empty := topPlayers("other", LeaderboardByWins); len(empty) != 0 {
+		t.Errorf("got %d players for a guild without results", len(empty))
+	}
+}
+
+func TestRecordStatsWithoutDataDir(t *testing.T) {
+	savedDir, savedStats := ChannelDataDir, guildStats
+	defer func() {
+		ChannelDataDir, guildStats = savedDir, savedStats
+	}()
+	ChannelDataDir = ""
+	guildStats = make(map[string]*GuildStats)
+
+	currentCup := makeTestCup(2, 4)
+	currentCup.GuildID = "guild"
+	currentCup.pickTestPlayers(4)
+	currentCup.recordForfeit(-1, 0)
+	if err := currentCup.recordStats(); err != nil {
+		t.Fatal(err)
+	}
+	if players := topPlayers("guild", LeaderboardByWins); len(players) != 4 {
+		t.Errorf("got %d players, expected 4 kept in memory", len(players))
+	}
+}
+
+func TestCorruptStatsSetAside(t *testing.T) {
+	savedDir, savedStats := ChannelDataDir, guildStats
+	defer func() {
+		ChannelDataDir, guildStats = savedDir, savedStats
+	}()
+	ChannelDataDir = t.TempDir()
+	guildStats = make(map[string]*GuildStats)
+
+	dir := filepath.Join(ChannelDataDir, StatsDataDir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := []byte("{\"GuildID\": \"guild\", \"Play")
+	if err := ioutil.WriteFile(filepath.Join(dir, "guild"), corrupt, SaveFilePermission); err != nil {
+		t.Fatal(err)
+	}
+
+	currentCup := makeTestCup(2, 4)
+	currentCup.GuildID = "guild"
+	currentCup.pickTestPlayers(4)
+	currentCup.recordForfeit(-1, 0)
+	if err := currentCup.recordStats(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := filepath.Glob(filepath.Join(dir, "guild."+SetAsideCorrupt+".*"))
+	if err != nil || len(saved) != 1 {
+		t.Fatalf("corrupt statistics not set aside: %v, %v", saved, err)
+	}
+	if contents, err := ioutil.ReadFile(saved[0]); err != nil || string(contents) != string(corrupt) {
+		t.Errorf("set-aside statistics changed: %q, %v", contents, err)
+	}
+}
+
+func TestReliability(t *testing.T) {
+	savedDir, savedStats := ChannelDataDir, guildStats
+	defer func() {
+		ChannelDataDir, guildStats = savedDir, savedStats
+	}()
+	ChannelDataDir = t.TempDir()
+	guildStats = make(map[string]*GuildStats)
+
+	currentCup := makeTestCup(2, 7)
+	currentCup.GuildID = "guild"
+	for i := 0; i < 2; i++ {
+		if err := recordDeparture("guild", &currentCup.Players[4]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recordDeparture("guild", &currentCup.Players[5]); err != nil {
+		t.Fatal(err)
+	}
+	if reliability := playerReliability("guild", "5"); reliability != MaxPenalty-2*LeavePenalty {
+		t.Errorf("reliability %d after leaving twice", reliability)
+	}
+
+	// Player6 is the most reliable substitute left once Player7 is out of the picture
+	if sub := currentCup.mostReliableSub(); sub != 6 {
+		t.Errorf("promoting substitute %d, expected Player7", sub+1)
+	}
+	currentCup.Players = currentCup.Players[:6]
+	if sub := currentCup.mostReliableSub(); sub != 5 {
+		t.Errorf("promoting substitute %d, expected Player6", sub+1)
+	}
+
+	if err := currentCup.recordAttendance(); err != nil {
+		t.Fatal(err)
+	}
+	players := unreliablePlayers("guild")
+	if len(players) != 2 || players[0].ID != "5" || players[0].Penalty != 2*LeavePenalty-(2*LeavePenalty+3)/4 || players[0].Departures != 2 {
+		t.Errorf("got %+v, expected Player5 first, with a reduced penalty", players)
+	}
+	for i := 0; i < 20; i++ {
+		currentCup.recordAttendance()
+	}
+	if players := unreliablePlayers("guild"); len(players) != 0 {
+		t.Errorf("penalties never go away: %+v", players)
+	}
+}
@@ -1,28 +1,37 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 ////////////////////////////////////////////////////////////////
 
+// Returns the number of characters needed to print the given number, including the sign
 func digits10(number int) int {
 	count := 1
-	for ; number >= 10; number /= 10 {
+	if number < 0 {
+		count++
+	}
+	// Division truncates towards zero, so this also works for the smallest negative number
+	for ; number >= 10 || number <= -10; number /= 10 {
 		count++
 	}
 	return count
 }
 
+// Pads the text with spaces on the right, up to the given number of characters
 func rightpad(text string, total int) string {
-	if len(text) >= total {
+	length := utf8.RuneCountInString(text)
+	if length >= total {
 		return text
 	}
-	return text + strings.Repeat(" ", total-len(text))
+	return text + strings.Repeat(" ", total-length)
 }
 
 func numbered(count int, singular string) string {
@@ -65,6 +74,13 @@ func bolditalic(s string) string {
 	return "***" + s + "***"
 }
 
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
 func mentionUser(UserID string) string {
 	return "<@" + UserID + ">"
 }
@@ -73,6 +89,99 @@ func mentionChannel(ChannelID string) string {
 	return "<#" + ChannelID + ">"
 }
 
+// Turns mentions that would ping people (@everyone, @here, roles) into plain text.
+// Note: ContentWithMentionsReplaced only takes care of user mentions.
+func defuseMentions(text string) string {
+	return strings.NewReplacer("@everyone", "everyone", "@here", "here", "<@&", "@&").Replace(text)
+}
+
+// Breaks up user mentions so they show as plain text instead of pinging anyone
+func defuseUserMentions(text string) string {
+	return strings.Replace(text, "<@", "<@\u200b", -1)
+}
+
+func mentionChannels(channelIDs []string) []string {
+	mentions := make([]string, len(channelIDs))
+	for i, channelID := range channelIDs {
+		mentions[i] = mentionChannel(channelID)
+	}
+	return mentions
+}
+
+// Returns the channel ID from a channel mention, or an empty string if the text isn't one
+func parseChannelMention(text string) string {
+	if !strings.HasPrefix(text, "<#") || !strings.HasSuffix(text, ">") {
+		return ""
+	}
+	return text[2 : len(text)-1]
+}
+
+////////////////////////////////////////////////////////////////
+
+// Shortens text to at most limit characters, ending it with an ellipsis if anything was cut
+func truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)[:limit-1]
+	// Don't leave a dangling escape character
+	for len(runes) > 0 && runes[len(runes)-1] == '\\' {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// Joins items with the given separator into as few chunks as possible, each no longer than limit,
+// without splitting any item (an item longer than limit gets a chunk of its own)
+func joinChunks(items []string, separator string, limit int) []string {
+	var chunks []string
+	current := ""
+	for _, item := range items {
+		if len(current) > 0 && len(current)+len(separator)+len(item) > limit {
+			chunks = append(chunks, current)
+			current = ""
+		}
+		if len(current) > 0 {
+			current += separator
+		}
+		current += item
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// Markdown code block delimiter
+const (
+	CodeFence = "```"
+)
+
+// Splits text into chunks no longer than limit, preferably at line breaks.
+// Code blocks spanning multiple chunks are closed and reopened.
+func splitMessage(text string, limit int) []string {
+	var chunks []string
+	window := limit - len(CodeFence)
+	for len(text) > limit {
+		cut := strings.LastIndexByte(text[:window], '\n') + 1
+		// don't waste more than half a message on a nice break
+		if cut < window/2 {
+			cut = window
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunk := text[:cut]
+		text = text[cut:]
+		if strings.Count(chunk, CodeFence)%2 != 0 {
+			chunk += CodeFence
+			text = CodeFence + "\n" + text
+		}
+		chunks = append(chunks, chunk)
+	}
+	return append(chunks, text)
+}
+
 ////////////////////////////////////////////////////////////////
 
 func parseToken(cmd string) (string, string) {
@@ -94,6 +203,42 @@ func parseToken(cmd string) (string, string) {
 
 ////////////////////////////////////////////////////////////////
 
+// Parses a user-supplied amount of time, e.g. "90m" or "1h30m".
+// Bare numbers are interpreted as minutes ("30" -> 30m).
+// The returned error is suitable for showing to users.
+func parseDuration(text string) (time.Duration, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if len(text) == 0 {
+		return 0, errors.New("you need to specify an amount of time, e.g. **30**, **90m** or **1h30m**")
+	}
+
+	// Bare numbers are minutes; large ones are rejected before they can overflow
+	var duration time.Duration
+	minutes, err := strconv.Atoi(text)
+	if err == nil {
+		if minutes > int(MaxDuration/time.Minute) {
+			return 0, fmt.Errorf("'%s' is too long, the limit is %s", text, humanize(MaxDuration))
+		}
+		duration = time.Duration(minutes) * time.Minute
+	} else {
+		duration, err = time.ParseDuration(text)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid amount of time, try something like **30**, **90m** or **1h30m**", text)
+		}
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("'%s' is negative, you need to specify a positive amount of time", text)
+	}
+	if duration > MaxDuration {
+		return 0, fmt.Errorf("'%s' is too long, the limit is %s", text, humanize(MaxDuration))
+	}
+
+	return duration, nil
+}
+
+////////////////////////////////////////////////////////////////
+
 // Common longer durations
 const (
 	Day   = 24 * time.Hour
@@ -102,6 +247,11 @@ const (
 	Year  = 365 * Day
 )
 
+// Longest amount of time accepted by parseDuration
+const (
+	MaxDuration = Year
+)
+
 func humanize(duration time.Duration) string {
 	if duration < 0 {
 		duration = -duration
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	valid := []struct {
+		text     string
+		expected time.Duration
+	}{
+		{"90", 90 * time.Minute},
+		{"0", 0},
+		{"30m", 30 * time.Minute},
+		{"90m", 90 * time.Minute},
+		{"1h30m", time.Hour + 30*time.Minute},
+		{"2H", 2 * time.Hour},
+		{" 45s ", 45 * time.Second},
+		{"525600", Year},
+	}
+	for _, test := range valid {
+		duration, err := parseDuration(test.text)
+		if err != nil {
+			t.Errorf("parseDuration(%q): unexpected error: %v", test.text, err)
+			continue
+		}
+		if duration != test.expected {
+			t.Errorf("parseDuration(%q) = %v, expected %v", test.text, duration, test.expected)
+		}
+	}
+
+	invalid := []string{"", "soon", "1x", "h30", "-5", "-1h", "1.5.3m", "9999999999999", "525601", "10000h"}
+	for _, text := range invalid {
+		duration, err := parseDuration(text)
+		if err == nil {
+			t.Errorf("parseDuration(%q) = %v, expected an error", text, duration)
+		}
+	}
+}
+
+func TestDigits10(t *testing.T) {
+	// Limits of int on the target platform, which can be 32 or 64 bits wide
+	const maxInt = 1<<(strconv.IntSize-1) - 1
+	const minInt = -maxInt - 1
+	maxDigits := 19
+	if strconv.IntSize == 32 {
+		maxDigits = 10
+	}
+
+	tests := []struct {
+		number   int
+		expected int
+	}{
+		{0, 1}, {1, 1}, {9, 1}, {10, 2}, {99, 2}, {100, 3},
+		{-1, 2}, {-10, 3},
+		{maxInt, maxDigits}, {minInt, maxDigits + 1},
+	}
+	for _, test := range tests {
+		if digits := digits10(test.number); digits != test.expected {
+			t.Errorf("digits10(%d) = %d, expected %d", test.number, digits, test.expected)
+		}
+		if digits := len(strconv.Itoa(test.number)); digits != test.expected {
+			t.Errorf("strconv.Itoa(%d) has %d characters, expected %d", test.number, digits, test.expected)
+		}
+	}
+}
+
+func TestRightpad(t *testing.T) {
+	tests := []struct {
+		text     string
+		total    int
+		expected string
+	}{
+		{"1. ", 3, "1. "},
+		{"1. ", 5, "1.   "},
+		{"100. ", 3, "100. "},
+		{"", 2, "  "},
+		{"ñ", 3, "ñ  "},
+	}
+	for _, test := range tests {
+		if padded := rightpad(test.text, test.total); padded != test.expected {
+			t.Errorf("rightpad(%q, %d) = %q, expected %q", test.text, test.total, padded, test.expected)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text     string
+		limit    int
+		expected string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"too long", 5, "too …"},
+		{"ñañaña", 4, "ñañ…"},
+		{"a\\*b", 3, "a…"},
+	}
+	for _, test := range tests {
+		if truncated := truncate(test.text, test.limit); truncated != test.expected {
+			t.Errorf("truncate(%q, %d) = %q, expected %q", test.text, test.limit, truncated, test.expected)
+		}
+	}
+}
+
+func TestJoinChunks(t *testing.T) {
+	tests := []struct {
+		items    []string
+		limit    int
+		expected []string
+	}{
+		{nil, 10, nil},
+		{[]string{"a", "b", "c"}, 10, []string{"a b c"}},
+		{[]string{"aaa", "bbb", "ccc"}, 7, []string{"aaa bbb", "ccc"}},
+		{[]string{"aaaaaaaa", "b"}, 5, []string{"aaaaaaaa", "b"}},
+	}
+	for _, test := range tests {
+		if chunks := joinChunks(test.items, " ", test.limit); !reflect.DeepEqual(chunks, test.expected) {
+			t.Errorf("joinChunks(%q, %d) = %q, expected %q", test.items, test.limit, chunks, test.expected)
+		}
+	}
+}
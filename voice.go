@@ -0,0 +1,120 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+////////////////////////////////////////////////////////////////
+// Temporary voice channels for the teams of a finished cup
+////////////////////////////////////////////////////////////////
+
+// How long the voice channels of a cup are kept after the teams are complete, if no result is recorded
+const (
+	VoiceChannelLifetime = 6 * time.Hour
+)
+
+// Creates a voice channel for each team, next to the cup channel, if enabled for the guild.
+// Players already connected to voice are moved to their team's channel if the guild asks for it.
+func (currentCup *Cup) createVoiceChannels(s DiscordSession) {
+	config := getGuildConfig(currentCup.GuildID)
+	if !config.VoiceChannels || len(currentCup.GuildID) == 0 || len(currentCup.VoiceChannelIDs) > 0 {
+		return
+	}
+
+	permissions, err := s.UserChannelPermissions(BotID, currentCup.ChannelID)
+	if err != nil || permissions&discordgo.PermissionManageChannels == 0 {
+		logWarn(logChannel(currentCup.ChannelID), "Can't create voice channels, missing permission:", err)
+		_, _ = sendMessage(s, currentCup.ChannelID, "I couldn't create voice channels for the teams, since I don't have the "+bold("Manage channels")+" permission.")
+		return
+	}
+
+	parentID := ""
+	if channel, err := s.StateChannel(currentCup.ChannelID); err == nil && channel != nil {
+		parentID = channel.ParentID
+	}
+
+	// Even if only some of the channels get created, they need to go away eventually
+	currentCup.VoiceChannelExpiry = time.Now().Add(VoiceChannelLifetime)
+	defer currentCup.scheduleVoiceChannelCleanup(s)
+
+	for i := range currentCup.Teams {
+		channel, err := s.GuildChannelCreateComplex(currentCup.GuildID, discordgo.GuildChannelCreateData{
+			Name:      currentCup.Teams[i].Name,
+			Type:      discordgo.ChannelTypeGuildVoice,
+			UserLimit: currentCup.TeamSize,
+			ParentID:  parentID,
+		})
+		if err != nil || channel == nil {
+			logWarn(logChannel(currentCup.ChannelID), "Error creating voice channel:", err)
+			_, _ = sendMessage(s, currentCup.ChannelID, "Sorry, I couldn't create voice channels for all the teams.")
+			return
+		}
+		currentCup.VoiceChannelIDs = append(currentCup.VoiceChannelIDs, channel.ID)
+
+		if config.MoveToVoice {
+			currentCup.moveTeamToVoice(s, i, channel.ID)
+		}
+	}
+}
+
+// Moves the members of a team to the given voice channel. Only players connected to voice can be moved,
+// so failures are expected and just logged.
+func (currentCup *Cup) moveTeamToVoice(s DiscordSession, teamIndex int, channelID string) {
+	for playerIndex := currentCup.Teams[teamIndex].First; playerIndex != -1; playerIndex = currentCup.Players[playerIndex].Next {
+		player := &currentCup.Players[playerIndex]
+		if player.isPlaceholder() {
+			continue
+		}
+		err := s.GuildMemberMove(currentCup.GuildID, player.ID, &channelID)
+		if err != nil {
+			logInfo(logChannel(currentCup.ChannelID), "Could not move", player.Name, "to voice:", err)
+		}
+	}
+}
+
+// Deletes the voice channels created for the teams, if any
+func (currentCup *Cup) deleteVoiceChannels(s DiscordSession) {
+	for _, channelID := range currentCup.VoiceChannelIDs {
+		_, err := s.ChannelDelete(channelID)
+		if err != nil {
+			logWarn(logChannel(currentCup.ChannelID), "Error deleting voice channel", channelID+":", err)
+		}
+	}
+	currentCup.VoiceChannelIDs = nil
+	currentCup.VoiceChannelExpiry = time.Time{}
+}
+
+// Sets up a timer that deletes the voice channels of the cup once they expire
+func (currentCup *Cup) scheduleVoiceChannelCleanup(s DiscordSession) {
+	if len(currentCup.VoiceChannelIDs) == 0 {
+		return
+	}
+	expiry := currentCup.VoiceChannelExpiry
+	time.AfterFunc(time.Until(expiry), func() {
+		currentCup.deleteExpiredVoiceChannels(s, expiry)
+	})
+}
+
+// Deletes the voice channels of the cup, unless they were deleted or recreated since they were set to expire
+func (currentCup *Cup) deleteExpiredVoiceChannels(s DiscordSession, expiry time.Time) {
+	lockCups.Lock()
+	expired := len(currentCup.VoiceChannelIDs) > 0 && currentCup.VoiceChannelExpiry.Equal(expiry)
+	lockCups.Unlock()
+	if expired {
+		logInfo(logChannel(currentCup.ChannelID), "No result recorded, deleting voice channels")
+		currentCup.deleteVoiceChannels(s)
+	}
+}
+
+// Sets up timers for the voice channels of all cups (e.g. after loading them from disk)
+func scheduleVoiceChannelCleanups(s DiscordSession) {
+	lockCups.Lock()
+	defer lockCups.Unlock()
+	for _, cups := range []map[string]*Cup{activeCups, finishedCups} {
+		for _, currentCup := range cups {
+			currentCup.scheduleVoiceChannelCleanup(s)
+		}
+	}
+}
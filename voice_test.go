@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVoiceChannelExpiry(t *testing.T) {
+	savedConfigs := guildConfigs
+	defer func() { guildConfigs = savedConfigs }()
+	guildConfigs = map[string]*GuildConfig{"guild": {GuildID: "guild", VoiceChannels: true}}
+
+	s := newFakeSession("guild")
+	currentCup := makeTestCup(2, 4)
+	currentCup.GuildID = "guild"
+	currentCup.ChannelID = "voice"
+	currentCup.pickTestPlayers(4)
+	currentCup.createVoiceChannels(s)
+	if len(currentCup.VoiceChannelIDs) != 2 {
+		t.Fatalf("got %d voice channels, expected 2", len(currentCup.VoiceChannelIDs))
+	}
+	expiry := currentCup.VoiceChannelExpiry
+	if remaining := time.Until(expiry); remaining <= 0 || remaining > VoiceChannelLifetime {
+		t.Errorf("voice channels expire in %v, expected %v", remaining, VoiceChannelLifetime)
+	}
+
+	// A timer left over from channels that were replaced doesn't touch the new ones
+	currentCup.deleteExpiredVoiceChannels(s, expiry.Add(-time.Hour))
+	if len(currentCup.VoiceChannelIDs) != 2 {
+		t.Error("voice channels deleted by a stale timer")
+	}
+
+	currentCup.deleteExpiredVoiceChannels(s, expiry)
+	if len(currentCup.VoiceChannelIDs) != 0 || !currentCup.VoiceChannelExpiry.IsZero() {
+		t.Errorf("voice channels not deleted once expired: %v", currentCup.VoiceChannelIDs)
+	}
+}
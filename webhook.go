@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Cup lifecycle events reported to the outgoing webhook
+const (
+	WebhookEventStart    = "start"
+	WebhookEventClose    = "close"
+	WebhookEventComplete = "complete"
+)
+
+// How long to wait for the webhook endpoint to respond
+const (
+	WebhookTimeout = 5 * time.Second
+)
+
+type (
+	webhookPlayer struct {
+		Name string `json:"name"`
+		ID   string `json:"id,omitempty"`
+	}
+
+	webhookTeam struct {
+		Name    string          `json:"name"`
+		Players []webhookPlayer `json:"players"`
+	}
+
+	webhookPayload struct {
+		Event     string        `json:"event"`
+		Time      time.Time     `json:"time"`
+		ChannelID string        `json:"channel_id"`
+		GuildID   string        `json:"guild_id"`
+		Manager   webhookPlayer `json:"manager"`
+		Teams     []webhookTeam `json:"teams,omitempty"`
+	}
+)
+
+var (
+	webhookClient = &http.Client{Timeout: WebhookTimeout}
+)
+
+func makeWebhookPlayer(player *Player) webhookPlayer {
+	return webhookPlayer{Name: player.Name, ID: player.ID}
+}
+
+// Notifies the outgoing webhook (if any) of a cup lifecycle event.
+// The payload is built right away, but sent in the background.
+func (currentCup *Cup) notifyWebhook(event string) {
+	if len(cupOptions.webhookURL) == 0 {
+		return
+	}
+
+	payload := webhookPayload{
+		Event:     event,
+		Time:      time.Now().UTC(),
+		ChannelID: currentCup.ChannelID,
+		GuildID:   currentCup.GuildID,
+		Manager:   makeWebhookPlayer(&currentCup.Manager),
+	}
+	for i := range currentCup.Teams {
+		team := webhookTeam{Name: currentCup.Teams[i].Name, Players: []webhookPlayer{}}
+		for playerIndex := currentCup.Teams[i].First; playerIndex != -1; playerIndex = currentCup.Players[playerIndex].Next {
+			team.Players = append(team.Players, makeWebhookPlayer(&currentCup.Players[playerIndex]))
+		}
+		payload.Teams = append(payload.Teams, team)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logError(logChannel(currentCup.ChannelID), "Error encoding webhook payload:", err)
+		return
+	}
+
+	go postWebhook(cupOptions.webhookURL, event, body)
+}
+
+func postWebhook(url string, event string, body []byte) {
+	response, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logWarn("Error sending", event, "webhook:", err)
+		return
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		logWarn("Webhook endpoint rejected", event, "event:", response.Status)
+	}
+}